@@ -5,40 +5,104 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	stdlog "log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 
 	"github.com/open-cluster-management/alerts-collector/pkg/forwarder"
+	"github.com/open-cluster-management/alerts-collector/pkg/tracing"
+	"github.com/open-cluster-management/alerts-collector/pkg/version"
 	"github.com/open-cluster-management/alerts-collector/pkg/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test-send" {
+		os.Exit(testSend(os.Args[2:]))
+	}
+
 	// default configuration for webhook server
 	whOpts := &webhook.Options{
 		Port:     8443,
 		CertFile: "/etc/alerts-collector/certs/tls.crt",
 		KeyFile:  "/etc/alerts-collector/certs/tls.key",
+
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+
+		MaxRequestBytes: 4 << 20,
 	}
 
 	// default log level: info
 	logLevel := "info"
 
+	// undefined environment variables in the configuration expand to the empty value by default
+	strictEnv := false
+
+	// routing rules are optional
+	routingConfigFile := ""
+
+	printVersion := false
+
+	// alert payloads are logged at debug level by default
+	logAlertPayloads := true
+
+	// the reload endpoint is disabled by default
+	enableReload := false
+
+	// tracing is disabled by default
+	enableTracing := false
+
 	// default config file for upstream alertmanagers
 	amConfigFile := "/etc/alerts-collector/config/alertmanager-config/config.yaml"
 
 	// init command line parameters
 	flag.IntVar(&whOpts.Port, "port", whOpts.Port, "port for the alerts collector.")
 	flag.StringVar(&logLevel, "log-level", logLevel, "Log filtering level. e.g info, debug, warn, error.")
+	flag.BoolVar(&logAlertPayloads, "log-alert-payloads", logAlertPayloads, "Log the labels and annotations of the received alerts, only their counts and fingerprints are logged if disabled.")
+	flag.IntVar(&whOpts.LogSampleRate, "log-sample-rate", whOpts.LogSampleRate, "Log 1 in every N received alerts at debug level to limit the log volume during alert storms, 0 or 1 logs all of them.")
 	flag.StringVar(&whOpts.CertFile, "tls-cert", whOpts.CertFile, "File containing the x509 Certificate for HTTPS.")
 	flag.StringVar(&whOpts.KeyFile, "tls-key", whOpts.KeyFile, "File containing the x509 private key to --tlsCertFile.")
-	flag.StringVar(&amConfigFile, "alertmanagers.config-file", amConfigFile, "YAML format file containing the configuration of upstream alertmanagers.")
+	flag.StringVar(&whOpts.ClientCA, "tls-client-ca", whOpts.ClientCA, "File containing the CA bundle to verify client certificates, alerts from verified clients can be routed by client identity.")
+	flag.DurationVar(&whOpts.CertWaitTimeout, "tls-wait-timeout", whOpts.CertWaitTimeout, "Time to wait for the certificate and key files to appear, e.g. when the secret is mounted late, 0 fails immediately.")
+	flag.BoolVar(&whOpts.SelfSignedFallback, "tls-self-signed-fallback", whOpts.SelfSignedFallback, "Serve a generated self-signed certificate if the certificate and key can't be loaded. Insecure, for development and testing only.")
+	flag.DurationVar(&whOpts.SummaryInterval, "summary-interval", whOpts.SummaryInterval, "Interval to log a summary of received, forwarded, dropped and failed alerts, 0 disables it.")
+	flag.DurationVar(&whOpts.ReadHeaderTimeout, "web.read-header-timeout", whOpts.ReadHeaderTimeout, "Maximum duration to read the request headers, 0 means no timeout.")
+	flag.DurationVar(&whOpts.ReadTimeout, "web.read-timeout", whOpts.ReadTimeout, "Maximum duration to read the entire request, 0 means no timeout.")
+	flag.DurationVar(&whOpts.WriteTimeout, "web.write-timeout", whOpts.WriteTimeout, "Maximum duration before timing out writes of the response, 0 means no timeout.")
+	flag.DurationVar(&whOpts.IdleTimeout, "web.idle-timeout", whOpts.IdleTimeout, "Maximum time to wait for the next request on a keep-alive connection.")
+	flag.Int64Var(&whOpts.MaxRequestBytes, "web.max-request-bytes", whOpts.MaxRequestBytes, "Maximum size of the webhook request body in bytes, larger requests are rejected with 413, 0 means no limit.")
+	flag.BoolVar(&whOpts.LenientDecode, "web.lenient-decode", whOpts.LenientDecode, "Forward the valid alerts of partially invalid webhook payloads instead of rejecting the whole payload.")
+	flag.StringVar(&whOpts.OnForwardError, "web.on-forward-error", webhook.OnForwardErrorRetry, "Response to alerts that failed to be forwarded, retry answers 500 so the sender retries, accept answers 200 to avoid amplifying alert storms with retries.")
+	flag.BoolVar(&whOpts.AnyContentType, "web.any-content-type", whOpts.AnyContentType, "Decode the alerts regardless of the Content-Type of the requests instead of answering 415 if it isn't application/json, for senders not setting it.")
+	flag.BoolVar(&whOpts.DebugEcho, "web.enable-debug-echo", whOpts.DebugEcho, "Serve /debug/echo returning the normalized alerts of a webhook payload without forwarding them, requires --tls-client-ca.")
+	flag.BoolVar(&whOpts.AdminAPI, "web.enable-admin-api", whOpts.AdminAPI, "Serve /admin/alertmanagers/{index}/enable and /disable to toggle forwarding to an alertmanager at runtime, requires --tls-client-ca.")
+	flag.BoolVar(&enableReload, "web.enable-reload", enableReload, "Serve /-/reload rebuilding the forwarder from the configuration files, restricted to clients with a verified certificate if --tls-client-ca is set, otherwise to loopback clients.")
+	flag.DurationVar(&whOpts.ShutdownDelay, "web.shutdown-delay", whOpts.ShutdownDelay, "Time to reject alerts with 503 and report not ready on shutdown before closing the listener, so load balancers can drain the server.")
+	flag.BoolVar(&whOpts.DisableHTTP2, "web.disable-http2", whOpts.DisableHTTP2, "Serve HTTP/1.1 only.")
+	flag.StringVar(&whOpts.WebhookPath, "web.webhook-path", webhook.DefaultWebhookPath, "Path of the webhook, the routing groups are served below it.")
+	flag.StringVar(&whOpts.HealthzPath, "web.healthz-path", webhook.DefaultHealthzPath, "Path of the liveness endpoint.")
+	flag.StringVar(&whOpts.ReadyzPath, "web.readyz-path", webhook.DefaultReadyzPath, "Path of the readiness endpoint.")
+	flag.StringVar(&whOpts.MetricsPath, "web.metrics-path", webhook.DefaultMetricsPath, "Path of the metrics endpoint.")
+	flag.StringVar(&amConfigFile, "alertmanagers.config-file", amConfigFile, "YAML format file containing the configuration of upstream alertmanagers, or a directory of *.yaml files whose alertmanagers are merged.")
+	flag.BoolVar(&strictEnv, "alertmanagers.config-strict-env", strictEnv, "Fail loading the configuration of upstream alertmanagers if it references undefined ${VAR} environment variables, instead of expanding them to the empty value.")
+	flag.StringVar(&routingConfigFile, "routing.config-file", routingConfigFile, "YAML format file containing the relabel, drop and routing rules, reloaded on change or SIGHUP.")
+	flag.BoolVar(&enableTracing, "tracing", enableTracing, "Export traces with OTLP over HTTP, the exporter is configured with the standard OTEL_EXPORTER_OTLP_* environment variables.")
+	flag.BoolVar(&printVersion, "version", printVersion, "Print the version and exit.")
 	flag.Parse()
 
+	if printVersion {
+		fmt.Println(version.Version)
+		return
+	}
+
 	// setup logger
 	l := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
 	l = level.NewFilter(l, logLevelFromString(logLevel))
@@ -46,15 +110,35 @@ func main() {
 	l = log.WithPrefix(l, "caller", log.DefaultCaller)
 	stdlog.SetOutput(log.NewStdlibAdapter(l))
 	whOpts.Logger = l
+	whOpts.RedactPayloads = !logAlertPayloads
+
+	if enableTracing {
+		shutdownTracing, err := tracing.Setup(context.Background())
+		if err != nil {
+			level.Error(l).Log("msg", "failed to set up tracing", "err", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				level.Error(l).Log("msg", "failed to shut down tracing", "err", err)
+			}
+		}()
+	}
 
 	// create new alerts forwarder with alertmanager configuration file
-	fwder, err := forwarder.NewForwarder(l, amConfigFile)
+	newForwarder := func() (*forwarder.Forwarder, error) {
+		return forwarder.NewForwarderWithOptions(l, amConfigFile, forwarder.Options{RoutingConfigFile: routingConfigFile, StrictEnv: strictEnv, RedactPayloads: !logAlertPayloads})
+	}
+	fwder, err := newForwarder()
 	if err != nil {
 		level.Error(l).Log("msg", "failed to create alert forwarder", "err", err)
 		os.Exit(1)
 	}
 
 	whOpts.Forwarder = fwder
+	if enableReload {
+		whOpts.Reload = newForwarder
+	}
 	webhookSvr, err := webhook.NewWebhook(whOpts)
 	if err != nil {
 		level.Error(l).Log("msg", "failed to create webhook server", "err", err)
@@ -71,6 +155,17 @@ func main() {
 
 	level.Info(l).Log("msg", "alerts collector initialized")
 
+	// reload routing rules on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			if err := webhookSvr.Forwarder().ReloadRouting(); err != nil {
+				level.Error(l).Log("msg", "failed to reload routing configuration", "err", err)
+			}
+		}
+	}()
+
 	// listening OS shutdown singal
 	signalChan := make(chan os.Signal, 1)
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
@@ -80,6 +175,7 @@ func main() {
 	if err = webhookSvr.Shutdown(context.TODO()); err != nil {
 		level.Error(l).Log("msg", "failed to shut down the webhook server gracefully", "err", err)
 	}
+	webhookSvr.Forwarder().Shutdown()
 }
 
 // logLevelFromString determines log level to string, defaults to all
@@ -0,0 +1,117 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/forwarder"
+)
+
+// labelFlags collects the repeated --label name=value flags
+type labelFlags map[string]string
+
+func (f labelFlags) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, value := range f {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f labelFlags) Set(s string) error {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return fmt.Errorf("expected name=value, got %q", s)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// testSend forwards a single sample alert with the configured forwarder, prints the result
+// of each alertmanager endpoint and receiver and returns the exit code
+func testSend(args []string) int {
+	fs := flag.NewFlagSet("test-send", flag.ExitOnError)
+	amConfigFile := fs.String("alertmanagers.config-file", "/etc/alerts-collector/config/alertmanager-config/config.yaml", "YAML format file containing the configuration of upstream alertmanagers.")
+	routingConfigFile := fs.String("routing.config-file", "", "YAML format file containing the routing and drop rules.")
+	logLevel := fs.String("log-level", "warn", "Log filtering level. e.g info, debug, warn, error.")
+	alertname := fs.String("alertname", "AlertsCollectorTestAlert", "Name of the sample alert.")
+	severity := fs.String("severity", "info", "Severity of the sample alert.")
+	summary := fs.String("summary", "Test alert sent by the alerts collector", "Summary annotation of the sample alert.")
+	resolved := fs.Bool("resolved", false, "Send the sample alert as resolved.")
+	labels := labelFlags{}
+	fs.Var(labels, "label", "Additional label of the sample alert as name=value, can be repeated.")
+	fs.Parse(args)
+
+	l := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	l = level.NewFilter(l, logLevelFromString(*logLevel))
+	l = log.WithPrefix(l, "ts", log.DefaultTimestampUTC)
+
+	var (
+		mtx     sync.Mutex
+		failed  bool
+		results int
+	)
+	fwder, err := forwarder.NewForwarderWithOptions(l, *amConfigFile, forwarder.Options{
+		RoutingConfigFile: *routingConfigFile,
+		OnSendResult: func(target string, numAlerts int, err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			results++
+			if err != nil {
+				failed = true
+				fmt.Printf("FAIL %s: %v\n", target, err)
+				return
+			}
+			fmt.Printf("OK   %s: %d alert(s) sent\n", target, numAlerts)
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create alert forwarder: %v\n", err)
+		return 1
+	}
+
+	alert := template.Alert{
+		Status: "firing",
+		Labels: template.KV{
+			"alertname": *alertname,
+			"severity":  *severity,
+		},
+		Annotations: template.KV{"summary": *summary},
+		StartsAt:    time.Now(),
+	}
+	for name, value := range labels {
+		alert.Labels[name] = value
+	}
+	if *resolved {
+		alert.Status = "resolved"
+		alert.EndsAt = time.Now()
+	}
+
+	err = fwder.Forward(context.Background(), template.Alerts{alert})
+	// stopping flushes the pending batch if batching is configured
+	fwder.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "forwarding the test alert failed: %v\n", err)
+		return 1
+	}
+	if failed {
+		return 1
+	}
+	if results == 0 {
+		fmt.Fprintln(os.Stderr, "no alertmanager or receiver reported a result, the test alert wasn't sent, "+
+			"e.g. it was dropped by the routing rules or inhibited, held by a schedule or not forwarded as resolved")
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTestSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		config       string
+		args         []string
+		wantCode     int
+		wantRequests int
+	}{
+		{name: "sent", status: http.StatusOK, wantCode: 0, wantRequests: 1},
+		{name: "upstream failure", status: http.StatusInternalServerError, wantCode: 1, wantRequests: 1},
+		{
+			name:     "no result",
+			status:   http.StatusOK,
+			config:   "  forward_resolved: false\n",
+			args:     []string{"--resolved"},
+			wantCode: 1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mtx      sync.Mutex
+				requests int
+			)
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				requests++
+				mtx.Unlock()
+				w.WriteHeader(tc.status)
+			}))
+			defer upstream.Close()
+
+			config := filepath.Join(t.TempDir(), "alertmanagers.yaml")
+			content := "alertmanagers:\n- static_configs: [" + strings.TrimPrefix(upstream.URL, "http://") + "]\n" + tc.config
+			if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			args := append([]string{"--alertmanagers.config-file", config, "--log-level", "error"}, tc.args...)
+			if code := testSend(args); code != tc.wantCode {
+				t.Errorf("testSend() = %d, want %d", code, tc.wantCode)
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			if requests != tc.wantRequests {
+				t.Errorf("upstream received %d requests, want %d", requests, tc.wantRequests)
+			}
+		})
+	}
+}
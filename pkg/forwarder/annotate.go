@@ -0,0 +1,67 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	texttemplate "text/template"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// annotationTemplate renders an annotation added to the alerts posted to an alertmanager
+type annotationTemplate struct {
+	name string
+	tmpl *texttemplate.Template
+}
+
+// newAnnotationTemplates parses the annotation templates sorted by annotation name, missing labels
+// and annotations fail the rendering
+func newAnnotationTemplates(templates map[string]string) ([]annotationTemplate, error) {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ats := make([]annotationTemplate, 0, len(names))
+	for _, name := range names {
+		tmpl, err := texttemplate.New(name).Option("missingkey=error").Funcs(TemplateFuncs).Parse(templates[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template of annotation %q: %v", name, err)
+		}
+		ats = append(ats, annotationTemplate{name: name, tmpl: tmpl})
+	}
+	return ats, nil
+}
+
+// annotate returns the alerts with the templated annotations, an annotation whose template
+// fails is skipped and the existing value, if any, is kept
+func annotate(l log.Logger, ats []annotationTemplate, alerts template.Alerts) template.Alerts {
+	if len(ats) == 0 {
+		return alerts
+	}
+
+	annotated := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		annotations := make(template.KV, len(alt.Annotations)+len(ats))
+		for k, v := range alt.Annotations {
+			annotations[k] = v
+		}
+		for _, at := range ats {
+			var buf bytes.Buffer
+			if err := at.tmpl.Execute(&buf, alt); err != nil {
+				level.Debug(l).Log("msg", "skipping annotation, rendering its template failed", "annotation", at.name, "fingerprint", Fingerprint(alt), "err", err)
+				continue
+			}
+			annotations[at.name] = buf.String()
+		}
+		alt.Annotations = annotations
+		annotated = append(annotated, alt)
+	}
+	return annotated
+}
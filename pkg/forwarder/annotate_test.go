@@ -0,0 +1,67 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestAnnotate(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates map[string]string
+		alert     template.Alert
+		want      template.KV
+	}{
+		{
+			name:      "rendered from the labels",
+			templates: map[string]string{"dashboard": "https://grafana.example.com/d/{{ .Labels.namespace }}"},
+			alert:     template.Alert{Labels: template.KV{"namespace": "monitoring"}, Annotations: template.KV{"summary": "s"}},
+			want:      template.KV{"summary": "s", "dashboard": "https://grafana.example.com/d/monitoring"},
+		},
+		{
+			name:      "missing label keeps the existing value",
+			templates: map[string]string{"dashboard": "https://grafana.example.com/d/{{ .Labels.namespace }}"},
+			alert:     template.Alert{Labels: template.KV{}, Annotations: template.KV{"dashboard": "default"}},
+			want:      template.KV{"dashboard": "default"},
+		},
+		{
+			name:      "missing label without existing value",
+			templates: map[string]string{"dashboard": "{{ .Labels.namespace }}"},
+			alert:     template.Alert{Labels: template.KV{}, Annotations: template.KV{}},
+			want:      template.KV{},
+		},
+		{
+			name:      "template functions",
+			templates: map[string]string{"title": "{{ .Labels.alertname | toUpper }}"},
+			alert:     template.Alert{Labels: template.KV{"alertname": "a"}, Annotations: template.KV{}},
+			want:      template.KV{"title": "A"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ats, err := newAnnotationTemplates(tc.templates)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := copyKV(tc.alert.Annotations)
+			got := annotate(log.NewNopLogger(), ats, template.Alerts{tc.alert})
+			if !reflect.DeepEqual(got[0].Annotations, tc.want) {
+				t.Errorf("annotations = %v, want %v", got[0].Annotations, tc.want)
+			}
+			if !reflect.DeepEqual(tc.alert.Annotations, before) {
+				t.Error("the annotations shared with the sender were modified")
+			}
+		})
+	}
+}
+
+func TestNewAnnotationTemplatesInvalid(t *testing.T) {
+	if _, err := newAnnotationTemplates(map[string]string{"a": "{{ .Labels"}); err == nil {
+		t.Error("newAnnotationTemplates() succeeded with an invalid template, want error")
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build archive
+// +build archive
+
+package forwarder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	// defaultArchiveFlushInterval is the interval the archived alerts are uploaded at if it is not configured
+	defaultArchiveFlushInterval = 5 * time.Minute
+	// defaultArchiveMaxBatchSize is the maximum number of alerts per archived object if it is not configured
+	defaultArchiveMaxBatchSize = 1000
+)
+
+// ObjectStore stores objects in a bucket
+type ObjectStore interface {
+	// Put uploads the object with the given key
+	Put(ctx context.Context, key string, body []byte) error
+}
+
+// archiver collects forwarded alerts and uploads them as gzipped JSON objects to an object store
+type archiver struct {
+	logger        log.Logger
+	store         ObjectStore
+	prefix        string
+	flushInterval time.Duration
+	maxBatchSize  int
+	now           func() time.Time
+
+	mtx     sync.Mutex
+	pending template.Alerts
+
+	flushc chan struct{}        // signals the run loop that a batch is full
+	stopc  chan context.Context // receives the context bounding the final flush
+	donec  chan struct{}
+}
+
+// newArchiver returns a new archiver and starts its flush loop, nil if archiving is not configured
+func newArchiver(l log.Logger, cfg *ArchiveConfig) (*archiver, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	store, err := newS3Store(*cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object store for archive: %v", err)
+	}
+	return startArchiver(l, store, cfg), nil
+}
+
+// startArchiver returns a new archiver uploading to the store and starts its flush loop
+func startArchiver(l log.Logger, store ObjectStore, cfg *ArchiveConfig) *archiver {
+	a := &archiver{
+		logger:        l,
+		store:         store,
+		prefix:        cfg.Prefix,
+		flushInterval: time.Duration(cfg.FlushInterval),
+		maxBatchSize:  cfg.MaxBatchSize,
+		now:           time.Now,
+		flushc:        make(chan struct{}, 1),
+		stopc:         make(chan context.Context, 1),
+		donec:         make(chan struct{}),
+	}
+	if a.flushInterval <= 0 {
+		a.flushInterval = defaultArchiveFlushInterval
+	}
+	if a.maxBatchSize <= 0 {
+		a.maxBatchSize = defaultArchiveMaxBatchSize
+	}
+
+	go a.run()
+	return a
+}
+
+// run flushes the pending alerts periodically until the archiver is stopped
+func (a *archiver) run() {
+	defer close(a.donec)
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.flush(context.Background())
+		case <-a.flushc:
+			a.flush(context.Background())
+		case ctx := <-a.stopc:
+			a.flush(ctx)
+			return
+		}
+	}
+}
+
+// add queues the alerts for archiving and has the run loop upload them once a batch is full,
+// the upload never delays the forwarding
+func (a *archiver) add(alerts template.Alerts) {
+	if a == nil {
+		return
+	}
+
+	a.mtx.Lock()
+	a.pending = append(a.pending, alerts...)
+	full := len(a.pending) >= a.maxBatchSize
+	a.mtx.Unlock()
+
+	if full {
+		select {
+		case a.flushc <- struct{}{}:
+		default:
+			// a flush is already pending
+		}
+	}
+}
+
+// flush uploads the pending alerts in objects of at most maxBatchSize alerts
+func (a *archiver) flush(ctx context.Context) {
+	a.mtx.Lock()
+	pending := a.pending
+	a.pending = nil
+	a.mtx.Unlock()
+
+	for len(pending) > 0 {
+		n := len(pending)
+		if n > a.maxBatchSize {
+			n = a.maxBatchSize
+		}
+		if err := a.upload(ctx, pending[:n]); err != nil {
+			level.Warn(a.logger).Log("msg", "archiving alerts failed", "numAlerts", n, "err", err)
+		}
+		pending = pending[n:]
+	}
+}
+
+// upload writes the alerts as a gzipped JSON object
+func (a *archiver) upload(ctx context.Context, alerts template.Alerts) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(alerts); err != nil {
+		return fmt.Errorf("failed to encode alerts: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to compress alerts: %v", err)
+	}
+
+	now := a.now().UTC()
+	key := path.Join(a.prefix, now.Format("2006/01/02"), fmt.Sprintf("%d.json.gz", now.UnixNano()))
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := a.store.Put(ctx, key, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to upload object %q: %v", key, err)
+	}
+	level.Debug(a.logger).Log("msg", "archived alerts", "key", key, "numAlerts", len(alerts))
+	return nil
+}
+
+// stop flushes the pending alerts within the context deadline and stops the archiver
+func (a *archiver) stop(ctx context.Context) {
+	if a == nil {
+		return
+	}
+	a.stopc <- ctx
+	select {
+	case <-a.donec:
+	case <-ctx.Done():
+		level.Warn(a.logger).Log("msg", "archiving pending alerts timed out on shutdown", "err", ctx.Err())
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build !archive
+// +build !archive
+
+package forwarder
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// archiver is a no-op when the alerts collector is built without the archive tag
+type archiver struct{}
+
+// newArchiver returns error if archiving is configured but not compiled in
+func newArchiver(l log.Logger, cfg *ArchiveConfig) (*archiver, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("archive is not supported, rebuild the alerts collector with '-tags archive'")
+}
+
+func (a *archiver) add(alerts template.Alerts) {}
+
+func (a *archiver) stop(ctx context.Context) {}
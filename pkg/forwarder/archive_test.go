@@ -0,0 +1,208 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build archive
+// +build archive
+
+package forwarder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// memStore is an in-memory object store
+type memStore struct {
+	block   chan struct{} // delays the uploads until it is closed if set
+	mtx     sync.Mutex
+	err     error
+	objects map[string][]byte
+}
+
+func (s *memStore) Put(ctx context.Context, key string, body []byte) error {
+	if s.block != nil {
+		select {
+		case <-s.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.objects == nil {
+		s.objects = make(map[string][]byte)
+	}
+	s.objects[key] = body
+	return nil
+}
+
+// archived returns the keys of the stored objects and the alertnames of the alerts they contain, sorted
+func (s *memStore) archived(t *testing.T) ([]string, []string) {
+	t.Helper()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var keys, names []string
+	for key, body := range s.objects {
+		keys = append(keys, key)
+		for _, alt := range decodeArchived(t, body) {
+			names = append(names, alt.Labels[model.AlertNameLabel])
+		}
+	}
+	sort.Strings(keys)
+	sort.Strings(names)
+	return keys, names
+}
+
+// decodeArchived decodes the alerts of a gzipped JSON object
+func decodeArchived(t *testing.T, body []byte) template.Alerts {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to decompress the archived object: %v", err)
+	}
+	var alerts template.Alerts
+	if err := json.NewDecoder(zr).Decode(&alerts); err != nil {
+		t.Fatalf("failed to decode the archived object: %v", err)
+	}
+	return alerts
+}
+
+func TestArchiver(t *testing.T) {
+	store := &memStore{}
+	a := startArchiver(log.NewNopLogger(), store, &ArchiveConfig{Prefix: "alerts", MaxBatchSize: 2, FlushInterval: model.Duration(time.Hour)})
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	a.now = func() time.Time {
+		now = now.Add(time.Nanosecond)
+		return now
+	}
+
+	a.add(firing("a", "b", "c"))
+	a.stop(context.Background())
+
+	keys, names := store.archived(t)
+	if len(keys) != 2 {
+		t.Fatalf("archived objects = %v, want 2 objects of at most 2 alerts", keys)
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "alerts/2021/01/02/") || !strings.HasSuffix(key, ".json.gz") {
+			t.Errorf("object key = %q, want alerts/2021/01/02/<timestamp>.json.gz", key)
+		}
+	}
+	checkAlertnames(t, "archive", names, []string{"a", "b", "c"})
+}
+
+func TestArchiverFullBatch(t *testing.T) {
+	store := &memStore{block: make(chan struct{})}
+	a := startArchiver(log.NewNopLogger(), store, &ArchiveConfig{MaxBatchSize: 2, FlushInterval: model.Duration(time.Hour)})
+
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		a.add(firing("a", "b"))
+		a.add(firing("c", "d"))
+	}()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("adding full batches waited for the upload")
+	}
+
+	close(store.block)
+	a.stop(context.Background())
+	_, names := store.archived(t)
+	checkAlertnames(t, "archive", names, []string{"a", "b", "c", "d"})
+}
+
+func TestArchiverUploadFailure(t *testing.T) {
+	store := &memStore{err: errors.New("unavailable")}
+	a := startArchiver(log.NewNopLogger(), store, &ArchiveConfig{FlushInterval: model.Duration(time.Hour)})
+	a.add(firing("a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a.stop(ctx)
+	if ctx.Err() != nil {
+		t.Fatal("stopping the archiver timed out")
+	}
+	if keys, _ := store.archived(t); len(keys) != 0 {
+		t.Errorf("archived objects = %v, want none", keys)
+	}
+}
+
+func TestForwardArchive(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	s3 := newFakeS3(t, "AKID", "secret", "us-east-1")
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+archive:
+  endpoint: `+strings.TrimPrefix(s3.URL, "http://")+`
+  bucket: bucket
+  prefix: alerts
+  access_key: AKID
+  secret_key: secret
+  insecure: true
+`)
+
+	if err := fwder.Forward(context.Background(), firing("a", "b")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	fwder.Stop()
+
+	keys := s3.keys()
+	if len(keys) != 1 || !strings.HasPrefix(keys[0], "/bucket/alerts/") {
+		t.Fatalf("archived objects = %v, want one object in /bucket/alerts/", keys)
+	}
+	body, _ := s3.object(keys[0])
+	var names []string
+	for _, alt := range decodeArchived(t, body) {
+		names = append(names, alt.Labels[model.AlertNameLabel])
+	}
+	checkAlertnames(t, "archive", names, []string{"a", "b"})
+}
+
+func TestForwardArchiveOnly(t *testing.T) {
+	s3 := newFakeS3(t, "AKID", "secret", "eu-west-1")
+	fwder := newTestForwarder(t, `
+archive:
+  endpoint: `+strings.TrimPrefix(s3.URL, "http://")+`
+  region: eu-west-1
+  bucket: bucket
+  access_key: AKID
+  secret_key: secret
+  insecure: true
+  max_batch_size: 1
+`)
+
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	// the full batch is uploaded without waiting for the flush interval or the shutdown
+	deadline := time.Now().Add(5 * time.Second)
+	for len(s3.keys()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	keys := s3.keys()
+	if len(keys) != 1 {
+		t.Fatalf("archived objects = %v, want one object", keys)
+	}
+	body, _ := s3.object(keys[0])
+	if alerts := decodeArchived(t, body); len(alerts) != 1 || alerts[0].Labels[model.AlertNameLabel] != "a" {
+		t.Errorf("archived alerts = %v, want alert a", alerts)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// batcher buffers alerts for a window and flushes them as a single batch,
+// alerts with the same dedup key received within the window are coalesced
+type batcher struct {
+	logger  log.Logger
+	window  time.Duration
+	maxSize int
+	labels  []string // labels of the dedup key, all labels if empty
+	send    func(context.Context, template.Alerts) error
+
+	mtx     sync.Mutex
+	pending template.Alerts
+	index   map[string]int // dedup key -> index in pending
+	timer   *time.Timer
+	flushes sync.WaitGroup
+}
+
+// newBatcher returns a new batcher sending the flushed batches with the send function, nil if the window is not set
+func newBatcher(l log.Logger, window time.Duration, maxSize int, labels []string, send func(context.Context, template.Alerts) error) *batcher {
+	if window <= 0 {
+		return nil
+	}
+	return &batcher{
+		logger:  l,
+		window:  window,
+		maxSize: maxSize,
+		labels:  labels,
+		send:    send,
+		index:   make(map[string]int),
+	}
+}
+
+// add buffers the alerts, the batch is flushed once the window expires or the batch is full
+func (b *batcher) add(alerts template.Alerts) {
+	b.mtx.Lock()
+	for _, alt := range alerts {
+		fp := dedupKey(alt, b.labels)
+		if i, found := b.index[fp]; found {
+			// keep the latest state of the alert
+			b.pending[i] = alt
+			continue
+		}
+		b.index[fp] = len(b.pending)
+		b.pending = append(b.pending, alt)
+	}
+	if b.maxSize > 0 && len(b.pending) >= b.maxSize {
+		batch := b.take()
+		b.mtx.Unlock()
+		b.flush(context.Background(), batch)
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(b.window, func() {
+			b.mtx.Lock()
+			batch := b.take()
+			b.mtx.Unlock()
+			b.flush(context.Background(), batch)
+		})
+	}
+	b.mtx.Unlock()
+}
+
+// take returns the pending batch and resets the buffer, the lock must be held
+func (b *batcher) take() template.Alerts {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	b.index = make(map[string]int)
+	b.flushes.Add(1)
+	return batch
+}
+
+// flush sends the batch
+func (b *batcher) flush(ctx context.Context, batch template.Alerts) {
+	defer b.flushes.Done()
+
+	if len(batch) == 0 {
+		return
+	}
+	level.Debug(b.logger).Log("msg", "flush alert batch", "numAlerts", len(batch))
+	if err := b.send(ctx, batch); err != nil {
+		level.Warn(b.logger).Log("msg", "forwarding alert batch failed", "numAlerts", len(batch), "err", err)
+	}
+}
+
+// stop flushes the pending batch and waits for the in-flight flushes within the context deadline
+func (b *batcher) stop(ctx context.Context) {
+	if b == nil {
+		return
+	}
+
+	b.mtx.Lock()
+	batch := b.take()
+	b.mtx.Unlock()
+	b.flush(ctx, batch)
+
+	done := make(chan struct{})
+	go func() {
+		b.flushes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		level.Warn(b.logger).Log("msg", "flushing alert batches timed out on shutdown", "err", ctx.Err())
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestBatcher(t *testing.T) {
+	tests := []struct {
+		name        string
+		window      time.Duration
+		maxSize     int
+		labels      []string
+		adds        []template.Alerts
+		stop        bool
+		wantBatches [][]string
+	}{
+		{
+			name:        "flushed after the window",
+			window:      20 * time.Millisecond,
+			adds:        []template.Alerts{firing("a"), firing("b")},
+			wantBatches: [][]string{{"a", "b"}},
+		},
+		{
+			name:        "coalesced by fingerprint",
+			window:      20 * time.Millisecond,
+			adds:        []template.Alerts{firing("a"), resolved("a"), firing("b")},
+			wantBatches: [][]string{{"a", "b"}},
+		},
+		{
+			name:   "coalesced by dedup labels",
+			window: 20 * time.Millisecond,
+			labels: []string{"alertname"},
+			adds: []template.Alerts{
+				{withStatus("a", statusFiring, "pod", "a-1")},
+				{withStatus("a", statusFiring, "pod", "a-2")},
+			},
+			wantBatches: [][]string{{"a"}},
+		},
+		{
+			name:        "flushed when full",
+			window:      time.Hour,
+			maxSize:     2,
+			adds:        []template.Alerts{firing("a"), firing("b", "c"), firing("d")},
+			wantBatches: [][]string{{"a", "b", "c"}},
+		},
+		{
+			name:        "flushed on stop",
+			window:      time.Hour,
+			adds:        []template.Alerts{firing("a")},
+			stop:        true,
+			wantBatches: [][]string{{"a"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			batches := make(chan template.Alerts, 10)
+			b := newBatcher(log.NewNopLogger(), tc.window, tc.maxSize, tc.labels, func(_ context.Context, alerts template.Alerts) error {
+				batches <- alerts
+				return nil
+			})
+			for _, alerts := range tc.adds {
+				b.add(alerts)
+			}
+			if tc.stop {
+				b.stop(context.Background())
+			}
+			for i, want := range tc.wantBatches {
+				select {
+				case batch := <-batches:
+					checkAlertnames(t, "batch", alertnamesOf(batch), want)
+				case <-time.After(time.Second):
+					t.Fatalf("batch #%d not flushed", i+1)
+				}
+			}
+			select {
+			case batch := <-batches:
+				t.Errorf("unexpected batch %v", alertnamesOf(batch))
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestBatcherDisabled(t *testing.T) {
+	b := newBatcher(log.NewNopLogger(), 0, 0, nil, nil)
+	if b != nil {
+		t.Fatal("newBatcher() returned a batcher without window, want nil")
+	}
+	b.stop(context.Background())
+}
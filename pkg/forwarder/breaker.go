@@ -0,0 +1,148 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// breakerState represents the state of a circuit breaker
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// defaultBreakerCooldown is the time an open circuit breaker waits before probing the endpoint again
+const defaultBreakerCooldown = 30 * time.Second
+
+// CircuitBreakerConfig configures the circuit breaker for each endpoint of an alertmanager.
+type CircuitBreakerConfig struct {
+	// Number of consecutive failures after which the circuit opens, 0 disables the circuit breaker.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// Time the circuit stays open before a probe request is allowed.
+	Cooldown model.Duration `yaml:"cooldown"`
+}
+
+// circuitBreaker stops sending requests to an endpoint after consecutive failures
+type circuitBreaker struct {
+	endpoint  string
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mtx      sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreaker returns a new circuit breaker for the endpoint, nil if it is disabled
+func newCircuitBreaker(endpoint string, cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		return nil
+	}
+	cooldown := time.Duration(cfg.Cooldown)
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	cb := &circuitBreaker{
+		endpoint:  endpoint,
+		threshold: cfg.FailureThreshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+	cb.setState(breakerClosed)
+	return cb
+}
+
+// allow reports whether a request can be sent to the endpoint,
+// an open circuit lets a single probe request through once the cooldown has elapsed
+func (cb *circuitBreaker) allow() bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.setState(breakerHalfOpen)
+		cb.probing = true
+		return true
+	case breakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// open reports whether the circuit currently rejects requests, without letting a probe through
+func (cb *circuitBreaker) open() bool {
+	if cb == nil {
+		return false
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		return cb.now().Sub(cb.openedAt) < cb.cooldown
+	case breakerHalfOpen:
+		return cb.probing
+	default:
+		return false
+	}
+}
+
+// success records a successful request and closes the circuit
+func (cb *circuitBreaker) success() {
+	if cb == nil {
+		return
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.failures = 0
+	cb.probing = false
+	cb.setState(breakerClosed)
+}
+
+// failure records a failed request and opens the circuit if the threshold is reached or the probe failed
+func (cb *circuitBreaker) failure() {
+	if cb == nil {
+		return
+	}
+
+	cb.mtx.Lock()
+	defer cb.mtx.Unlock()
+
+	cb.failures++
+	cb.probing = false
+	if cb.state == breakerHalfOpen || cb.failures >= cb.threshold {
+		cb.openedAt = cb.now()
+		cb.setState(breakerOpen)
+	}
+}
+
+// setState updates the state and the state metric of the circuit breaker
+func (cb *circuitBreaker) setState(s breakerState) {
+	cb.state = s
+	breakerStateGauge.WithLabelValues(cb.endpoint).Set(float64(s))
+}
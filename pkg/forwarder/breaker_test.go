@@ -0,0 +1,127 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	// each step records a result or advances the clock, then checks whether a request is allowed
+	type step struct {
+		result    string // success, failure or empty
+		advance   time.Duration
+		wantAllow bool
+		wantOpen  bool
+	}
+	tests := []struct {
+		name  string
+		cfg   CircuitBreakerConfig
+		steps []step
+	}{
+		{
+			name: "opens after consecutive failures",
+			cfg:  CircuitBreakerConfig{FailureThreshold: 2, Cooldown: model.Duration(time.Minute)},
+			steps: []step{
+				{result: "failure", wantAllow: true},
+				{result: "failure", wantOpen: true},
+			},
+		},
+		{
+			name: "success resets the failures",
+			cfg:  CircuitBreakerConfig{FailureThreshold: 2, Cooldown: model.Duration(time.Minute)},
+			steps: []step{
+				{result: "failure", wantAllow: true},
+				{result: "success", wantAllow: true},
+				{result: "failure", wantAllow: true},
+			},
+		},
+		{
+			name: "probe after the cooldown closes on success",
+			cfg:  CircuitBreakerConfig{FailureThreshold: 1, Cooldown: model.Duration(time.Minute)},
+			steps: []step{
+				{result: "failure", wantOpen: true},
+				{advance: 30 * time.Second, wantOpen: true},
+				{advance: 30 * time.Second, wantAllow: true},
+				{result: "success", wantAllow: true},
+			},
+		},
+		{
+			name: "failed probe reopens",
+			cfg:  CircuitBreakerConfig{FailureThreshold: 3, Cooldown: model.Duration(time.Minute)},
+			steps: []step{
+				{result: "failure", wantAllow: true},
+				{result: "failure", wantAllow: true},
+				{result: "failure", wantOpen: true},
+				{advance: time.Minute, wantAllow: true},
+				{result: "failure", wantOpen: true},
+			},
+		},
+		{
+			name: "default cooldown",
+			cfg:  CircuitBreakerConfig{FailureThreshold: 1},
+			steps: []step{
+				{result: "failure", wantOpen: true},
+				{advance: defaultBreakerCooldown - time.Second, wantOpen: true},
+				{advance: time.Second, wantAllow: true},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			cb := newCircuitBreaker("test:"+tc.name, tc.cfg)
+			cb.now = func() time.Time { return now }
+			for i, s := range tc.steps {
+				switch s.result {
+				case "success":
+					cb.success()
+				case "failure":
+					cb.failure()
+				}
+				now = now.Add(s.advance)
+
+				if got := cb.open(); got != s.wantOpen {
+					t.Fatalf("step %d: open() = %v, want %v", i, got, s.wantOpen)
+				}
+				if got := cb.allow(); got != s.wantAllow {
+					t.Fatalf("step %d: allow() = %v, want %v", i, got, s.wantAllow)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	now := time.Now()
+	cb := newCircuitBreaker("test:probe", CircuitBreakerConfig{FailureThreshold: 1, Cooldown: model.Duration(time.Minute)})
+	cb.now = func() time.Time { return now }
+	cb.failure()
+	now = now.Add(time.Minute)
+
+	if !cb.allow() {
+		t.Fatal("allow() = false after the cooldown, want a probe")
+	}
+	if cb.allow() {
+		t.Error("allow() = true while the probe is in flight, want false")
+	}
+	if !cb.open() {
+		t.Error("open() = false while the probe is in flight, want true")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cb := newCircuitBreaker("test:disabled", CircuitBreakerConfig{})
+	if cb != nil {
+		t.Fatal("newCircuitBreaker() returned a circuit breaker without threshold, want nil")
+	}
+	for i := 0; i < 10; i++ {
+		cb.failure()
+	}
+	if !cb.allow() || cb.open() {
+		t.Error("disabled circuit breaker rejects requests, want all allowed")
+	}
+}
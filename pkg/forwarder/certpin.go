@@ -0,0 +1,83 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// peerVerifier returns the function verifying the certificate pins and allowed SANs,
+// nil if neither is configured. It runs after the regular certificate verification.
+func (c TLSConfig) peerVerifier() (func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error, error) {
+	if len(c.CertPins) == 0 && len(c.AllowedSANs) == 0 {
+		return nil, nil
+	}
+
+	pins := make([][]byte, 0, len(c.CertPins))
+	for _, p := range c.CertPins {
+		pin, err := hex.DecodeString(strings.ReplaceAll(p, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate pin %q, expected a hex encoded SHA-256 fingerprint", p)
+		}
+		pins = append(pins, pin)
+	}
+	sans := c.AllowedSANs
+
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no certificate presented")
+		}
+		if len(pins) > 0 && !matchesPin(rawCerts, pins) {
+			return fmt.Errorf("certificate chain matches none of the certificate pins")
+		}
+		if len(sans) > 0 {
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("failed to parse certificate: %v", err)
+			}
+			if !hasAllowedSAN(leaf, sans) {
+				return fmt.Errorf("certificate has none of the allowed subject alternative names")
+			}
+		}
+		return nil
+	}, nil
+}
+
+// matchesPin reports whether the fingerprint of any of the certificates is pinned
+func matchesPin(rawCerts [][]byte, pins [][]byte) bool {
+	for _, raw := range rawCerts {
+		sum := sha256.Sum256(raw)
+		for _, pin := range pins {
+			if bytes.Equal(sum[:], pin) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAllowedSAN reports whether the certificate has any of the DNS names or IP addresses as SAN
+func hasAllowedSAN(cert *x509.Certificate, sans []string) bool {
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			for _, certIP := range cert.IPAddresses {
+				if certIP.Equal(ip) {
+					return true
+				}
+			}
+			continue
+		}
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, san) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCertPins(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+	sum := sha256.Sum256(s.Certificate().Raw)
+	pin := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr bool
+	}{
+		{name: "pinned", tls: TLSConfig{CertPins: []string{pin}}},
+		{name: "pinned with colons", tls: TLSConfig{CertPins: []string{colonSeparated(pin)}}},
+		{name: "other pin", tls: TLSConfig{CertPins: []string{strings.Repeat("00", sha256.Size)}}, wantErr: true},
+		{name: "allowed DNS name", tls: TLSConfig{AllowedSANs: []string{"EXAMPLE.com"}}},
+		{name: "allowed IP address", tls: TLSConfig{AllowedSANs: []string{"127.0.0.1"}}},
+		{name: "no allowed SAN", tls: TLSConfig{AllowedSANs: []string{"alertmanager.example.org", "10.0.0.1"}}, wantErr: true},
+		{name: "pinned without allowed SAN", tls: TLSConfig{CertPins: []string{pin}, AllowedSANs: []string{"alertmanager.example.org"}}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// the test certificate isn't trusted, the pins and SANs are verified anyway
+			tc.tls.InsecureSkipVerify = true
+			client, err := createHTTPClient(ClientConfig{TLSConfig: tc.tls}, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Get(s.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tc.wantErr {
+				t.Errorf("request error = %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestInvalidCertPin(t *testing.T) {
+	for _, pin := range []string{"not hex", "abcd"} {
+		if _, err := (TLSConfig{CertPins: []string{pin}}).peerVerifier(); err == nil {
+			t.Errorf("peerVerifier() succeeded with the pin %q, want error", pin)
+		}
+	}
+}
+
+// colonSeparated returns the hex string with the bytes separated by colons, like openssl prints fingerprints
+func colonSeparated(h string) string {
+	pairs := make([]string, 0, len(h)/2)
+	for i := 0; i+1 < len(h); i += 2 {
+		pairs = append(pairs, h[i:i+2])
+	}
+	return strings.Join(pairs, ":")
+}
@@ -3,13 +3,27 @@
 package forwarder
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
 	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
 )
 
 // APIVersion represents the API version of the alertmanager endpoint
@@ -20,16 +34,166 @@ const (
 	APIv2 APIVersion = "v2"
 )
 
+// AlertingConfig represents the configuration for forwarding alerts to upstream alertmanagers.
 type AlertingConfig struct {
 	Alertmanagers []AlertmanagerConfig `yaml:"alertmanagers"`
+	Receivers     []ReceiverConfig     `yaml:"receivers"`
+	// Allow running without any alertmanager or receiver, all alerts are dropped and the forwarder is ready.
+	AllowEmpty bool `yaml:"allow_empty"`
+	// Name of the alertmanager the read requests to the alertmanager API, e.g. GET /api/v2/status, are proxied to.
+	// Only the requests of clients with a verified certificate are proxied.
+	APIProxy string `yaml:"api_proxy"`
+	// Named routing groups, each served on its own webhook path.
+	RoutingGroups []RoutingGroupConfig `yaml:"routing_groups"`
+	// Archive of the forwarded alerts, requires the alerts collector to be built with the archive tag.
+	// The archive can be the only sink, without any alertmanager or receiver.
+	Archive *ArchiveConfig `yaml:"archive"`
+	// Send alerts only once to endpoints listed or discovered by more than one alertmanager,
+	// the first alertmanager listing the endpoint keeps it.
+	DedupEndpoints bool `yaml:"dedup_endpoints"`
+	// Window to buffer alerts for before forwarding them as a single batch, 0 forwards alerts immediately.
+	BatchWindow model.Duration `yaml:"batch_window"`
+	// Maximum number of alerts in a batch, the batch is flushed before the window expires once it is full.
+	MaxBatchSize int `yaml:"max_batch_size"`
+	// Window within which resolved alerts with the same fingerprint are forwarded only once, 0 disables it.
+	ResolvedDedupWindow model.Duration `yaml:"resolved_dedup_window"`
+	// Labels identifying duplicate alerts when coalescing batches and deduplicating resolved alerts,
+	// all labels if empty.
+	DedupLabels []string `yaml:"dedup_labels"`
+	// Enrichment of alerts with Kubernetes metadata.
+	K8sEnrich K8sEnrichConfig `yaml:"k8s_enrich"`
+	// Maximum number of in-flight requests to all the upstreams, the other requests are queued, 0 means no limit.
+	MaxConcurrentForwards int `yaml:"max_concurrent_forwards"`
+	// Fail immediately when the circuit breakers of all the alertmanager endpoints are open,
+	// instead of skipping each endpoint. Never applies if receivers are configured.
+	FailFast bool `yaml:"fail_fast"`
+	// Minimum time from now until the EndsAt of the forwarded firing alerts, shorter or missing EndsAt are extended.
+	ResolveTimeout model.Duration `yaml:"resolve_timeout"`
+	// Send resolved notifications on shutdown for the firing alerts forwarded since the configuration was loaded,
+	// so the upstreams don't keep them firing until they time out. Doesn't apply to reloads.
+	ResolveOnShutdown bool `yaml:"resolve_on_shutdown"`
+	// Distribution of the alerts across the alertmanagers by label hash, instead of sending them to all.
+	Sharding ShardingConfig `yaml:"sharding"`
+	// Labels to regroup the alerts by, each group is forwarded as a separate batch.
+	GroupBy []string `yaml:"group_by"`
+	// Suppression of the transitions of alerts flapping between firing and resolved.
+	FlapDetection FlapDetectionConfig `yaml:"flap_detection"`
+	// Rules suppressing alerts while other alerts are firing. Source alerts without EndsAt stop inhibiting
+	// resolve_timeout (5m if not set) after they were last received. Resolved alerts are never suppressed.
+	InhibitRules []InhibitRuleConfig `yaml:"inhibit_rules"`
+	// Time windows the matching alerts are forwarded in, the alerts outside the windows are buffered or dropped.
+	Schedules []ScheduleConfig `yaml:"schedules"`
+	// Normalization of the severity label, applied before routing.
+	SeverityMapping SeverityMappingConfig `yaml:"severity_mapping"`
+	// Rules rewriting the generator URL of the alerts, the first matching rule applies.
+	GeneratorURLRewrite []GeneratorURLRewriteConfig `yaml:"generator_url_rewrite"`
+	// Maximum length in characters of the annotation values, longer values are truncated and end with
+	// an ellipsis, e.g. stack traces the upstreams would reject. 0 means no limit.
+	MaxAnnotationLength int `yaml:"max_annotation_length"`
+	// Labels removed from the alerts before forwarding them, e.g. instance or pod. They are removed after the
+	// drop rules, deduplication and enrichment and before the routes, group_by and tenant_label are applied.
+	DropLabels []string `yaml:"drop_labels"`
+	// YAML file of lookups adding labels and annotations to the alerts by the value of a label, reloaded on change.
+	EnrichmentFile string `yaml:"enrichment_file"`
+	// Injection of the runbook_url annotation by alertname.
+	Runbooks RunbooksConfig `yaml:"runbooks"`
+	// Time to flush the alerts still pending in the forwarder on shutdown.
+	DrainTimeout model.Duration `yaml:"drain_timeout"`
+	// Maximum number of distinct alertnames accepted within AlertnamesWindow, 0 means no limit.
+	MaxAlertnames int `yaml:"max_alertnames"`
+	// Sliding window used to track distinct alertnames.
+	AlertnamesWindow model.Duration `yaml:"alertnames_window"`
+	// Maximum number of alerts forwarded per minute across all routing groups, 0 means no limit.
+	MaxAlertsPerMinute int `yaml:"max_alerts_per_minute"`
+	// What happens to the alerts beyond max_alerts_per_minute, either drop (default) or buffer
+	// to forward them once the limit allows it.
+	RateLimitOverflow string `yaml:"rate_limit_overflow"`
+	// Heartbeat alert forwarded periodically to the alertmanagers and receivers of the top level.
+	Heartbeat HeartbeatConfig `yaml:"heartbeat"`
+}
+
+// ArchiveConfig configures uploading forwarded alerts as gzipped JSON objects to an S3 compatible
+// object store, e.g. AWS S3 or GCS with HMAC keys.
+type ArchiveConfig struct {
+	// Host (and port) of the object store, e.g. s3.amazonaws.com or storage.googleapis.com.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Key prefix of the archived objects.
+	Prefix        string `yaml:"prefix"`
+	AccessKey     string `yaml:"access_key"`
+	SecretKey     string `yaml:"secret_key"`
+	SecretKeyFile string `yaml:"secret_key_file"`
+	// Use plain HTTP to talk to the object store.
+	Insecure bool `yaml:"insecure"`
+	// Interval the collected alerts are uploaded at.
+	FlushInterval model.Duration `yaml:"flush_interval"`
+	// Maximum number of alerts per object.
+	MaxBatchSize int `yaml:"max_batch_size"`
+}
+
+// RoutingGroupConfig represents a named set of upstream alertmanagers and receivers.
+// Alerts posted to /webhook/<name> are forwarded to the routing group with that name.
+// Alerts posted to /webhook by a client whose verified TLS certificate carries one of
+// ClientIdentities (subject common name or SAN) are forwarded to the routing group instead.
+type RoutingGroupConfig struct {
+	Name             string               `yaml:"name"`
+	Alertmanagers    []AlertmanagerConfig `yaml:"alertmanagers"`
+	Receivers        []ReceiverConfig     `yaml:"receivers"`
+	ClientIdentities []string             `yaml:"client_identities"`
 }
 
 // AlertmanagerConfig represents a client to a cluster of Alertmanager endpoints.
 type AlertmanagerConfig struct {
+	// Name of the alertmanager, used to register a custom encoder.
+	Name             string          `yaml:"name"`
 	HTTPClientConfig ClientConfig    `yaml:"http_config"`
 	EndpointsConfig  EndpointsConfig `yaml:",inline"`
 	Timeout          model.Duration  `yaml:"timeout"`
 	APIVersion       APIVersion      `yaml:"api_version"`
+	// Maximum time spent on each endpoint for a batch, including waiting for a concurrency slot and
+	// all the requests of a split batch, so a hung endpoint can't delay the batch for longer. 0 means no limit.
+	EndpointTimeout model.Duration `yaml:"endpoint_timeout"`
+	// Custom HTTP headers added to the requests to the alertmanager, e.g. X-Scope-OrgID.
+	Headers map[string]string `yaml:"headers"`
+	// Label carrying the tenant of an alert, alerts are posted per tenant with the X-Scope-OrgID header.
+	TenantLabel string `yaml:"tenant_label"`
+	// Tenant of the alerts without the tenant label.
+	DefaultTenant string `yaml:"default_tenant"`
+	// Whether to forward resolved alerts to the alertmanager, defaults to true.
+	ForwardResolved *bool `yaml:"forward_resolved"`
+	// Annotations added to the alerts posted to the alertmanager, rendered with Go templates executed
+	// with the template.Alert, e.g. a dashboard URL built from the labels. The functions of TemplateFuncs
+	// are available. An annotation is skipped if its template fails, e.g. references a missing label.
+	AnnotationTemplates map[string]string `yaml:"annotation_templates"`
+	// Circuit breaker applied to each endpoint of the alertmanager.
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// Priority of the alertmanager, the alerts are sent to the alertmanagers of the lowest priority value
+	// and only to the alertmanagers of the next priority if they all failed. Defaults to 0.
+	Priority int `yaml:"priority"`
+	// Maximum number of alerts posted in a single request, larger batches are split into several requests.
+	// 0 means no limit.
+	MaxAlertsPerRequest int `yaml:"max_alerts_per_request"`
+	// Cluster marks the endpoints as members of an alertmanager cluster gossiping the alerts,
+	// the alerts are sent to a single member and only to the next member if it failed.
+	Cluster bool `yaml:"cluster"`
+	// Use HTTP/2, negotiated over TLS for https and with prior knowledge (h2c) for http.
+	// The proxy settings don't apply to h2c connections.
+	HTTP2 bool `yaml:"http2"`
+	// Mirror receives a copy of the alerts, its failures never fail the forwarding and are logged separately.
+	Mirror bool `yaml:"mirror"`
+	// Critical marks the alertmanager as required for the readiness of the alerts collector.
+	Critical bool `yaml:"critical"`
+	// Time a critical alertmanager may keep failing before the alerts collector reports not ready.
+	UnhealthyAfter model.Duration `yaml:"unhealthy_after"`
+	// Interval the endpoints are probed at with GET requests to the health check path, the probes update
+	// the upstream metrics and the readiness of critical alertmanagers. 0 disables the health checks.
+	HealthCheckInterval model.Duration `yaml:"health_check_interval"`
+	// Path probed by the health checks, e.g. /-/ready or /api/v2/status, defaults to /-/healthy.
+	HealthCheckPath string `yaml:"health_check_path"`
+	// PagerDuty Events API v2 integration the alerts are sent to instead of alertmanager endpoints, the entry
+	// is forwarded to like a pagerduty receiver of the same name and the other options don't apply.
+	PagerDuty *PagerDutyConfig `yaml:"pagerduty"`
 }
 
 // ClientConfig configures an HTTP client.
@@ -38,12 +202,47 @@ type ClientConfig struct {
 	BasicAuth BasicAuth `yaml:"basic_auth"`
 	// The bearer token for the targets.
 	BearerToken string `yaml:"bearer_token"`
-	// The bearer token file for the targets.
+	// The bearer token file for the targets, the file is read for every request so
+	// rotated tokens, e.g. projected service account tokens, are picked up.
 	BearerTokenFile string `yaml:"bearer_token_file"`
 	// HTTP proxy server to use to connect to the targets.
 	ProxyURL string `yaml:"proxy_url"`
+	// Use the proxy configured by the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+	// if proxy_url is not set. The variables are read when the configuration is loaded.
+	ProxyFromEnvironment bool `yaml:"proxy_from_environment"`
 	// TLSConfig to use to connect to the targets.
 	TLSConfig TLSConfig `yaml:"tls_config"`
+	// OAuth2 client credentials used to fetch the access token for the targets.
+	OAuth2 *OAuth2 `yaml:"oauth2"`
+	// Token exchange providing the token for the targets, e.g. behind an SSO proxy.
+	TokenExchange *TokenExchangeConfig `yaml:"token_exchange"`
+	// Maximum number of idle connections across all the targets, defaults to 20000.
+	MaxIdleConns int `yaml:"max_idle_conns"`
+	// Maximum number of idle connections to each target, defaults to 1000.
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// Time an idle connection is kept open, defaults to 5m.
+	IdleConnTimeout model.Duration `yaml:"idle_conn_timeout"`
+
+	// http2 forces HTTP/2, set by the alertmanager config
+	http2 bool
+}
+
+// authMethods returns the number of configured authentication methods
+func (c ClientConfig) authMethods() int {
+	var n int
+	for _, set := range []bool{!c.BasicAuth.IsZero(), c.BearerToken != "", c.BearerTokenFile != "", c.OAuth2 != nil, c.TokenExchange != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// tunesTransport reports whether the client config sets transport options
+// the prometheus client config doesn't support
+func (c ClientConfig) tunesTransport() bool {
+	return (c.ProxyFromEnvironment && c.ProxyURL == "") || c.MaxIdleConns > 0 || c.MaxIdleConnsPerHost > 0 || c.IdleConnTimeout > 0 ||
+		len(c.TLSConfig.CertPins) > 0 || len(c.TLSConfig.AllowedSANs) > 0 || c.http2
 }
 
 // TLSConfig configures TLS connections.
@@ -58,12 +257,23 @@ type TLSConfig struct {
 	ServerName string `yaml:"server_name"`
 	// Disable target certificate validation.
 	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+	// SHA-256 fingerprints of the certificates in hex, the certificate chain of the target must contain one of them.
+	CertPins []string `yaml:"cert_pins"`
+	// DNS names and IP addresses, the certificate of the target must have one of them as subject alternative name.
+	AllowedSANs []string `yaml:"allowed_sans"`
+}
+
+// isZero reports whether no TLS option is set
+func (c TLSConfig) isZero() bool {
+	return c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && c.ServerName == "" && !c.InsecureSkipVerify &&
+		len(c.CertPins) == 0 && len(c.AllowedSANs) == 0
 }
 
 // BasicAuth configures basic authentication for HTTP clients.
 type BasicAuth struct {
-	Username     string `yaml:"username"`
-	Password     string `yaml:"password"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// The password file is read for every request so rotated secrets are picked up.
 	PasswordFile string `yaml:"password_file"`
 }
 
@@ -72,33 +282,418 @@ func (b BasicAuth) IsZero() bool {
 	return b.Username == "" && b.Password == "" && b.PasswordFile == ""
 }
 
+// OAuth2 configures the OAuth2 client credentials flow for HTTP clients.
+type OAuth2 struct {
+	ClientID         string            `yaml:"client_id"`
+	ClientSecret     string            `yaml:"client_secret"`
+	ClientSecretFile string            `yaml:"client_secret_file"`
+	TokenURL         string            `yaml:"token_url"`
+	Scopes           []string          `yaml:"scopes"`
+	EndpointParams   map[string]string `yaml:"endpoint_params"`
+}
+
+// roundTripper returns a round tripper adding the access token to the requests,
+// the token is fetched with the base round tripper and refreshed once it expires
+func (o *OAuth2) roundTripper(base http.RoundTripper) (http.RoundTripper, error) {
+	if o.ClientID == "" || o.TokenURL == "" {
+		return nil, fmt.Errorf("oauth2 requires client_id and token_url")
+	}
+	secret := o.ClientSecret
+	if o.ClientSecretFile != "" {
+		if secret != "" {
+			return nil, fmt.Errorf("at most one of oauth2 client_secret and client_secret_file must be configured")
+		}
+		b, err := ioutil.ReadFile(o.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oauth2 client secret file %s: %v", o.ClientSecretFile, err)
+		}
+		secret = strings.TrimSpace(string(b))
+	}
+
+	params := url.Values{}
+	for k, v := range o.EndpointParams {
+		params.Set(k, v)
+	}
+	cfg := &clientcredentials.Config{
+		ClientID:       o.ClientID,
+		ClientSecret:   secret,
+		TokenURL:       o.TokenURL,
+		Scopes:         o.Scopes,
+		EndpointParams: params,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: base})
+	return &oauth2.Transport{Source: cfg.TokenSource(ctx), Base: base}, nil
+}
+
 // EndpointsConfig configures a cluster of HTTP endpoints from static addresses and
 // file service discovery.
 type EndpointsConfig struct {
 	// List of addresses with DNS prefixes.
 	StaticAddresses []string `yaml:"static_configs"`
 
-	// The URL scheme to use when talking to targets.
+	// Kubernetes services whose endpoints are discovered as addresses.
+	KubernetesSDConfigs []KubernetesSDConfig `yaml:"kubernetes_sd_configs"`
+
+	// The URL scheme to use when talking to targets, defaults to https if a TLS config is set, otherwise to http.
 	Scheme string `yaml:"scheme"`
 
 	// Path prefix to add in front of the endpoint path.
 	PathPrefix string `yaml:"path_prefix"`
 }
 
-// loadAlertingConfig loads configuraration about upstream alertmanagers from YAML format file
-func loadAlertingConfig(configFile string) (*AlertingConfig, error) {
-	configYAML, err := ioutil.ReadFile(configFile)
+// loadAlertingConfig loads configuraration about upstream alertmanagers from YAML format file,
+// or from the *.yaml files of a directory merged with mergeAlertingConfigs. The ${VAR} references
+// are expanded with the environment, undefined variables fail the loading in strict mode.
+func loadAlertingConfig(configFile string, strictEnv bool) (*AlertingConfig, error) {
+	info, err := os.Stat(configFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load configurations from file %s: %v", configFile, err)
 	}
+	files := []string{configFile}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(configFile, "*.yaml")); err != nil {
+			return nil, fmt.Errorf("failed to list configuration files in directory %s: %v", configFile, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no *.yaml configuration files in directory %s", configFile)
+		}
+	}
 
-	alertingCfg := &AlertingConfig{}
-	if err := yaml.UnmarshalStrict(configYAML, alertingCfg); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal configurations: %v", err)
+	cfgs := make([]*AlertingConfig, 0, len(files))
+	positions := make(configPositions)
+	var numAlertmanagers int
+	for _, file := range files {
+		configYAML, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configurations from file %s: %v", file, err)
+		}
+		if configYAML, err = expandEnv(configYAML, strictEnv); err != nil {
+			return nil, fmt.Errorf("failed to expand configurations from file %s: %v", file, err)
+		}
+		cfg := &AlertingConfig{}
+		if err := yaml.UnmarshalStrict(configYAML, cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal configurations from file %s: %v", file, err)
+		}
+		// the alertmanagers of the files are concatenated by mergeAlertingConfigs
+		positions.add(file, configYAML, numAlertmanagers)
+		numAlertmanagers += len(cfg.Alertmanagers)
+		cfgs = append(cfgs, cfg)
+	}
+	alertingCfg, err := mergeAlertingConfigs(files, cfgs)
+	if err != nil {
+		return nil, err
+	}
+	if err := alertingCfg.validate(positions); err != nil {
+		return nil, fmt.Errorf("invalid configurations: %v", err)
 	}
 	return alertingCfg, nil
 }
 
+// envRefRegexp matches the ${VAR} environment variable references and the escaped $${VAR} literals
+var envRefRegexp = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${VAR} references with the value of the environment variables and the
+// $${VAR} literals with ${VAR}, undefined variables expand to the empty value or are an error if strict
+func expandEnv(b []byte, strict bool) ([]byte, error) {
+	undefined := make(map[string]bool)
+	expanded := envRefRegexp.ReplaceAllFunc(b, func(ref []byte) []byte {
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+		name := string(envRefRegexp.FindSubmatch(ref)[1])
+		value, found := os.LookupEnv(name)
+		if !found {
+			undefined[name] = true
+		}
+		return []byte(value)
+	})
+	if strict && len(undefined) > 0 {
+		names := make([]string, 0, len(undefined))
+		for name := range undefined {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("undefined environment variables: %s", strings.Join(names, ", "))
+	}
+	return expanded, nil
+}
+
+// mergeAlertingConfigs concatenates the alertmanagers of the configurations of the files, the names of
+// the alertmanagers must be unique and the other settings can only be set in one of the files
+func mergeAlertingConfigs(files []string, cfgs []*AlertingConfig) (*AlertingConfig, error) {
+	if len(cfgs) == 1 {
+		return cfgs[0], nil
+	}
+
+	var (
+		merged        = &AlertingConfig{}
+		baseFile      string
+		amFiles       = make(map[string]string) // alertmanager name -> file
+		alertmanagers []AlertmanagerConfig
+	)
+	for i, cfg := range cfgs {
+		for _, am := range cfg.Alertmanagers {
+			if am.Name != "" {
+				if file, found := amFiles[am.Name]; found {
+					return nil, fmt.Errorf("duplicate alertmanager name %q in files %s and %s", am.Name, file, files[i])
+				}
+				amFiles[am.Name] = files[i]
+			}
+		}
+		alertmanagers = append(alertmanagers, cfg.Alertmanagers...)
+
+		cfg.Alertmanagers = nil
+		if reflect.DeepEqual(*cfg, AlertingConfig{}) {
+			continue
+		}
+		if baseFile != "" {
+			return nil, fmt.Errorf("settings other than alertmanagers are set in files %s and %s, they can only be set in one file", baseFile, files[i])
+		}
+		merged, baseFile = cfg, files[i]
+	}
+	merged.Alertmanagers = alertmanagers
+	return merged, nil
+}
+
+// validate checks the semantics of the configuration and sets the defaults of the alertmanagers,
+// all the errors are reported together with the file and line of the invalid field if it is known
+func (c *AlertingConfig) validate(positions configPositions) error {
+	errs := configErrors{positions: positions}
+	for i := range c.Alertmanagers {
+		c.Alertmanagers[i].validate(fmt.Sprintf("alertmanagers[%d]", i), &errs)
+	}
+	for i, r := range c.Receivers {
+		r.validate(fmt.Sprintf("receivers[%d]", i), &errs)
+	}
+	c.Alertmanagers, c.Receivers = pagerDutyAsReceivers(c.Alertmanagers, c.Receivers)
+	for i := range c.RoutingGroups {
+		g := &c.RoutingGroups[i]
+		for j := range g.Alertmanagers {
+			g.Alertmanagers[j].validate(fmt.Sprintf("routing_groups[%d].alertmanagers[%d]", i, j), &errs)
+		}
+		for j, r := range g.Receivers {
+			r.validate(fmt.Sprintf("routing_groups[%d].receivers[%d]", i, j), &errs)
+		}
+		g.Alertmanagers, g.Receivers = pagerDutyAsReceivers(g.Alertmanagers, g.Receivers)
+	}
+	for i, sched := range c.Schedules {
+		if _, err := newSchedule(sched); err != nil {
+			errs.add(fmt.Sprintf("schedules[%d]", i), "%v", err)
+		}
+	}
+	for i, rule := range c.InhibitRules {
+		field := fmt.Sprintf("inhibit_rules[%d]", i)
+		if _, err := newMatchers(rule.SourceMatchers); err != nil {
+			errs.add(field, "source_matchers: %v", err)
+		}
+		if _, err := newMatchers(rule.TargetMatchers); err != nil {
+			errs.add(field, "target_matchers: %v", err)
+		}
+	}
+	switch c.RateLimitOverflow {
+	case "", overflowDrop, overflowBuffer:
+	default:
+		errs.add("rate_limit_overflow", "must be %s or %s, got %q", overflowDrop, overflowBuffer, c.RateLimitOverflow)
+	}
+	return errs.err()
+}
+
+// configErrors are the errors found validating the configuration
+type configErrors struct {
+	positions configPositions
+	errs      []string
+}
+
+// add adds the error of the field, prefixed with the position of the field if it is known
+func (errs *configErrors) add(field, format string, args ...interface{}) {
+	msg := field + ": " + fmt.Sprintf(format, args...)
+	// the name of the alertmanager may follow the path of the field, e.g. alertmanagers[0] (a)
+	if pos, found := errs.positions[strings.SplitN(field, " ", 2)[0]]; found {
+		msg = pos + ": " + msg
+	}
+	errs.errs = append(errs.errs, msg)
+}
+
+// err returns the errors as a single error, nil if there are none
+func (errs configErrors) err() error {
+	switch len(errs.errs) {
+	case 0:
+		return nil
+	case 1:
+		return errors.New(errs.errs[0])
+	}
+	return fmt.Errorf("%d errors:\n  %s", len(errs.errs), strings.Join(errs.errs, "\n  "))
+}
+
+// configPositions are the file:line positions of the fields of the configuration by path, e.g. alertmanagers[0]
+type configPositions map[string]string
+
+// add records the positions of the fields of the YAML configuration of the file, the indexes of its
+// alertmanagers are shifted by the number of alertmanagers of the previous files
+func (p configPositions) add(file string, b []byte, alertmanagersOffset int) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(b, &doc); err != nil || len(doc.Content) == 0 {
+		// the positions only decorate the errors
+		return
+	}
+	p.walk(file, doc.Content[0], "", alertmanagersOffset)
+}
+
+// walk records the positions of the node and its children under the path
+func (p configPositions) walk(file string, n *yamlv3.Node, path string, alertmanagersOffset int) {
+	switch n.Kind {
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := n.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			p[key] = fmt.Sprintf("%s:%d", file, n.Content[i].Line)
+			p.walk(file, n.Content[i+1], key, alertmanagersOffset)
+		}
+	case yamlv3.SequenceNode:
+		offset := 0
+		if path == "alertmanagers" {
+			offset = alertmanagersOffset
+		}
+		for i, item := range n.Content {
+			key := fmt.Sprintf("%s[%d]", path, i+offset)
+			p[key] = fmt.Sprintf("%s:%d", file, item.Line)
+			p.walk(file, item, key, alertmanagersOffset)
+		}
+	}
+}
+
+// defaultScheme returns the scheme used if none is configured, https if a TLS config is set
+func (c *AlertmanagerConfig) defaultScheme() string {
+	if !c.HTTPClientConfig.TLSConfig.isZero() {
+		return "https"
+	}
+	return "http"
+}
+
+// pagerDutyAsReceivers moves the pagerduty entries of the alertmanagers to the receivers
+func pagerDutyAsReceivers(alertmanagers []AlertmanagerConfig, receivers []ReceiverConfig) ([]AlertmanagerConfig, []ReceiverConfig) {
+	var kept []AlertmanagerConfig
+	for _, am := range alertmanagers {
+		if am.PagerDuty == nil {
+			kept = append(kept, am)
+			continue
+		}
+		receivers = append(receivers, ReceiverConfig{Name: am.Name, PagerDuty: am.PagerDuty})
+	}
+	return kept, receivers
+}
+
+// validate checks the alertmanager configuration at the given path and sets its defaults,
+// the errors are added to errs
+func (c *AlertmanagerConfig) validate(field string, errs *configErrors) {
+	if c.PagerDuty != nil {
+		c.validatePagerDuty(field, errs)
+		return
+	}
+	if c.Name != "" {
+		field = fmt.Sprintf("%s (%s)", field, c.Name)
+	}
+	switch c.EndpointsConfig.Scheme {
+	case "":
+		c.EndpointsConfig.Scheme = c.defaultScheme()
+	case "http", "https":
+	default:
+		errs.add(field, "scheme must be http or https, got %q", c.EndpointsConfig.Scheme)
+	}
+	switch c.APIVersion {
+	case "":
+		c.APIVersion = APIv1
+	case APIv1, APIv2:
+	default:
+		errs.add(field, "api_version must be %s or %s, got %q", APIv1, APIv2, c.APIVersion)
+	}
+	if c.Timeout < 0 {
+		errs.add(field, "timeout must be positive, got %s", c.Timeout)
+	}
+	if c.EndpointTimeout < 0 {
+		errs.add(field, "endpoint_timeout must be positive, got %s", c.EndpointTimeout)
+	}
+	if c.HealthCheckInterval < 0 {
+		errs.add(field, "health_check_interval must be positive, got %s", c.HealthCheckInterval)
+	}
+	if c.MaxAlertsPerRequest < 0 {
+		errs.add(field, "max_alerts_per_request must be positive, got %d", c.MaxAlertsPerRequest)
+	}
+	if len(c.EndpointsConfig.StaticAddresses) == 0 && len(c.EndpointsConfig.KubernetesSDConfigs) == 0 {
+		errs.add(field, "static_configs or kubernetes_sd_configs must be set")
+	}
+	for _, addr := range c.EndpointsConfig.StaticAddresses {
+		if _, err := normalizeAddress(addr); err != nil {
+			errs.add(field, "static_configs: %v", err)
+		}
+	}
+	for i, sd := range c.EndpointsConfig.KubernetesSDConfigs {
+		if sd.Namespace == "" || sd.Service == "" {
+			errs.add(field, "kubernetes_sd_configs[%d] requires namespace and service", i)
+		}
+	}
+	if c.HTTPClientConfig.authMethods() > 1 {
+		errs.add(field, "at most one of basic_auth, bearer_token, bearer_token_file, oauth2 and token_exchange must be configured")
+	}
+}
+
+// validatePagerDuty checks the configuration of a pagerduty entry of the alertmanagers, which needs
+// a name like the receivers and can't have endpoints
+func (c *AlertmanagerConfig) validatePagerDuty(field string, errs *configErrors) {
+	if c.Name == "" {
+		errs.add(field, "pagerduty requires a name")
+		return
+	}
+	field = fmt.Sprintf("%s (%s)", field, c.Name)
+	if len(c.EndpointsConfig.StaticAddresses) > 0 || len(c.EndpointsConfig.KubernetesSDConfigs) > 0 {
+		errs.add(field, "pagerduty can't be set with static_configs or kubernetes_sd_configs")
+	}
+	if c.PagerDuty.RoutingKey == "" && c.PagerDuty.RoutingKeyFile == "" {
+		errs.add(field, "pagerduty requires routing_key or routing_key_file")
+	}
+}
+
+// validate checks the receiver configuration at the given path, the errors are added to errs
+func (c ReceiverConfig) validate(field string, errs *configErrors) {
+	if c.Name == "" {
+		errs.add(field, "missing receiver name")
+	} else {
+		field = fmt.Sprintf("%s (%s)", field, c.Name)
+	}
+	var types int
+	if c.PagerDuty != nil {
+		types++
+		if c.PagerDuty.RoutingKey == "" && c.PagerDuty.RoutingKeyFile == "" {
+			errs.add(field, "pagerduty requires routing_key or routing_key_file")
+		}
+	}
+	if c.Webhook != nil {
+		types++
+		if c.Webhook.URL == "" {
+			errs.add(field, "webhook requires url")
+		}
+	}
+	if c.OTLP != nil {
+		types++
+	}
+	if c.Kafka != nil {
+		types++
+		if len(c.Kafka.Brokers) == 0 || c.Kafka.Topic == "" {
+			errs.add(field, "kafka requires brokers and topic")
+		}
+		switch c.Kafka.OverflowPolicy {
+		case "", kafkaOverflowDrop, kafkaOverflowBlock:
+		default:
+			errs.add(field, "kafka overflow_policy must be %s or %s, got %q", kafkaOverflowDrop, kafkaOverflowBlock, c.Kafka.OverflowPolicy)
+		}
+	}
+	if types != 1 {
+		errs.add(field, "exactly one of pagerduty, webhook, otlp and kafka must be set")
+	}
+}
+
 // createHTTPClient returns a new HTTP client based on alertmanager configuration
 func createHTTPClient(clientCfg ClientConfig, name string) (*http.Client, error) {
 	httpClientConfig := config.HTTPClientConfig{
@@ -130,10 +725,93 @@ func createHTTPClient(clientCfg ClientConfig, name string) (*http.Client, error)
 	if err := httpClientConfig.Validate(); err != nil {
 		return nil, err
 	}
+	if clientCfg.authMethods() > 1 {
+		return nil, fmt.Errorf("at most one of basic_auth, bearer_token, bearer_token_file, oauth2 and token_exchange must be configured")
+	}
 
-	client, err := config.NewClientFromConfig(httpClientConfig, name, false, false)
+	var (
+		client *http.Client
+		err    error
+	)
+	if clientCfg.tunesTransport() {
+		client, err = newTunedClient(httpClientConfig, clientCfg)
+	} else {
+		client, err = config.NewClientFromConfig(httpClientConfig, name, false, false)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if clientCfg.OAuth2 != nil {
+		if client.Transport, err = clientCfg.OAuth2.roundTripper(client.Transport); err != nil {
+			return nil, err
+		}
+	}
+	if clientCfg.TokenExchange != nil {
+		src, err := clientCfg.TokenExchange.tokenSource(client.Transport)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = &oauth2.Transport{Source: src, Base: client.Transport}
+	}
 	return client, nil
 }
+
+// newTunedClient returns a new HTTP client with the proxy from the environment and the connection pool options,
+// the prometheus client config doesn't support them so the transport is built here
+func newTunedClient(cfg config.HTTPClientConfig, clientCfg ClientConfig) (*http.Client, error) {
+	tlsConfig, err := config.NewTLSConfig(&cfg.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig.VerifyPeerCertificate, err = clientCfg.TLSConfig.peerVerifier(); err != nil {
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyURL(cfg.ProxyURL.URL),
+		MaxIdleConns:          20000,
+		MaxIdleConnsPerHost:   1000,
+		TLSClientConfig:       tlsConfig,
+		DisableCompression:    true,
+		IdleConnTimeout:       5 * time.Minute,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if clientCfg.ProxyFromEnvironment && clientCfg.ProxyURL == "" {
+		// unlike http.ProxyFromEnvironment, the variables are read again on each configuration load
+		proxy := httpproxy.FromEnvironment().ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) { return proxy(req.URL) }
+	}
+	if clientCfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = clientCfg.MaxIdleConns
+	}
+	if clientCfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = clientCfg.MaxIdleConnsPerHost
+	}
+	if clientCfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = time.Duration(clientCfg.IdleConnTimeout)
+	}
+
+	var rt http.RoundTripper = transport
+	if clientCfg.http2 {
+		if rt, err = newHTTP2RoundTripper(transport); err != nil {
+			return nil, err
+		}
+	}
+	// Validate moves the bearer token and bearer token file to the authorization
+	if auth := cfg.Authorization; auth != nil && len(auth.Credentials) > 0 {
+		rt = config.NewAuthorizationCredentialsRoundTripper(auth.Type, auth.Credentials, rt)
+	} else if auth != nil && len(auth.CredentialsFile) > 0 {
+		rt = config.NewAuthorizationCredentialsFileRoundTripper(auth.Type, auth.CredentialsFile, rt)
+	}
+	if cfg.BasicAuth != nil {
+		rt = config.NewBasicAuthRoundTripper(cfg.BasicAuth.Username, cfg.BasicAuth.Password, cfg.BasicAuth.PasswordFile, rt)
+	}
+
+	return &http.Client{
+		Transport: rt,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}, nil
+}
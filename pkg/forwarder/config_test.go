@@ -0,0 +1,540 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("ALERTS_COLLECTOR_HOST", "am.example.com")
+	t.Setenv("ALERTS_COLLECTOR_EMPTY", "")
+	tests := []struct {
+		name    string
+		in      string
+		strict  bool
+		want    string
+		wantErr bool
+	}{
+		{name: "defined variable", in: "host: ${ALERTS_COLLECTOR_HOST}:9093", want: "host: am.example.com:9093"},
+		{name: "empty variable in strict mode", in: "v: '${ALERTS_COLLECTOR_EMPTY}'", strict: true, want: "v: ''"},
+		{name: "undefined variable", in: "v: '${ALERTS_COLLECTOR_UNDEFINED}'", want: "v: ''"},
+		{name: "undefined variable in strict mode", in: "v: ${ALERTS_COLLECTOR_UNDEFINED}", strict: true, wantErr: true},
+		{name: "escaped reference", in: "v: $${ALERTS_COLLECTOR_HOST}", strict: true, want: "v: ${ALERTS_COLLECTOR_HOST}"},
+		{name: "unbraced reference is kept", in: "v: $ALERTS_COLLECTOR_HOST", want: "v: $ALERTS_COLLECTOR_HOST"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := expandEnv([]byte(tc.in), tc.strict)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expandEnv() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && string(got) != tc.want {
+				t.Errorf("expandEnv() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadAlertingConfig(t *testing.T) {
+	tests := []struct {
+		name              string
+		files             map[string]string
+		wantErr           string
+		wantAlertmanagers int
+	}{
+		{
+			name:              "defaults",
+			files:             map[string]string{"a.yaml": "alertmanagers:\n- static_configs: [am:9093]\n"},
+			wantAlertmanagers: 1,
+		},
+		{
+			name:    "invalid scheme",
+			files:   map[string]string{"a.yaml": "alertmanagers:\n- name: a\n  scheme: ftp\n  static_configs: [am:9093]\n"},
+			wantErr: `alertmanagers[0] (a): scheme must be http or https, got "ftp"`,
+		},
+		{
+			name:    "all the errors are reported",
+			files:   map[string]string{"a.yaml": "alertmanagers:\n- api_version: v3\n- static_configs: [am:9093]\n  max_alerts_per_request: -1\n"},
+			wantErr: "3 errors",
+		},
+		{
+			name: "several authorizations",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- static_configs: [am:9093]
+  http_config:
+    bearer_token: token
+    basic_auth: {username: user, password: pass}
+`},
+			wantErr: "at most one of",
+		},
+		{
+			name:    "invalid api_version",
+			files:   map[string]string{"a.yaml": "alertmanagers:\n- api_version: v3\n  static_configs: [am:9093]\n"},
+			wantErr: `alertmanagers[0]: api_version must be v1 or v2, got "v3"`,
+		},
+		{
+			name:    "no endpoint",
+			files:   map[string]string{"a.yaml": "alertmanagers:\n- name: a\n"},
+			wantErr: "alertmanagers[0] (a): static_configs or kubernetes_sd_configs must be set",
+		},
+		{
+			name:    "invalid routing group alertmanager",
+			files:   map[string]string{"a.yaml": "routing_groups:\n- name: g\n  alertmanagers:\n  - scheme: ftp\n    static_configs: [am:9093]\n"},
+			wantErr: "routing_groups[0].alertmanagers[0]: scheme must be http or https",
+		},
+		{
+			name: "kubernetes service discovery without service",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- kubernetes_sd_configs: [{namespace: monitoring}]
+`},
+			wantErr: "kubernetes_sd_configs[0] requires namespace and service",
+		},
+		{
+			name: "directory",
+			files: map[string]string{
+				"a.yaml": "alertmanagers:\n- name: a\n  static_configs: [a:9093]\n",
+				"b.yaml": "alertmanagers:\n- name: b\n  static_configs: [b:9093]\n",
+				"c.txt":  "ignored",
+			},
+			wantAlertmanagers: 2,
+		},
+		{
+			name: "duplicate alertmanager name",
+			files: map[string]string{
+				"a.yaml": "alertmanagers:\n- name: a\n  static_configs: [a:9093]\n",
+				"b.yaml": "alertmanagers:\n- name: a\n  static_configs: [b:9093]\n",
+			},
+			wantErr: `duplicate alertmanager name "a"`,
+		},
+		{
+			name: "settings in several files",
+			files: map[string]string{
+				"a.yaml": "allow_empty: true\n",
+				"b.yaml": "allow_empty: true\n",
+			},
+			wantErr: "can only be set in one file",
+		},
+		{
+			name:    "line of the invalid alertmanager",
+			files:   map[string]string{"a.yaml": "alertmanagers:\n- static_configs: [am:9093]\n- name: b\n  scheme: ftp\n  static_configs: [am:9093]\n"},
+			wantErr: `a.yaml:3: alertmanagers[1] (b): scheme must be http or https`,
+		},
+		{
+			name: "line of the invalid alertmanager of a directory",
+			files: map[string]string{
+				"a.yaml": "alertmanagers:\n- name: a\n  static_configs: [a:9093]\n",
+				"b.yaml": "\nalertmanagers:\n- name: b\n  api_version: v3\n  static_configs: [b:9093]\n",
+			},
+			wantErr: `b.yaml:3: alertmanagers[1] (b): api_version must be v1 or v2`,
+		},
+		{
+			name: "invalid receivers",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- static_configs: [am:9093]
+receivers:
+- name: hook
+  webhook: {}
+- name: none
+- webhook: {url: http://hook}
+- name: queue
+  kafka: {brokers: [kafka:9092], topic: alerts, overflow_policy: wait}
+`},
+			wantErr: `4 errors:
+  a.yaml:4: receivers[0] (hook): webhook requires url
+  a.yaml:6: receivers[1] (none): exactly one of pagerduty, webhook, otlp and kafka must be set
+  a.yaml:7: receivers[2]: missing receiver name
+  a.yaml:8: receivers[3] (queue): kafka overflow_policy must be drop or block, got "wait"`,
+		},
+		{
+			name: "invalid routing group receiver",
+			files: map[string]string{"a.yaml": `routing_groups:
+- name: g
+  receivers:
+  - name: pd
+    pagerduty: {}
+`},
+			wantErr: "a.yaml:4: routing_groups[0].receivers[0] (pd): pagerduty requires routing_key or routing_key_file",
+		},
+		{
+			name: "pagerduty alertmanager",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- static_configs: [am:9093]
+- name: oncall
+  pagerduty: {routing_key: key}
+`},
+			wantAlertmanagers: 1,
+		},
+		{
+			name: "invalid pagerduty alertmanagers",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- pagerduty: {routing_key: key}
+- name: oncall
+  static_configs: [am:9093]
+  pagerduty: {}
+`},
+			wantErr: `3 errors:
+  a.yaml:2: alertmanagers[0]: pagerduty requires a name
+  a.yaml:3: alertmanagers[1] (oncall): pagerduty can't be set with static_configs or kubernetes_sd_configs
+  a.yaml:3: alertmanagers[1] (oncall): pagerduty requires routing_key or routing_key_file`,
+		},
+		{
+			name: "invalid schedule, inhibit rule and rate limit overflow",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- static_configs: [am:9093]
+rate_limit_overflow: queue
+schedules:
+- days: [someday]
+inhibit_rules:
+- source_matchers: [{name: severity, value: critical}]
+  target_matchers: [{name: severity, value: "(", regex: true}]
+`},
+			wantErr: "3 errors",
+		},
+		{
+			name: "lines of the schedule, inhibit rule and rate limit overflow",
+			files: map[string]string{"a.yaml": `alertmanagers:
+- static_configs: [am:9093]
+rate_limit_overflow: queue
+schedules:
+- timezone: Nowhere/Else
+inhibit_rules:
+- target_matchers: [{value: warning}]
+`},
+			wantErr: `3 errors:
+  a.yaml:5: schedules[0]: invalid timezone "Nowhere/Else": unknown time zone Nowhere/Else
+  a.yaml:7: inhibit_rules[0]: target_matchers: missing label name in matcher
+  a.yaml:3: rate_limit_overflow: must be drop or buffer, got "queue"`,
+		},
+		{
+			name:    "unknown field",
+			files:   map[string]string{"a.yaml": "alertmanager: []\n"},
+			wantErr: "failed to unmarshal",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tc.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			path := dir
+			if len(tc.files) == 1 {
+				path = filepath.Join(dir, "a.yaml")
+			}
+			cfg, err := loadAlertingConfig(path, false)
+			if tc.wantErr != "" {
+				// the errors are positioned relatively to the directory of the files
+				if err == nil || !strings.Contains(strings.ReplaceAll(err.Error(), dir+string(filepath.Separator), ""), tc.wantErr) {
+					t.Fatalf("loadAlertingConfig() error = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadAlertingConfig() = %v", err)
+			}
+			if len(cfg.Alertmanagers) != tc.wantAlertmanagers {
+				t.Fatalf("loaded %d alertmanagers, want %d", len(cfg.Alertmanagers), tc.wantAlertmanagers)
+			}
+			for _, am := range cfg.Alertmanagers {
+				if am.EndpointsConfig.Scheme != "http" || am.APIVersion != APIv1 {
+					t.Errorf("scheme %q and api_version %q, want the defaults", am.EndpointsConfig.Scheme, am.APIVersion)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadAlertingConfigStrictEnv(t *testing.T) {
+	path := writeFile(t, "a.yaml", "alertmanagers:\n- static_configs: [${ALERTS_COLLECTOR_UNDEFINED}]\n")
+	os.Unsetenv("ALERTS_COLLECTOR_UNDEFINED")
+	if _, err := loadAlertingConfig(path, true); err == nil || !strings.Contains(err.Error(), "ALERTS_COLLECTOR_UNDEFINED") {
+		t.Errorf("loadAlertingConfig() error = %v, want the undefined variable", err)
+	}
+}
+
+// authorizations returns a started server recording the Authorization header of the requests
+func authorizations(t *testing.T) (*httptest.Server, func() []string) {
+	t.Helper()
+	var headers []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(s.Close)
+	return s, func() []string { return headers }
+}
+
+// getTwice sends two requests with the client, calling between after the first one
+func getTwice(t *testing.T, client *http.Client, url string, between func()) {
+	t.Helper()
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("request #%d failed: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if i == 0 {
+			between()
+		}
+	}
+}
+
+func TestBearerTokenFileRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ClientConfig
+	}{
+		{name: "prometheus client"},
+		{name: "tuned transport", cfg: ClientConfig{MaxIdleConns: 10}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, headers := authorizations(t)
+			tokenFile := writeFile(t, "token", "first\n")
+			tc.cfg.BearerTokenFile = tokenFile
+			client, err := createHTTPClient(tc.cfg, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			getTwice(t, client, server.URL, func() {
+				if err := ioutil.WriteFile(tokenFile, []byte("rotated\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			})
+			got := headers()
+			if len(got) != 2 || got[0] != "Bearer first" || got[1] != "Bearer rotated" {
+				t.Errorf("Authorization headers = %q, want the first then the rotated token", got)
+			}
+		})
+	}
+}
+
+func TestPasswordFileRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ClientConfig
+	}{
+		{name: "prometheus client"},
+		{name: "tuned transport", cfg: ClientConfig{MaxIdleConns: 10}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, headers := authorizations(t)
+			passwordFile := writeFile(t, "password", "first\n")
+			tc.cfg.BasicAuth = BasicAuth{Username: "user", PasswordFile: passwordFile}
+			client, err := createHTTPClient(tc.cfg, "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			getTwice(t, client, server.URL, func() {
+				if err := ioutil.WriteFile(passwordFile, []byte("rotated\n"), 0600); err != nil {
+					t.Fatal(err)
+				}
+			})
+			want := []string{basicAuth("user", "first"), basicAuth("user", "rotated")}
+			if got := headers(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Authorization headers = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// basicAuth returns the Authorization header of the basic auth credentials
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func TestOAuth2ClientCredentials(t *testing.T) {
+	tokenServer, forms := newTestTokenEndpoint(t, http.StatusOK, tokenExchangeResponse{AccessToken: "oauth-token", TokenType: "Bearer", ExpiresIn: 3600})
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+  http_config:
+    oauth2:
+      client_id: collector
+      client_secret_file: `+writeFile(t, "secret", "secret\n")+`
+      token_url: `+tokenServer.URL+`
+      scopes: [alerts]
+      endpoint_params: {audience: alertmanager}
+`)
+	for i := 0; i < 2; i++ {
+		if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+			t.Fatalf("Forward() #%d = %v, want nil", i+1, err)
+		}
+	}
+
+	upstream.mtx.Lock()
+	for i, r := range upstream.requests {
+		if got := r.Header.Get("Authorization"); got != "Bearer oauth-token" {
+			t.Errorf("request #%d Authorization header = %q, want the access token of the token server", i+1, got)
+		}
+	}
+	upstream.mtx.Unlock()
+
+	// the token is fetched once and reused until it expires
+	got := forms()
+	if len(got) != 1 {
+		t.Fatalf("%d token requests, want 1", len(got))
+	}
+	for k, want := range map[string]string{"grant_type": "client_credentials", "scope": "alerts", "audience": "alertmanager", "basic_auth": "collector:secret"} {
+		if v := got[0].Get(k); v != want {
+			t.Errorf("token request %s = %q, want %q", k, v, want)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	tests := []struct {
+		name       string
+		httpConfig string
+		env        bool
+	}{
+		{name: "proxy_url", httpConfig: "proxy_url: %s"},
+		{name: "proxy_url with a tuned transport", httpConfig: "proxy_url: %s\n    max_idle_conns: 10"},
+		{name: "proxy from the environment", httpConfig: "proxy_from_environment: true", env: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// the proxy answers for the unresolvable upstream
+			hosts := make(chan string, 1)
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hosts <- r.URL.Host
+			}))
+			t.Cleanup(proxy.Close)
+			httpConfig := tc.httpConfig
+			if tc.env {
+				t.Setenv("HTTP_PROXY", proxy.URL)
+				t.Setenv("NO_PROXY", "")
+			} else {
+				httpConfig = fmt.Sprintf(httpConfig, proxy.URL)
+			}
+			fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [alertmanager.invalid:9093]
+  http_config:
+    `+httpConfig+`
+`)
+			if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+				t.Fatalf("Forward() = %v, want nil through the proxy", err)
+			}
+			select {
+			case host := <-hosts:
+				if host != "alertmanager.invalid:9093" {
+					t.Errorf("proxied request to %q, want alertmanager.invalid:9093", host)
+				}
+			default:
+				t.Error("the request didn't go through the proxy")
+			}
+		})
+	}
+}
+
+func TestTunedTransport(t *testing.T) {
+	tests := []struct {
+		name                    string
+		httpConfig              string
+		wantMaxIdleConns        int
+		wantMaxIdleConnsPerHost int
+		wantIdleConnTimeout     time.Duration
+	}{
+		{
+			name:                    "all set",
+			httpConfig:              "{max_idle_conns: 50, max_idle_conns_per_host: 5, idle_conn_timeout: 30s}",
+			wantMaxIdleConns:        50,
+			wantMaxIdleConnsPerHost: 5,
+			wantIdleConnTimeout:     30 * time.Second,
+		},
+		{
+			name:                    "defaults of the unset options",
+			httpConfig:              "{max_idle_conns_per_host: 5}",
+			wantMaxIdleConns:        20000,
+			wantMaxIdleConnsPerHost: 5,
+			wantIdleConnTimeout:     5 * time.Minute,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [alertmanager:9093]
+  http_config: `+tc.httpConfig+`
+`)
+			transport, ok := fwder.alertmanagers[0].client.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("transport %T, want *http.Transport", fwder.alertmanagers[0].client.Transport)
+			}
+			if transport.MaxIdleConns != tc.wantMaxIdleConns || transport.MaxIdleConnsPerHost != tc.wantMaxIdleConnsPerHost ||
+				transport.IdleConnTimeout != tc.wantIdleConnTimeout {
+				t.Errorf("MaxIdleConns, MaxIdleConnsPerHost, IdleConnTimeout = %d, %d, %s, want %d, %d, %s",
+					transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout,
+					tc.wantMaxIdleConns, tc.wantMaxIdleConnsPerHost, tc.wantIdleConnTimeout)
+			}
+		})
+	}
+}
+
+func TestDefaultScheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     AlertmanagerConfig
+		wantURL string
+	}{
+		{
+			name:    "without TLS config",
+			cfg:     AlertmanagerConfig{EndpointsConfig: EndpointsConfig{StaticAddresses: []string{"alertmanager:9093"}}},
+			wantURL: "http://alertmanager:9093/api/v2/alerts",
+		},
+		{
+			name: "with TLS config",
+			cfg: AlertmanagerConfig{
+				EndpointsConfig:  EndpointsConfig{StaticAddresses: []string{"alertmanager:9093"}},
+				HTTPClientConfig: ClientConfig{TLSConfig: TLSConfig{InsecureSkipVerify: true}},
+			},
+			wantURL: "https://alertmanager:9093/api/v2/alerts",
+		},
+		{
+			name: "explicit scheme",
+			cfg: AlertmanagerConfig{
+				EndpointsConfig:  EndpointsConfig{StaticAddresses: []string{"alertmanager:9093"}, Scheme: "http"},
+				HTTPClientConfig: ClientConfig{TLSConfig: TLSConfig{InsecureSkipVerify: true}},
+			},
+			wantURL: "http://alertmanager:9093/api/v2/alerts",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.APIVersion = APIv2
+			am, err := NewAlertmanager(log.NewNopLogger(), tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer am.stop()
+			endpoints := am.currentEndpoints()
+			if len(endpoints) != 1 {
+				t.Fatalf("%d endpoints, want 1", len(endpoints))
+			}
+			u := am.alertsURL(*endpoints[0])
+			if got := u.String(); got != tc.wantURL {
+				t.Errorf("alerts URL = %q, want %q", got, tc.wantURL)
+			}
+		})
+	}
+}
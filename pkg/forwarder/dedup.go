@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// resolvedDeduper drops resolved alerts already forwarded within a window,
+// e.g. when the alert source keeps re-sending the resolved notification
+type resolvedDeduper struct {
+	logger log.Logger
+	window time.Duration
+	labels []string // labels of the dedup key, all labels if empty
+	redact bool     // whether the alertnames are kept out of the logs
+	now    func() time.Time
+
+	mtx      sync.Mutex
+	resolved map[string]time.Time // dedup key -> time the resolved alert was forwarded
+}
+
+// newResolvedDeduper returns a new resolved alerts deduper, nil if the window is not set
+func newResolvedDeduper(l log.Logger, window time.Duration, labels []string, redact bool) *resolvedDeduper {
+	if window <= 0 {
+		return nil
+	}
+	return &resolvedDeduper{
+		logger:   l,
+		window:   window,
+		labels:   labels,
+		redact:   redact,
+		now:      time.Now,
+		resolved: make(map[string]time.Time),
+	}
+}
+
+// filter returns the alerts without the resolved alerts already forwarded within the window,
+// a firing alert resets the state of its dedup key
+func (d *resolvedDeduper) filter(alerts template.Alerts) template.Alerts {
+	if d == nil {
+		return alerts
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := d.now()
+	for fp, ts := range d.resolved {
+		if now.Sub(ts) > d.window {
+			delete(d.resolved, fp)
+		}
+	}
+
+	filtered := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		fp := dedupKey(alt, d.labels)
+		if alt.Status != string(model.AlertResolved) {
+			delete(d.resolved, fp)
+			filtered = append(filtered, alt)
+			continue
+		}
+		if _, found := d.resolved[fp]; found {
+			level.Debug(d.logger).Log(alertKeyvals(d.redact, alt, "msg", "dropping duplicate resolved alert", "fingerprint", fp)...)
+			continue
+		}
+		d.resolved[fp] = now
+		filtered = append(filtered, alt)
+	}
+	return filtered
+}
+
+// dedupKey returns the key identifying duplicates of the alert, the fingerprint of the
+// given labels only or of the alert if no labels are given
+func dedupKey(alt template.Alert, labels []string) string {
+	if len(labels) == 0 {
+		return Fingerprint(alt)
+	}
+	ls := make(model.LabelSet, len(labels))
+	for _, name := range labels {
+		if v, found := alt.Labels[name]; found {
+			ls[model.LabelName(name)] = model.LabelValue(v)
+		}
+	}
+	return ls.Fingerprint().String()
+}
@@ -0,0 +1,76 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestResolvedDeduper(t *testing.T) {
+	type step struct {
+		after time.Duration
+		alert template.Alert
+		want  bool
+	}
+	tests := []struct {
+		name   string
+		labels []string
+		steps  []step
+	}{
+		{
+			name: "duplicate resolved alerts within the window",
+			steps: []step{
+				{alert: withStatus("a", statusResolved), want: true},
+				{after: time.Minute, alert: withStatus("a", statusResolved)},
+				{alert: withStatus("b", statusResolved), want: true},
+				{after: 5 * time.Minute, alert: withStatus("a", statusResolved), want: true},
+			},
+		},
+		{
+			name: "firing alert resets the state",
+			steps: []step{
+				{alert: withStatus("a", statusResolved), want: true},
+				{alert: withStatus("a", statusFiring), want: true},
+				{alert: withStatus("a", statusFiring), want: true},
+				{alert: withStatus("a", statusResolved), want: true},
+				{alert: withStatus("a", statusResolved)},
+			},
+		},
+		{
+			name:   "dedup labels",
+			labels: []string{"alertname"},
+			steps: []step{
+				{alert: withStatus("a", statusResolved, "pod", "a-1"), want: true},
+				{alert: withStatus("a", statusResolved, "pod", "a-2")},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newResolvedDeduper(log.NewNopLogger(), 2*time.Minute, tc.labels, false)
+			now := time.Now()
+			d.now = func() time.Time { return now }
+			for i, step := range tc.steps {
+				now = now.Add(step.after)
+				if got := len(d.filter(template.Alerts{step.alert})) == 1; got != step.want {
+					t.Errorf("step %d: forwarded %s %s = %v, want %v", i, step.alert.Status, step.alert.Labels, got, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestResolvedDeduperDisabled(t *testing.T) {
+	d := newResolvedDeduper(log.NewNopLogger(), 0, nil, false)
+	if d != nil {
+		t.Fatal("newResolvedDeduper() returned a deduper without window, want nil")
+	}
+	alerts := template.Alerts{withStatus("a", statusResolved), withStatus("a", statusResolved)}
+	if got := d.filter(alerts); len(got) != 2 {
+		t.Errorf("nil deduper kept %d alerts, want 2", len(got))
+	}
+}
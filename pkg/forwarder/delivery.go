@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// deliveries tracks which alerts of a batch were sent to a target and which of them a target accepted,
+// so that an alert is only considered forwarded if a target it was sent to delivered it
+type deliveries struct {
+	mtx       sync.Mutex
+	delivered map[string]bool // fingerprint of the attempted alerts -> delivered
+}
+
+func newDeliveries() *deliveries {
+	return &deliveries{delivered: make(map[string]bool)}
+}
+
+// attempt records that the alerts were sent to a target
+func (d *deliveries) attempt(alerts template.Alerts) {
+	if d == nil {
+		return
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, alt := range alerts {
+		fp := Fingerprint(alt)
+		if _, found := d.delivered[fp]; !found {
+			d.delivered[fp] = false
+		}
+	}
+}
+
+// deliver records that a target accepted the alerts
+func (d *deliveries) deliver(alerts template.Alerts) {
+	if d == nil {
+		return
+	}
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for _, alt := range alerts {
+		d.delivered[Fingerprint(alt)] = true
+	}
+}
+
+// merge records the attempts and deliveries of other
+func (d *deliveries) merge(other *deliveries) {
+	other.mtx.Lock()
+	defer other.mtx.Unlock()
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for fp, ok := range other.delivered {
+		d.delivered[fp] = d.delivered[fp] || ok
+	}
+}
+
+// attempted reports whether any alert was sent to a target
+func (d *deliveries) attempted() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return len(d.delivered) > 0
+}
+
+// undelivered returns the alerts no target accepted, including the alerts not sent to any target
+func (d *deliveries) undelivered(alerts template.Alerts) template.Alerts {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	var selected template.Alerts
+	for _, alt := range alerts {
+		if !d.delivered[Fingerprint(alt)] {
+			selected = append(selected, alt)
+		}
+	}
+	return selected
+}
+
+// failed returns the alerts sent to targets none of which accepted them
+func (d *deliveries) failed(alerts template.Alerts) template.Alerts {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	var selected template.Alerts
+	for _, alt := range alerts {
+		if ok, found := d.delivered[Fingerprint(alt)]; found && !ok {
+			selected = append(selected, alt)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,68 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+)
+
+func TestDeliveries(t *testing.T) {
+	alerts := firing("a", "b", "c")
+	tests := []struct {
+		name            string
+		attempted       []string
+		delivered       []string
+		merged          []string // attempted and delivered by another tracker
+		wantAttempted   bool
+		wantUndelivered []string
+		wantFailed      []string
+	}{
+		{name: "nothing attempted", wantUndelivered: []string{"a", "b", "c"}},
+		{
+			name:            "all delivered",
+			attempted:       []string{"a", "b", "c"},
+			delivered:       []string{"a", "b", "c"},
+			wantAttempted:   true,
+			wantUndelivered: nil,
+		},
+		{
+			name:            "partially delivered",
+			attempted:       []string{"a", "b"},
+			delivered:       []string{"a"},
+			wantAttempted:   true,
+			wantUndelivered: []string{"b", "c"},
+			wantFailed:      []string{"b"},
+		},
+		{
+			name:            "delivered by another target",
+			attempted:       []string{"a", "b"},
+			merged:          []string{"b"},
+			wantAttempted:   true,
+			wantUndelivered: []string{"a", "c"},
+			wantFailed:      []string{"a"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newDeliveries()
+			d.attempt(firing(tc.attempted...))
+			d.deliver(firing(tc.delivered...))
+			other := newDeliveries()
+			other.attempt(firing(tc.merged...))
+			other.deliver(firing(tc.merged...))
+			d.merge(other)
+
+			if got := d.attempted(); got != tc.wantAttempted {
+				t.Errorf("attempted() = %v, want %v", got, tc.wantAttempted)
+			}
+			checkAlertnames(t, "undelivered", alertnamesOf(d.undelivered(alerts)), tc.wantUndelivered)
+			checkAlertnames(t, "failed", alertnamesOf(d.failed(alerts)), tc.wantFailed)
+		})
+	}
+}
+
+func TestDeliveriesNil(t *testing.T) {
+	var d *deliveries
+	d.attempt(firing("a"))
+	d.deliver(firing("a"))
+}
@@ -0,0 +1,34 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"github.com/prometheus/alertmanager/template"
+	"golang.org/x/oauth2"
+)
+
+// Encoder encodes an alert batch into the request body posted to an alertmanager,
+// it replaces the built-in encoding of the alertmanager API version
+type Encoder interface {
+	// Encode returns the request body for the alerts
+	Encode(alerts template.Alerts) ([]byte, error)
+	// ContentType returns the content type of the encoded request body
+	ContentType() string
+}
+
+// Options are the programmatic options of the forwarder for embedders
+type Options struct {
+	// RoutingConfigFile is the YAML file containing the routing rules, reloaded on change.
+	RoutingConfigFile string
+	// StrictEnv fails loading the configuration if it references undefined environment variables.
+	StrictEnv bool
+	// Encoders are the custom encoders keyed by the name of the alertmanager they are used for.
+	Encoders map[string]Encoder
+	// TokenSources are the custom sources of the bearer tokens attached to the requests, keyed by the name
+	// of the alertmanager they are used for, e.g. to authenticate to a proxy in front of the alertmanager.
+	TokenSources map[string]oauth2.TokenSource
+	// OnSendResult is called with the result of each send to an alertmanager endpoint or receiver.
+	OnSendResult func(target string, numAlerts int, err error)
+	// RedactPayloads logs only the counts and fingerprints of the alerts, not their labels and annotations.
+	RedactPayloads bool
+}
@@ -0,0 +1,97 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// lineEncoder encodes the alertnames of the batch one per line
+type lineEncoder struct{}
+
+func (lineEncoder) Encode(alerts template.Alerts) ([]byte, error) {
+	return []byte(strings.Join(alertnamesOf(alerts), "\n")), nil
+}
+
+func (lineEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func TestCustomEncoder(t *testing.T) {
+	type request struct {
+		contentType string
+		body        string
+	}
+	requests := make(chan request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- request{contentType: r.Header.Get("Content-Type"), body: string(body)}
+	}))
+	defer upstream.Close()
+	config := writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- name: custom
+  static_configs: [`+strings.TrimPrefix(upstream.URL, "http://")+`]
+  scheme: http
+`)
+
+	fwder, err := NewForwarderWithOptions(log.NewNopLogger(), config, Options{Encoders: map[string]Encoder{"custom": lineEncoder{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwder.Stop()
+	if err := fwder.Forward(context.Background(), firing("a", "b")); err != nil {
+		t.Fatalf("Forward() = %v", err)
+	}
+	req := <-requests
+	if req.contentType != "text/plain" || req.body != "a\nb" {
+		t.Errorf("upstream received %q with Content-Type %q, want the custom encoding", req.body, req.contentType)
+	}
+
+	if _, err := NewForwarderWithOptions(log.NewNopLogger(), config, Options{Encoders: map[string]Encoder{"missing": lineEncoder{}}}); err == nil {
+		t.Error("NewForwarderWithOptions() succeeded with an encoder of an unknown alertmanager, want error")
+	}
+}
+
+func TestCustomEncoderFailureResult(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	config := writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- name: custom
+  static_configs: [`+upstream.addr()+`]
+`)
+	type result struct {
+		target    string
+		numAlerts int
+		err       error
+	}
+	var results []result
+	fwder, err := NewForwarderWithOptions(log.NewNopLogger(), config, Options{
+		Encoders: map[string]Encoder{"custom": failingEncoder{}},
+		OnSendResult: func(target string, numAlerts int, err error) {
+			results = append(results, result{target: target, numAlerts: numAlerts, err: err})
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwder.Stop()
+	if err := fwder.Forward(context.Background(), firing("a", "b")); err == nil {
+		t.Fatal("Forward() succeeded with an encoder failing, want error")
+	}
+	// the failure is reported like the other send results, e.g. to the test-send subcommand
+	if len(results) != 1 || results[0].target != "custom" || results[0].numAlerts != 2 || results[0].err == nil {
+		t.Errorf("send results = %+v, want the encoding failure of the 2 alerts for custom", results)
+	}
+	if got := upstream.received(); len(got) != 0 {
+		t.Errorf("upstream received %v, want nothing", got)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+// EnrichmentConfig represents the lookups loaded from the enrichment file.
+type EnrichmentConfig struct {
+	// Lookups are applied in order, labels and annotations already set on the alert
+	// or by a previous lookup are never overwritten.
+	Lookups []LookupConfig `yaml:"lookups"`
+}
+
+// LookupConfig joins metadata to the alerts by the value of a label.
+type LookupConfig struct {
+	// Label whose value is looked up in the entries, e.g. namespace.
+	KeyLabel string `yaml:"key_label"`
+	// Metadata added to the alerts, by value of the key label.
+	Entries map[string]EnrichmentEntry `yaml:"entries"`
+}
+
+// EnrichmentEntry is the metadata added to the alerts matching a lookup key.
+type EnrichmentEntry struct {
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// fileEnricher adds labels and annotations to the alerts from the enrichment file,
+// which is reloaded on change
+type fileEnricher struct {
+	logger log.Logger
+	file   string
+
+	mtx     sync.RWMutex
+	lookups []LookupConfig
+
+	watcher *fsnotify.Watcher
+}
+
+// newFileEnricher loads the enrichment file and watches it for changes, nil if no file is set
+func newFileEnricher(l log.Logger, file string) (*fileEnricher, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	e := &fileEnricher{logger: l, file: file}
+	if err := e.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := watchFile(l, file, e.reload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch enrichment file: %v", err)
+	}
+	e.watcher = watcher
+	return e, nil
+}
+
+// reload loads the lookups from the enrichment file, the current lookups are kept on error
+func (e *fileEnricher) reload() error {
+	b, err := ioutil.ReadFile(e.file)
+	if err != nil {
+		return fmt.Errorf("failed to load enrichment file %s: %v", e.file, err)
+	}
+	cfg := &EnrichmentConfig{}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return fmt.Errorf("failed to unmarshal enrichment file: %v", err)
+	}
+	for i, lk := range cfg.Lookups {
+		if lk.KeyLabel == "" {
+			return fmt.Errorf("missing key_label in lookup %d", i)
+		}
+	}
+
+	e.mtx.Lock()
+	e.lookups = cfg.Lookups
+	e.mtx.Unlock()
+	level.Info(e.logger).Log("msg", "enrichment file loaded", "file", e.file, "lookups", len(cfg.Lookups))
+	return nil
+}
+
+// enrich adds the labels and annotations of the matching lookup entries to the alerts
+func (e *fileEnricher) enrich(alerts template.Alerts) template.Alerts {
+	if e == nil {
+		return alerts
+	}
+
+	e.mtx.RLock()
+	lookups := e.lookups
+	e.mtx.RUnlock()
+
+	for i, alt := range alerts {
+		var labels, annotations template.KV
+		for _, lk := range lookups {
+			entry, found := lk.Entries[alt.Labels[lk.KeyLabel]]
+			if !found {
+				continue
+			}
+			if labels == nil {
+				labels = copyKV(alt.Labels)
+				annotations = copyKV(alt.Annotations)
+			}
+			for k, v := range entry.Labels {
+				setIfAbsent(labels, k, v)
+			}
+			for k, v := range entry.Annotations {
+				setIfAbsent(annotations, k, v)
+			}
+		}
+		if labels != nil {
+			alerts[i].Labels = labels
+			alerts[i].Annotations = annotations
+		}
+	}
+	return alerts
+}
+
+// stop stops watching the enrichment file
+func (e *fileEnricher) stop() {
+	if e == nil {
+		return
+	}
+	e.watcher.Close()
+}
+
+// copyKV returns a copy of the key/value pairs
+func copyKV(kv template.KV) template.KV {
+	c := make(template.KV, len(kv))
+	for k, v := range kv {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,101 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestFileEnricher(t *testing.T) {
+	const enrichment = `
+lookups:
+- key_label: namespace
+  entries:
+    monitoring:
+      labels: {team: observability}
+      annotations: {slack: "#observability"}
+- key_label: cluster
+  entries:
+    east:
+      labels: {team: east, region: us-east-1}
+`
+	tests := []struct {
+		name            string
+		labels          template.KV
+		wantLabels      template.KV
+		wantAnnotations template.KV
+	}{
+		{
+			name:            "no match",
+			labels:          template.KV{"namespace": "default"},
+			wantLabels:      template.KV{"namespace": "default"},
+			wantAnnotations: template.KV{},
+		},
+		{
+			name:            "single lookup",
+			labels:          template.KV{"namespace": "monitoring"},
+			wantLabels:      template.KV{"namespace": "monitoring", "team": "observability"},
+			wantAnnotations: template.KV{"slack": "#observability"},
+		},
+		{
+			name:            "earlier lookup wins",
+			labels:          template.KV{"namespace": "monitoring", "cluster": "east"},
+			wantLabels:      template.KV{"namespace": "monitoring", "cluster": "east", "team": "observability", "region": "us-east-1"},
+			wantAnnotations: template.KV{"slack": "#observability"},
+		},
+		{
+			name:            "alert labels aren't overwritten",
+			labels:          template.KV{"cluster": "east", "team": "sre"},
+			wantLabels:      template.KV{"cluster": "east", "team": "sre", "region": "us-east-1"},
+			wantAnnotations: template.KV{},
+		},
+	}
+	e, err := newFileEnricher(log.NewNopLogger(), writeFile(t, "enrichment.yaml", enrichment))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.stop()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			before := copyKV(tc.labels)
+			alerts := e.enrich(template.Alerts{{Labels: tc.labels, Annotations: template.KV{}}})
+			if !reflect.DeepEqual(alerts[0].Labels, tc.wantLabels) {
+				t.Errorf("labels = %v, want %v", alerts[0].Labels, tc.wantLabels)
+			}
+			if !reflect.DeepEqual(alerts[0].Annotations, tc.wantAnnotations) {
+				t.Errorf("annotations = %v, want %v", alerts[0].Annotations, tc.wantAnnotations)
+			}
+			if !reflect.DeepEqual(tc.labels, before) {
+				t.Error("the labels shared with the sender were modified")
+			}
+		})
+	}
+}
+
+func TestNewFileEnricher(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", content: "lookups: []\n"},
+		{name: "unknown field", content: "lookup: []\n", wantErr: true},
+		{name: "missing key label", content: "lookups:\n- entries: {}\n", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := newFileEnricher(log.NewNopLogger(), writeFile(t, "enrichment.yaml", tc.content))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newFileEnricher() error = %v, want error %v", err, tc.wantErr)
+			}
+			e.stop()
+		})
+	}
+	if e, err := newFileEnricher(log.NewNopLogger(), ""); e != nil || err != nil {
+		t.Errorf("newFileEnricher() without file = %v, %v, want nil", e, err)
+	}
+}
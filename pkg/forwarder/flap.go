@@ -0,0 +1,142 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	defaultFlapWindow   = 10 * time.Minute
+	defaultFlapCooldown = 10 * time.Minute
+	// maxFlapBackoff caps the growth of the cooldown of an alert that keeps flapping
+	maxFlapBackoff = 16
+)
+
+// FlapDetectionConfig suppresses the state transitions of flapping alerts.
+type FlapDetectionConfig struct {
+	// Number of transitions between firing and resolved within the window after which an alert is flapping,
+	// 0 disables flap detection.
+	MaxTransitions int            `yaml:"max_transitions"`
+	Window         model.Duration `yaml:"window"`
+	// Time the transitions of a flapping alert are suppressed for, doubled each time the alert
+	// flaps again right after the suppression ended.
+	Cooldown model.Duration `yaml:"cooldown"`
+}
+
+// flapState is the state of an alert tracked by the flap detector
+type flapState struct {
+	status          string      // last forwarded status
+	transitions     []time.Time // transitions within the window
+	suppressedUntil time.Time
+	strikes         uint // consecutive suppressions
+	lastSeen        time.Time
+}
+
+// flapDetector drops the state transitions of the alerts flapping between firing and resolved
+type flapDetector struct {
+	logger         log.Logger
+	maxTransitions int
+	window         time.Duration
+	cooldown       time.Duration
+	redact         bool // whether the alertnames are kept out of the logs
+	now            func() time.Time
+
+	mtx    sync.Mutex
+	alerts map[string]*flapState // fingerprint -> state
+}
+
+// newFlapDetector returns a new flap detector, nil if flap detection is disabled
+func newFlapDetector(l log.Logger, cfg FlapDetectionConfig, redact bool) *flapDetector {
+	if cfg.MaxTransitions <= 0 {
+		return nil
+	}
+	d := &flapDetector{
+		logger:         l,
+		maxTransitions: cfg.MaxTransitions,
+		window:         time.Duration(cfg.Window),
+		cooldown:       time.Duration(cfg.Cooldown),
+		redact:         redact,
+		now:            time.Now,
+		alerts:         make(map[string]*flapState),
+	}
+	if d.window <= 0 {
+		d.window = defaultFlapWindow
+	}
+	if d.cooldown <= 0 {
+		d.cooldown = defaultFlapCooldown
+	}
+	return d
+}
+
+// filter returns the alerts without the suppressed transitions of flapping alerts,
+// alerts sent again with their last forwarded status are kept
+func (d *flapDetector) filter(alerts template.Alerts) template.Alerts {
+	if d == nil {
+		return alerts
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	now := d.now()
+	for fp, st := range d.alerts {
+		if now.Sub(st.lastSeen) > d.window && now.After(st.suppressedUntil) {
+			delete(d.alerts, fp)
+		}
+	}
+
+	kept := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		fp := Fingerprint(alt)
+		st, found := d.alerts[fp]
+		if !found {
+			d.alerts[fp] = &flapState{status: alt.Status, lastSeen: now}
+			kept = append(kept, alt)
+			continue
+		}
+		st.lastSeen = now
+		if alt.Status == st.status {
+			kept = append(kept, alt)
+			continue
+		}
+		if now.Before(st.suppressedUntil) {
+			level.Debug(d.logger).Log(alertKeyvals(d.redact, alt, "msg", "suppressing transition of flapping alert", "fingerprint", fp, "status", alt.Status)...)
+			continue
+		}
+
+		transitions := st.transitions[:0]
+		for _, ts := range st.transitions {
+			if now.Sub(ts) <= d.window {
+				transitions = append(transitions, ts)
+			}
+		}
+		st.transitions = append(transitions, now)
+		st.status = alt.Status
+		kept = append(kept, alt)
+
+		if len(st.transitions) > d.maxTransitions {
+			// the alert keeps flapping right after the previous suppression
+			if st.strikes > 0 && now.Sub(st.suppressedUntil) > d.window {
+				st.strikes = 0
+			}
+			if st.strikes < maxFlapBackoff {
+				st.strikes++
+			}
+			cooldown := d.cooldown * time.Duration(uint(1)<<(st.strikes-1))
+			if max := d.cooldown * maxFlapBackoff; cooldown > max {
+				cooldown = max
+			}
+			st.suppressedUntil = now.Add(cooldown)
+			st.transitions = nil
+			level.Warn(d.logger).Log(alertKeyvals(d.redact, alt, "msg", "alert is flapping, suppressing its transitions", "fingerprint", fp, "cooldown", cooldown)...)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,101 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+func TestFlapDetector(t *testing.T) {
+	type step struct {
+		after  time.Duration
+		status string
+		want   bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "transitions below the limit",
+			steps: []step{
+				{status: statusFiring, want: true},
+				{after: time.Minute, status: statusResolved, want: true},
+				{after: time.Minute, status: statusFiring, want: true},
+			},
+		},
+		{
+			name: "flapping alert is suppressed for the cooldown",
+			steps: []step{
+				{status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				{status: statusFiring, want: true},
+				// the third transition is forwarded and starts the suppression
+				{status: statusResolved, want: true},
+				{after: time.Minute, status: statusFiring},
+				{status: statusResolved, want: true},
+				{after: 5 * time.Minute, status: statusFiring, want: true},
+			},
+		},
+		{
+			name: "transitions out of the window don't count",
+			steps: []step{
+				{status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				// the alert unseen for longer than the window is forgotten
+				{after: 20 * time.Minute, status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				{status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				{status: statusFiring},
+			},
+		},
+		{
+			name: "cooldown doubles when the alert flaps again",
+			steps: []step{
+				{status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				{status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				{after: 5 * time.Minute, status: statusFiring, want: true},
+				{status: statusResolved, want: true},
+				{status: statusFiring, want: true},
+				// suppressed for 10 minutes
+				{after: 9 * time.Minute, status: statusResolved},
+				{after: 2 * time.Minute, status: statusResolved, want: true},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newFlapDetector(log.NewNopLogger(), FlapDetectionConfig{
+				MaxTransitions: 2,
+				Window:         model.Duration(10 * time.Minute),
+				Cooldown:       model.Duration(5 * time.Minute),
+			}, false)
+			now := time.Now()
+			d.now = func() time.Time { return now }
+			for i, s := range tc.steps {
+				now = now.Add(s.after)
+				if got := len(d.filter(template.Alerts{withStatus("a", s.status)})) == 1; got != s.want {
+					t.Errorf("step %d: forwarded %s = %v, want %v", i, s.status, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlapDetectorDisabled(t *testing.T) {
+	d := newFlapDetector(log.NewNopLogger(), FlapDetectionConfig{}, false)
+	if d != nil {
+		t.Fatal("newFlapDetector() returned a detector without max_transitions, want nil")
+	}
+	if got := d.filter(firing("a", "b")); len(got) != 2 {
+		t.Errorf("nil detector kept %d alerts, want 2", len(got))
+	}
+}
@@ -8,10 +8,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
-	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,197 +24,1411 @@ import (
 	"github.com/go-openapi/strfmt"
 	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/atomic"
+	"golang.org/x/oauth2"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/tracing"
+	"github.com/open-cluster-management/alerts-collector/pkg/version"
 )
 
+// tenantHeader is the header carrying the tenant for Cortex/Mimir multi-tenancy
+const tenantHeader = "X-Scope-OrgID"
+
+// fingerprintHeader is the header carrying the comma-separated fingerprints of the posted alerts
+const fingerprintHeader = "X-Alert-Fingerprint"
+
+// maxErrorBodyBytes is the maximum size of the response body included in the error of a bad response
+const maxErrorBodyBytes = 1024
+
+// defaultTimeout is the timeout of the requests to an upstream if it is not configured
+const defaultTimeout = 10 * time.Second
+
+// defaultDrainTimeout is the time to flush pending alerts on shutdown if it is not configured
+const defaultDrainTimeout = 10 * time.Second
+
 // Alertmanager is an HTTP client that can send alerts to an alertmanager endpoint
 type Alertmanager struct {
 	logger    log.Logger
+	name      string
+	id        string // stable name within the forwarder, the name or alertmanagers[<index>] if it has none
 	endpoints []*url.URL
 	client    *http.Client
 	timeout   time.Duration
 	version   APIVersion
+	encoder   Encoder // custom encoder, nil to use the built-in encoding of the API version
+
+	endpointTimeout time.Duration // maximum time spent on an endpoint for a batch, 0 means no limit
+
+	scheme      string
+	pathPrefix  string
+	breakerCfg  CircuitBreakerConfig
+	discoverers []*k8sDiscoverer
+	health      *healthChecker
+	epMtx       sync.RWMutex
+	breakers    map[string]*circuitBreaker // endpoint -> circuit breaker
+	discovered  [][]*url.URL               // discovered endpoints by kubernetes_sd_configs index
+	tracked     map[string]bool            // endpoints whose series are held, see acquireEndpoint
+
+	forwardResolved bool
+	headers         map[string]string
+	tenantLabel     string
+	defaultTenant   string
+
+	maxAlertsPerRequest int
+	annotationTemplates []annotationTemplate
+
+	mirror         bool
+	priority       int
+	cluster        bool
+	clusterMember  atomic.Uint64 // index of the cluster member that accepted the last requests
+	disabled       atomic.Bool   // disabled at runtime, e.g. for maintenance
+	critical       bool
+	unhealthyAfter time.Duration
+	mtx            sync.Mutex
+	failingSince   time.Time // zero if the last forward succeeded
+	now            func() time.Time
 }
 
 // NewAlertmanager construct new Alertmanager client
 func NewAlertmanager(l log.Logger, amcfg AlertmanagerConfig) (*Alertmanager, error) {
-	client, err := createHTTPClient(amcfg.HTTPClientConfig, "alerts-collector")
+	clientCfg := amcfg.HTTPClientConfig
+	clientCfg.http2 = amcfg.HTTP2
+	client, err := createHTTPClient(clientCfg, "alerts-collector")
 	if err != nil {
 		return nil, fmt.Errorf("failed to create http client for upstream alertmanager: %v", err)
 	}
 
-	// TODO(morvencao): support dynamic service discovery
-	if reflect.DeepEqual(amcfg.EndpointsConfig, EndpointsConfig{}) || len(amcfg.EndpointsConfig.StaticAddresses) == 0 {
+	if len(amcfg.EndpointsConfig.StaticAddresses) == 0 && len(amcfg.EndpointsConfig.KubernetesSDConfigs) == 0 {
 		return nil, fmt.Errorf("failed to get endpoint addresses")
 	}
 
-	var urls []*url.URL
+	timeout := time.Duration(amcfg.Timeout)
+	if timeout == 0 {
+		timeout = defaultTimeout
+		level.Info(l).Log("msg", "timeout not configured for alertmanager, using the default", "alertmanager", amcfg.Name, "timeout", timeout)
+	}
+
+	scheme := amcfg.EndpointsConfig.Scheme
+	if scheme == "" {
+		scheme = amcfg.defaultScheme()
+	}
+
+	annotationTemplates, err := newAnnotationTemplates(amcfg.AnnotationTemplates)
+	if err != nil {
+		return nil, err
+	}
+
+	am := &Alertmanager{
+		logger:  l,
+		name:    amcfg.Name,
+		client:  client,
+		timeout: timeout,
+		version: amcfg.APIVersion,
+
+		endpointTimeout: time.Duration(amcfg.EndpointTimeout),
+
+		scheme:     scheme,
+		pathPrefix: amcfg.EndpointsConfig.PathPrefix,
+		breakerCfg: amcfg.CircuitBreaker,
+		breakers:   make(map[string]*circuitBreaker),
+		discovered: make([][]*url.URL, len(amcfg.EndpointsConfig.KubernetesSDConfigs)),
+		tracked:    make(map[string]bool),
+
+		forwardResolved: amcfg.ForwardResolved == nil || *amcfg.ForwardResolved,
+		headers:         amcfg.Headers,
+		tenantLabel:     amcfg.TenantLabel,
+		defaultTenant:   amcfg.DefaultTenant,
+
+		maxAlertsPerRequest: amcfg.MaxAlertsPerRequest,
+		annotationTemplates: annotationTemplates,
+
+		mirror:         amcfg.Mirror,
+		priority:       amcfg.Priority,
+		cluster:        amcfg.Cluster,
+		critical:       amcfg.Critical,
+		unhealthyAfter: time.Duration(amcfg.UnhealthyAfter),
+		now:            time.Now,
+	}
 	for _, addr := range amcfg.EndpointsConfig.StaticAddresses {
-		urls = append(urls,
-			&url.URL{
-				Scheme: amcfg.EndpointsConfig.Scheme,
-				Host:   addr,
-				Path:   path.Join("/", amcfg.EndpointsConfig.PathPrefix),
-			},
-		)
+		host, err := normalizeAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		am.endpoints = append(am.endpoints, am.endpointURL(host))
+	}
+	am.epMtx.Lock()
+	am.trackEndpoints()
+	am.epMtx.Unlock()
+	for i, sd := range amcfg.EndpointsConfig.KubernetesSDConfigs {
+		i := i
+		d, err := newK8sDiscoverer(log.With(l, "alertmanager", amcfg.Name), sd, func(addrs []string) {
+			am.setDiscovered(i, addrs)
+		})
+		if err != nil {
+			am.stop()
+			return nil, err
+		}
+		am.discoverers = append(am.discoverers, d)
+	}
+	am.health = newHealthChecker(log.With(l, "alertmanager", amcfg.Name), am, time.Duration(amcfg.HealthCheckInterval), amcfg.HealthCheckPath)
+	return am, nil
+}
+
+// normalizeAddress validates the host[:port] address and brackets IPv6 literals, with their zone if any
+func normalizeAddress(addr string) (string, error) {
+	if addr == "" {
+		return "", fmt.Errorf("empty endpoint address")
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if host == "" {
+			return "", fmt.Errorf("invalid endpoint address %q: missing host", addr)
+		}
+		if strings.Contains(host, "%") && !isIPv6(host) {
+			return "", fmt.Errorf("invalid endpoint address %q: zone of a non IPv6 host", addr)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("invalid endpoint address %q: invalid port %q", addr, port)
+		}
+		return net.JoinHostPort(host, port), nil
+	}
+	// no port, the default port of the scheme is used
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if isIPv6(host) {
+		return "[" + host + "]", nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return host, nil
+	}
+	if host != addr || strings.ContainsAny(addr, ":/% ") {
+		return "", fmt.Errorf("invalid endpoint address %q", addr)
+	}
+	return addr, nil
+}
+
+// isIPv6 reports whether the host is an IPv6 literal, with a zone or not
+func isIPv6(host string) bool {
+	if i := strings.LastIndex(host, "%"); i >= 0 {
+		host = host[:i]
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.To4() == nil
+}
+
+// endpointURL returns the URL of the endpoint with the address
+func (am *Alertmanager) endpointURL(addr string) *url.URL {
+	return &url.URL{
+		Scheme: am.scheme,
+		Host:   addr,
+		Path:   path.Join("/", am.pathPrefix),
+	}
+}
+
+// setDiscovered replaces the endpoints discovered by the kubernetes_sd_configs with the index
+func (am *Alertmanager) setDiscovered(i int, addrs []string) {
+	urls := make([]*url.URL, 0, len(addrs))
+	for _, addr := range addrs {
+		urls = append(urls, am.endpointURL(addr))
 	}
+	am.epMtx.Lock()
+	am.discovered[i] = urls
+	am.trackEndpoints()
+	am.epMtx.Unlock()
+}
+
+// trackEndpoints holds the series of the current endpoints and releases the series and the circuit breakers
+// of the endpoints that are gone, the lock must be held
+func (am *Alertmanager) trackEndpoints() {
+	current := make(map[string]bool)
+	for _, u := range am.endpoints {
+		current[u.String()] = true
+	}
+	for _, urls := range am.discovered {
+		for _, u := range urls {
+			current[u.String()] = true
+		}
+	}
+	for endpoint := range current {
+		if !am.tracked[endpoint] {
+			acquireEndpoint(endpoint)
+			am.tracked[endpoint] = true
+		}
+	}
+	for endpoint := range am.tracked {
+		if !current[endpoint] {
+			releaseEndpoint(endpoint)
+			delete(am.tracked, endpoint)
+			delete(am.breakers, endpoint)
+		}
+	}
+}
+
+// currentEndpoints returns the static and the currently discovered endpoints
+func (am *Alertmanager) currentEndpoints() []*url.URL {
+	am.epMtx.RLock()
+	defer am.epMtx.RUnlock()
+
+	endpoints := append([]*url.URL(nil), am.endpoints...)
+	for _, urls := range am.discovered {
+		endpoints = append(endpoints, urls...)
+	}
+	return endpoints
+}
+
+// breaker returns the circuit breaker of the endpoint, nil if it is disabled
+func (am *Alertmanager) breaker(u *url.URL) *circuitBreaker {
+	key := u.String()
+	am.epMtx.Lock()
+	defer am.epMtx.Unlock()
+
+	cb, found := am.breakers[key]
+	if !found {
+		cb = newCircuitBreaker(key, am.breakerCfg)
+		am.breakers[key] = cb
+	}
+	return cb
+}
 
-	return &Alertmanager{
-		logger:    l,
-		endpoints: urls,
-		client:    client,
-		timeout:   time.Duration(amcfg.Timeout),
-		version:   amcfg.APIVersion,
-	}, nil
+// stop stops the service discovery and the health checks of the alertmanager and releases the series of its endpoints
+func (am *Alertmanager) stop() {
+	am.health.stop()
+	for _, d := range am.discoverers {
+		d.stop()
+	}
+	am.epMtx.Lock()
+	defer am.epMtx.Unlock()
+	for endpoint := range am.tracked {
+		releaseEndpoint(endpoint)
+		delete(am.tracked, endpoint)
+	}
 }
 
 // postAlerts post the alert to upstream alertmanager
-func (am *Alertmanager) postAlerts(ctx context.Context, u url.URL, r io.Reader) error {
+func (am *Alertmanager) postAlerts(ctx context.Context, u url.URL, tenant string, fingerprints []string, r io.Reader) (err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "alertmanager.post", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPMethodKey.String("POST"),
+		semconv.HTTPURLKey.String(u.String()),
+	))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	req, err := http.NewRequest("POST", u.String(), r)
 	if err != nil {
 		return err
 	}
-	timeout := am.timeout
-	// set defaut timeout 10s if the timeout for the alertmanager client is not set
-	if int64(am.timeout) == 0 {
-		timeout = 10 * time.Second
-	}
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, am.timeout)
 	defer cancel()
 	req = req.WithContext(ctx)
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", am.contentType())
+	req.Header.Set("User-Agent", version.UserAgent())
+	for name, value := range am.headers {
+		req.Header.Set(name, value)
+	}
+	if tenant != "" {
+		req.Header.Set(tenantHeader, tenant)
+	}
+	if len(fingerprints) > 0 {
+		req.Header.Set(fingerprintHeader, strings.Join(fingerprints, ","))
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	resp, err := am.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send request to %q: %v", u.String(), err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
 	level.Info(am.logger).Log("msg", "post an alert")
 
 	if resp.StatusCode/100 != 2 {
-		return fmt.Errorf("bad response status %v from %q", resp.Status, u.String())
+		return responseError(resp, u.String())
+	}
+	return nil
+}
+
+// responseError returns the error for the bad response status including the beginning of the response body,
+// which usually explains why the request was rejected
+func responseError(resp *http.Response, u string) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return fmt.Errorf("bad response status %v from %q: %s", resp.Status, u, msg)
+	}
+	return fmt.Errorf("bad response status %v from %q", resp.Status, u)
+}
+
+// String returns the name of the alertmanager, or its endpoints if it has no name
+func (am *Alertmanager) String() string {
+	if am.name != "" {
+		return am.name
+	}
+	hosts := make([]string, 0, len(am.endpoints))
+	for _, u := range am.endpoints {
+		hosts = append(hosts, u.Host)
+	}
+	return strings.Join(hosts, ",")
+}
+
+// alertsURL returns the URL of the alerts API of the alertmanager endpoint
+func (am *Alertmanager) alertsURL(u url.URL) url.URL {
+	u.Path = path.Join(u.Path, fmt.Sprintf("/api/%s/alerts", string(am.version)))
+	return u
+}
+
+// filter returns the alerts to forward to the alertmanager
+func (am *Alertmanager) filter(alerts template.Alerts) template.Alerts {
+	if am.forwardResolved {
+		return alerts
+	}
+	return alerts.Firing()
+}
+
+// encode returns the payload posted to the alertmanager for the alerts
+func (am *Alertmanager) encode(alerts template.Alerts) ([]byte, error) {
+	if am.encoder != nil {
+		return am.encoder.Encode(alerts)
+	}
+
+	switch am.version {
+	case APIv1:
+		return json.Marshal(alerts)
+	case APIv2:
+		pAlerts := make(models.PostableAlerts, 0, len(alerts))
+		for _, alt := range alerts {
+			pAlerts = append(pAlerts, &models.PostableAlert{
+				Annotations: kvToLabelSet(alt.Annotations),
+				EndsAt:      strfmt.DateTime(alt.EndsAt),
+				StartsAt:    strfmt.DateTime(alt.StartsAt),
+				Alert: models.Alert{
+					GeneratorURL: strfmt.URI(alt.GeneratorURL),
+					Labels:       kvToLabelSet(alt.Labels),
+				},
+			})
+		}
+		return json.Marshal(pAlerts)
+	default:
+		return nil, fmt.Errorf("unsupported API version %q", am.version)
+	}
+}
+
+// request is a request to an alertmanager endpoint
+type request struct {
+	tenant string // tenant set as X-Scope-OrgID, empty if the alertmanager isn't multi-tenant
+	alerts template.Alerts
+	body   []byte
+}
+
+// requests returns the requests posted to each endpoint of the alertmanager for the alerts,
+// one request per tenant if a tenant label is configured, split into chunks of at most
+// maxAlertsPerRequest alerts
+func (am *Alertmanager) requests(alerts template.Alerts) ([]request, error) {
+	alerts = annotate(am.logger, am.annotationTemplates, alerts)
+	if am.tenantLabel == "" {
+		return am.chunkedRequests("", alerts)
+	}
+
+	var tenants []string
+	byTenant := make(map[string]template.Alerts)
+	for _, alt := range alerts {
+		tenant := alt.Labels[am.tenantLabel]
+		if tenant == "" {
+			tenant = am.defaultTenant
+		}
+		if _, found := byTenant[tenant]; !found {
+			tenants = append(tenants, tenant)
+		}
+		byTenant[tenant] = append(byTenant[tenant], alt)
+	}
+
+	reqs := make([]request, 0, len(tenants))
+	for _, tenant := range tenants {
+		tenantReqs, err := am.chunkedRequests(tenant, byTenant[tenant])
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, tenantReqs...)
+	}
+	return reqs, nil
+}
+
+// chunkedRequests returns the requests of the tenant with at most maxAlertsPerRequest alerts each
+func (am *Alertmanager) chunkedRequests(tenant string, alerts template.Alerts) ([]request, error) {
+	size := len(alerts)
+	if am.maxAlertsPerRequest > 0 && am.maxAlertsPerRequest < size {
+		size = am.maxAlertsPerRequest
+	}
+
+	var reqs []request
+	for start := 0; start < len(alerts); start += size {
+		end := start + size
+		if end > len(alerts) {
+			end = len(alerts)
+		}
+		body, err := am.encode(alerts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, request{tenant: tenant, alerts: alerts[start:end], body: body})
+	}
+	return reqs, nil
+}
+
+// contentType returns the content type of the payload posted to the alertmanager
+func (am *Alertmanager) contentType() string {
+	if am.encoder != nil {
+		return am.encoder.ContentType()
+	}
+	return "application/json"
+}
+
+// recordResult records whether the last forward to the alertmanager succeeded
+func (am *Alertmanager) recordResult(ok bool) {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	if ok {
+		am.failingSince = time.Time{}
+		return
+	}
+	if am.failingSince.IsZero() {
+		am.failingSince = am.now()
+	}
+}
+
+// ready returns error if the enabled alertmanager has no endpoint, e.g. none was discovered yet,
+// or if it is critical and has been failing for longer than allowed
+func (am *Alertmanager) ready() error {
+	if !am.mirror && !am.disabled.Load() && len(am.currentEndpoints()) == 0 {
+		return fmt.Errorf("alertmanager %v has no endpoints", am)
+	}
+	if !am.critical {
+		return nil
+	}
+
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+
+	if am.failingSince.IsZero() {
+		return nil
+	}
+	if failing := am.now().Sub(am.failingSince); failing > am.unhealthyAfter {
+		return fmt.Errorf("critical alertmanager %v has been failing for %v", am, failing.Round(time.Second))
 	}
 	return nil
 }
 
 // Forwarder forwards alerts to a dynamic set of upstream alertmanagers
 type Forwarder struct {
-	logger        log.Logger
-	alertmanagers []*Alertmanager
-	versions      []APIVersion
+	logger         log.Logger
+	group          string // name of the routing group, empty for the top level
+	alertmanagers  []*Alertmanager
+	receivers      []Receiver
+	limiter        *alertnameLimiter
+	groups         map[string]*Forwarder // routing group name -> forwarder
+	identities     map[string]*Forwarder // client identity -> routing group forwarder
+	archiver       *archiver
+	stats          *statsCollector
+	drainTimeout   time.Duration
+	batcher        *batcher
+	enricher       *k8sEnricher
+	fileEnricher   *fileEnricher
+	runbooks       *runbookInjector
+	severity       *severityNormalizer
+	inhibitor      *inhibitor
+	groupBy        []string
+	resolveTimeout time.Duration
+	maxAnnotation  int      // maximum length of the annotation values, 0 means no limit
+	dropLabels     []string // labels removed before forwarding
+	router         *router
+	resolvedDedup  *resolvedDeduper
+	failFast       bool
+	dedup          bool // endpoints listed by more than one alertmanager are only sent to by the first one
+	sem            semaphore
+	sharding       ShardingConfig
+	ringMtx        sync.Mutex
+	rings          map[string]*hashRing // members -> hash ring of the members
+	flaps          *flapDetector
+	schedules      *scheduler
+	urlRewriter    *urlRewriter
+	firing         *firingTracker
+	rateLimiter    *rateLimiter // shared by the forwarder and its routing groups
+	heartbeatCfg   HeartbeatConfig
+	heartbeat      *heartbeat // started by Run
+	allowEmpty     bool       // running without any alertmanager or receiver is intended
+	runMtx         sync.Mutex
+	stopped        bool
+	onSendResult   func(target string, numAlerts int, err error)
+	redactPayloads bool // whether the labels and annotations of the alerts are kept out of the logs
+	apiProxy       http.Handler
 }
 
 // NewForwarder returns a new forwarder
 func NewForwarder(l log.Logger, amConfigFile string) (*Forwarder, error) {
-	alertCfg, err := loadAlertingConfig(amConfigFile)
+	return NewForwarderWithOptions(l, amConfigFile, Options{})
+}
+
+// NewForwarderWithOptions returns a new forwarder with the programmatic options
+func NewForwarderWithOptions(l log.Logger, amConfigFile string, opts Options) (_ *Forwarder, err error) {
+	alertCfg, err := loadAlertingConfig(amConfigFile, opts.StrictEnv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load configurations of upstream alertmanagers: %v", err)
 	}
 
-	if len(alertCfg.Alertmanagers) == 0 {
-		level.Info(l).Log("msg", "no alertmanager configured")
+	if len(alertCfg.Alertmanagers) == 0 && len(alertCfg.Receivers) == 0 && len(alertCfg.RoutingGroups) == 0 && alertCfg.Archive == nil {
+		if !alertCfg.AllowEmpty {
+			return nil, fmt.Errorf("no alertmanager or receiver configured, set allow_empty to drop all alerts")
+		}
+		level.Warn(l).Log("msg", "no alertmanager or receiver configured, all alerts are dropped")
+	}
+
+	limiter := newAlertnameLimiter(l, alertCfg.MaxAlertnames, time.Duration(alertCfg.AlertnamesWindow), opts.RedactPayloads)
+	fwder, err := newForwarder(l, alertCfg.Alertmanagers, alertCfg.Receivers, limiter)
+	if err != nil {
+		return nil, err
+	}
+	// stop what was started so far, e.g. the health checkers and the watchers, if the configuration is broken
+	defer func() {
+		if err != nil {
+			fwder.Stop()
+		}
+	}()
+
+	rateLimiter, err := newRateLimiter(l, alertCfg.MaxAlertsPerMinute, alertCfg.RateLimitOverflow)
+	if err != nil {
+		return nil, err
+	}
+	fwder.rateLimiter = rateLimiter
+
+	if fwder.archiver, err = newArchiver(l, alertCfg.Archive); err != nil {
+		return nil, err
+	}
+	if fwder.enricher, err = newK8sEnricher(l, alertCfg.K8sEnrich); err != nil {
+		return nil, err
+	}
+	if fwder.fileEnricher, err = newFileEnricher(l, alertCfg.EnrichmentFile); err != nil {
+		return nil, err
+	}
+	if fwder.runbooks, err = newRunbookInjector(l, alertCfg.Runbooks); err != nil {
+		return nil, err
+	}
+	fwder.drainTimeout = time.Duration(alertCfg.DrainTimeout)
+	if fwder.drainTimeout <= 0 {
+		fwder.drainTimeout = defaultDrainTimeout
+	}
+
+	fwder.groups = make(map[string]*Forwarder, len(alertCfg.RoutingGroups))
+	fwder.identities = make(map[string]*Forwarder)
+	for _, gcfg := range alertCfg.RoutingGroups {
+		if gcfg.Name == "" || strings.Contains(gcfg.Name, "/") {
+			return nil, fmt.Errorf("invalid routing group name %q", gcfg.Name)
+		}
+		if _, found := fwder.groups[gcfg.Name]; found {
+			return nil, fmt.Errorf("duplicate routing group name %q", gcfg.Name)
+		}
+		gfwder, err := newForwarder(log.With(l, "group", gcfg.Name), gcfg.Alertmanagers, gcfg.Receivers, limiter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create forwarder for routing group %q: %v", gcfg.Name, err)
+		}
+		gfwder.group = gcfg.Name
+		gfwder.archiver = fwder.archiver
+		gfwder.stats = fwder.stats
+		gfwder.enricher = fwder.enricher
+		gfwder.fileEnricher = fwder.fileEnricher
+		gfwder.runbooks = fwder.runbooks
+		fwder.groups[gcfg.Name] = gfwder
+
+		for _, id := range gcfg.ClientIdentities {
+			if _, found := fwder.identities[id]; found {
+				return nil, fmt.Errorf("client identity %q is bound to more than one routing group", id)
+			}
+			fwder.identities[id] = gfwder
+		}
+	}
+
+	sem := newSemaphore(alertCfg.MaxConcurrentForwards)
+	for _, f := range fwder.all() {
+		f.sem = sem
+		f.dedupEndpoints(alertCfg.DedupEndpoints)
+		f.failFast = alertCfg.FailFast
+		f.rateLimiter = rateLimiter
+		f.onSendResult = opts.OnSendResult
+		f.redactPayloads = opts.RedactPayloads
+		f.groupBy = alertCfg.GroupBy
+		f.sharding = alertCfg.Sharding
+		f.resolveTimeout = time.Duration(alertCfg.ResolveTimeout)
+		f.maxAnnotation = alertCfg.MaxAnnotationLength
+		f.dropLabels = alertCfg.DropLabels
+		f.severity = newSeverityNormalizer(alertCfg.SeverityMapping)
+		if f.urlRewriter, err = newURLRewriter(alertCfg.GeneratorURLRewrite); err != nil {
+			return nil, err
+		}
+		if f.inhibitor, err = newInhibitor(f.logger, alertCfg.InhibitRules, f.resolveTimeout, f.redactPayloads); err != nil {
+			return nil, err
+		}
+		f.flaps = newFlapDetector(f.logger, alertCfg.FlapDetection, f.redactPayloads)
+		f.resolvedDedup = newResolvedDeduper(f.logger, time.Duration(alertCfg.ResolvedDedupWindow), alertCfg.DedupLabels, f.redactPayloads)
+		f.firing = newFiringTracker(alertCfg.ResolveOnShutdown)
+		f.batcher = newBatcher(f.logger, time.Duration(alertCfg.BatchWindow), alertCfg.MaxBatchSize, alertCfg.DedupLabels, f.send)
+		if f.schedules, err = newScheduler(f.logger, alertCfg.Schedules, f.release); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, enc := range opts.Encoders {
+		var found bool
+		for _, f := range fwder.all() {
+			for _, am := range f.alertmanagers {
+				if am.name == name {
+					am.encoder = enc
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("custom encoder registered for unknown alertmanager %q", name)
+		}
+	}
+
+	for name, src := range opts.TokenSources {
+		var found bool
+		for _, f := range fwder.all() {
+			for _, am := range f.alertmanagers {
+				if am.name == name {
+					am.client.Transport = &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, src), Base: am.client.Transport}
+					found = true
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("token source registered for unknown alertmanager %q", name)
+		}
+	}
+
+	if alertCfg.APIProxy != "" {
+		am, err := fwder.findAlertmanager(alertCfg.APIProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid api_proxy: %v", err)
+		}
+		fwder.apiProxy = newAPIProxy(am)
+	}
+
+	targets := make(map[string]bool)
+	for _, f := range fwder.all() {
+		for _, am := range f.alertmanagers {
+			if am.name != "" {
+				targets[am.name] = true
+			}
+		}
+		for _, r := range f.receivers {
+			targets[r.Name()] = true
+		}
+	}
+	if fwder.router, err = newRouter(l, opts.RoutingConfigFile, targets); err != nil {
+		return nil, err
+	}
+	for _, gfwder := range fwder.groups {
+		gfwder.router = fwder.router
+	}
+	fwder.heartbeatCfg = alertCfg.Heartbeat
+	fwder.allowEmpty = alertCfg.AllowEmpty
+
+	var receivers []lastSuccessKey
+	for _, f := range fwder.all() {
+		for _, am := range f.alertmanagers {
+			receivers = append(receivers, f.lastSuccessKey(am.id))
+		}
+		for _, r := range f.receivers {
+			receivers = append(receivers, f.lastSuccessKey(r.Name()))
+		}
 	}
+	lastSuccess.reset(receivers)
 
-	var alertmanagers []*Alertmanager
-	for _, amcfg := range alertCfg.Alertmanagers {
+	return fwder, nil
+}
+
+// lastSuccessKey returns the key of the alertmanager or receiver of the forwarder in the last success metric
+func (fwder *Forwarder) lastSuccessKey(name string) lastSuccessKey {
+	return lastSuccessKey{group: fwder.group, receiver: name}
+}
+
+// newForwarder returns a new forwarder for the given alertmanagers and receivers
+func newForwarder(l log.Logger, amcfgs []AlertmanagerConfig, rcfgs []ReceiverConfig, limiter *alertnameLimiter) (*Forwarder, error) {
+	fwder := &Forwarder{
+		logger:       l,
+		limiter:      limiter,
+		stats:        newStatsCollector(),
+		drainTimeout: defaultDrainTimeout,
+	}
+	for i, amcfg := range amcfgs {
 		am, err := NewAlertmanager(l, amcfg)
 		if err != nil {
+			fwder.Stop()
 			return nil, fmt.Errorf("failed to create alertmanager client from configuration: %v", err)
 		}
-		alertmanagers = append(alertmanagers, am)
+		am.id = am.name
+		if am.id == "" {
+			am.id = fmt.Sprintf("alertmanagers[%d]", i)
+		}
+		fwder.alertmanagers = append(fwder.alertmanagers, am)
 	}
 
-	var (
-		versions       []APIVersion
-		versionPresent map[APIVersion]bool
-	)
-	for _, am := range alertmanagers {
-		if _, found := versionPresent[am.version]; found {
-			continue
+	for _, rcfg := range rcfgs {
+		r, err := newReceiver(l, rcfg)
+		if err != nil {
+			fwder.Stop()
+			return nil, fmt.Errorf("failed to create receiver from configuration: %v", err)
+		}
+		fwder.receivers = append(fwder.receivers, r)
+	}
+	return fwder, nil
+}
+
+// ForIdentity returns the forwarder of the routing group bound to one of the client identities,
+// or the forwarder itself if none matches
+func (fwder *Forwarder) ForIdentity(ids []string) *Forwarder {
+	for _, id := range ids {
+		if gfwder, found := fwder.identities[id]; found {
+			return gfwder
 		}
-		versions = append(versions, am.version)
 	}
+	return fwder
+}
 
-	return &Forwarder{
-		logger:        l,
-		alertmanagers: alertmanagers,
-		versions:      versions,
-	}, nil
+// TakeStats returns the alert counts since the last call and resets them
+func (fwder *Forwarder) TakeStats() Stats {
+	return fwder.stats.take()
 }
 
-// Forward an alert batch to all given Alertmanager
-func (fwder *Forwarder) Forward(ctx context.Context, alerts template.Alerts) error {
+// Stop flushes the alerts pending in the forwarder within the drain timeout,
+// alerts that can't be flushed in time are dropped. The forwarder must not be used afterwards.
+func (fwder *Forwarder) Stop() {
+	fwder.stop(false)
+}
+
+// Run starts forwarding the heartbeat alert if it is configured, forwarders only built to validate
+// the configuration or to send test alerts are never run. It does nothing once the forwarder is stopped.
+func (fwder *Forwarder) Run() {
+	fwder.runMtx.Lock()
+	defer fwder.runMtx.Unlock()
+	if fwder.stopped || fwder.heartbeat != nil {
+		return
+	}
+	fwder.heartbeat = newHeartbeat(fwder.logger, fwder.heartbeatCfg, fwder.Forward)
+}
+
+// Shutdown stops the forwarder like Stop on process shutdown, the forwarded firing alerts
+// are resolved after the pending alerts are flushed if resolve_on_shutdown is set
+func (fwder *Forwarder) Shutdown() {
+	fwder.stop(true)
+}
+
+// stop flushes the pending alerts and stops the forwarder, resolving the forwarded firing alerts if set
+func (fwder *Forwarder) stop(resolve bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), fwder.drainTimeout)
+	defer cancel()
+
+	fwder.runMtx.Lock()
+	fwder.stopped = true
+	hb := fwder.heartbeat
+	fwder.runMtx.Unlock()
+	hb.stop()
+	fwder.rateLimiter.stop()
+	for _, f := range fwder.all() {
+		f.schedules.stop()
+		f.batcher.stop(ctx)
+		if resolve {
+			f.resolveFiring(ctx)
+		}
+		for _, am := range f.alertmanagers {
+			am.stop()
+		}
+		for _, r := range f.receivers {
+			if sr, ok := r.(stoppableReceiver); ok {
+				sr.stop(ctx)
+			}
+		}
+	}
+	fwder.archiver.stop(ctx)
+	fwder.enricher.stop()
+	fwder.fileEnricher.stop()
+	fwder.runbooks.stop()
+	fwder.router.stop()
+}
+
+// resolveFiring sends the forwarded firing alerts as resolved
+func (fwder *Forwarder) resolveFiring(ctx context.Context) {
+	alerts := fwder.firing.resolved(time.Now())
 	if len(alerts) == 0 {
-		level.Warn(fwder.logger).Log("msg", "no alert to forward")
+		return
+	}
+	level.Info(fwder.logger).Log("msg", "resolving the forwarded firing alerts on shutdown", "numAlerts", len(alerts))
+	if err := fwder.send(ctx, alerts); err != nil {
+		level.Warn(fwder.logger).Log("msg", "resolving the forwarded firing alerts on shutdown failed", "numAlerts", len(alerts), "err", err)
+	}
+}
+
+// ReloadRouting reloads the routing rules from the routing configuration file,
+// the current rules are kept if the file is invalid
+func (fwder *Forwarder) ReloadRouting() error {
+	if fwder.router == nil {
 		return nil
 	}
+	return fwder.router.reload()
+}
 
-	payload := make(map[APIVersion][]byte)
-	for _, version := range fwder.versions {
-		var (
-			b   []byte
-			err error
-		)
-		switch version {
-		case APIv1:
-			if b, err = json.Marshal(alerts); err != nil {
-				level.Warn(fwder.logger).Log("msg", "encoding alerts for v1 API failed", "err", err)
-				return err
-			}
-		case APIv2:
-			pAlerts := make(models.PostableAlerts, 0, len(alerts))
-			for _, alt := range alerts {
-				pAlerts = append(pAlerts, &models.PostableAlert{
-					Annotations: kvToLabelSet(alt.Annotations),
-					EndsAt:      strfmt.DateTime(alt.EndsAt),
-					StartsAt:    strfmt.DateTime(alt.StartsAt),
-					Alert: models.Alert{
-						GeneratorURL: strfmt.URI(alt.GeneratorURL),
-						Labels:       kvToLabelSet(alt.Labels),
-					},
-				})
+// all returns the forwarder and the forwarders of its routing groups
+func (fwder *Forwarder) all() []*Forwarder {
+	all := []*Forwarder{fwder}
+	for _, gfwder := range fwder.groups {
+		all = append(all, gfwder)
+	}
+	return all
+}
+
+// dedupEndpoints detects static endpoints listed by more than one alertmanager and removes them from all
+// but the first alertmanager if remove is set. The discovered endpoints change over time, if remove is set
+// they are deduplicated when the alerts are sent instead, see unsharedEndpoints.
+func (fwder *Forwarder) dedupEndpoints(remove bool) {
+	fwder.dedup = remove
+	seen := make(map[string]bool)
+	for _, am := range fwder.alertmanagers {
+		var endpoints []*url.URL
+		for _, u := range am.endpoints {
+			alertsURL := am.alertsURL(*u)
+			if !seen[alertsURL.String()] {
+				seen[alertsURL.String()] = true
+				endpoints = append(endpoints, u)
+				continue
 			}
-			if b, err = json.Marshal(pAlerts); err != nil {
-				level.Warn(fwder.logger).Log("msg", "encoding alerts for v2 API failed", "err", err)
-				return err
+			if !remove {
+				level.Warn(fwder.logger).Log("msg", "endpoint is listed by more than one alertmanager, alerts may be sent to it more than once", "endpoint", u.String())
+				endpoints = append(endpoints, u)
+				continue
 			}
+			level.Info(fwder.logger).Log("msg", "endpoint is listed by more than one alertmanager, removing duplicate", "endpoint", u.String(), "alertmanager", am.name)
+		}
+		// the health checker of the alertmanager is already reading the endpoints
+		am.epMtx.Lock()
+		am.endpoints = endpoints
+		am.trackEndpoints()
+		am.epMtx.Unlock()
+	}
+}
+
+// unsharedEndpoints returns the endpoints of the alertmanager without the endpoints the alertmanagers
+// listed before it send the alerts to, nor the endpoints it lists twice, if the endpoints are deduplicated
+func (fwder *Forwarder) unsharedEndpoints(am *Alertmanager, endpoints []*url.URL) []*url.URL {
+	if !fwder.dedup {
+		return endpoints
+	}
+	seen := make(map[string]bool)
+	for _, other := range fwder.alertmanagers {
+		if other == am {
+			break
+		}
+		for _, u := range other.currentEndpoints() {
+			alertsURL := other.alertsURL(*u)
+			seen[alertsURL.String()] = true
+		}
+	}
+	unshared := make([]*url.URL, 0, len(endpoints))
+	for _, u := range endpoints {
+		alertsURL := am.alertsURL(*u)
+		if !seen[alertsURL.String()] {
+			seen[alertsURL.String()] = true
+			unshared = append(unshared, u)
+		}
+	}
+	return unshared
+}
+
+// Groups returns the forwarders of the configured routing groups keyed by group name
+func (fwder *Forwarder) Groups() map[string]*Forwarder {
+	return fwder.groups
+}
+
+// Forward an alert batch to all given Alertmanager,
+// the alerts are only buffered if batching is enabled and sent once the batch is flushed
+func (fwder *Forwarder) Forward(ctx context.Context, alerts template.Alerts) error {
+	fwder.stats.received(len(alerts))
+	numReceived := len(alerts)
+	alerts = deriveStatus(alerts, time.Now())
+	alerts = fwder.severity.normalize(alerts)
+	alerts = fwder.limiter.filter(alerts)
+	alerts = fwder.router.relabel(alerts)
+	alerts = fwder.router.drop(alerts)
+	alerts = fwder.resolvedDedup.filter(alerts)
+	alerts = fwder.flaps.filter(alerts)
+	alerts = fwder.inhibitor.filter(alerts)
+	fwder.stats.dropped(numReceived - len(alerts))
+	if len(alerts) == 0 {
+		level.Warn(fwder.logger).Log("msg", "no alert to forward")
+		return nil
+	}
+
+	alerts = fwder.enricher.enrich(alerts)
+	alerts = fwder.fileEnricher.enrich(alerts)
+	alerts = fwder.runbooks.inject(alerts)
+	alerts = fwder.urlRewriter.rewrite(alerts)
+	alerts = truncateAnnotations(alerts, fwder.maxAnnotation)
+	alerts = dropLabels(alerts, fwder.dropLabels)
+	alerts = extendEndsAt(alerts, fwder.resolveTimeout, time.Now())
+	alerts = fwder.schedules.hold(alerts)
+	return fwder.release(ctx, alerts)
+}
+
+// release delivers the alerts fitting into the rate limit, critical alerts first. The alerts held
+// back by the schedules are only charged against the limit once their window opens and they are
+// released, the alerts beyond the limit are dropped or buffered by severity with the received ones.
+func (fwder *Forwarder) release(ctx context.Context, alerts template.Alerts) error {
+	alerts = fwder.rateLimiter.allow(fwder, alerts)
+	if len(alerts) == 0 {
+		return nil
+	}
+	return fwder.deliver(ctx, alerts)
+}
+
+// deliver adds the alerts to the pending batch if batching is enabled, otherwise it sends them
+func (fwder *Forwarder) deliver(ctx context.Context, alerts template.Alerts) error {
+	if fwder.batcher != nil {
+		fwder.batcher.add(alerts)
+		return nil
+	}
+	return fwder.send(ctx, alerts)
+}
+
+// SetAlertmanagerEnabled enables or disables forwarding to the alertmanager with the index in the
+// alertmanagers of the configuration, the state is lost when the configuration is reloaded
+func (fwder *Forwarder) SetAlertmanagerEnabled(index int, enabled bool) error {
+	if index < 0 || index >= len(fwder.alertmanagers) {
+		return fmt.Errorf("no alertmanager with index %d", index)
+	}
+	am := fwder.alertmanagers[index]
+	am.disabled.Store(!enabled)
+	level.Info(fwder.logger).Log("msg", "alertmanager state changed at runtime", "alertmanager", am, "index", index, "enabled", enabled)
+	return nil
+}
+
+// Normalize applies the transformations of Forward to the alerts without forwarding them,
+// the filters depending on previously received alerts aren't applied
+func (fwder *Forwarder) Normalize(alerts template.Alerts) template.Alerts {
+	alerts = deriveStatus(alerts, time.Now())
+	alerts = fwder.severity.normalize(alerts)
+	alerts = fwder.router.relabel(alerts)
+	alerts = fwder.enricher.enrich(alerts)
+	alerts = fwder.fileEnricher.enrich(alerts)
+	alerts = fwder.runbooks.inject(alerts)
+	alerts = fwder.urlRewriter.rewrite(alerts)
+	alerts = truncateAnnotations(alerts, fwder.maxAnnotation)
+	alerts = dropLabels(alerts, fwder.dropLabels)
+	return extendEndsAt(alerts, fwder.resolveTimeout, time.Now())
+}
+
+// send forwards the alerts, as one batch per group if group_by is configured
+func (fwder *Forwarder) send(ctx context.Context, alerts template.Alerts) error {
+	if len(fwder.groupBy) == 0 {
+		return fwder.sendBatch(ctx, alerts)
+	}
+	var errs []string
+	for _, g := range groupAlerts(alerts, fwder.groupBy) {
+		if err := fwder.sendBatch(ctx, g); err != nil {
+			errs = append(errs, err.Error())
 		}
-		payload[version] = b
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send %d of the alert groups: %s", len(errs), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sendBatch sends the alerts to all alertmanagers and receivers
+func (fwder *Forwarder) sendBatch(ctx context.Context, alerts template.Alerts) error {
+	if fwder.failFast && fwder.allCircuitsOpen() {
+		level.Warn(fwder.logger).Log("msg", "circuit breakers of all alertmanager endpoints are open, failing fast", "numAlerts", len(alerts))
+		return fmt.Errorf("failed to send %d alerts: circuit breakers of all alertmanager endpoints are open", len(alerts))
 	}
 
 	var (
-		wg         sync.WaitGroup
-		numSuccess atomic.Uint64
+		wg        sync.WaitGroup
+		received  = newDeliveries() // by the receivers
+		forwarded = newDeliveries() // by the alertmanagers
+		amSuccess = make([]atomic.Bool, len(fwder.alertmanagers))
+		attempted = make([]bool, len(fwder.alertmanagers))
 	)
-	for _, am := range fwder.alertmanagers {
-		for _, u := range am.endpoints {
-			wg.Add(1)
-			go func(am *Alertmanager, u url.URL) {
-				defer wg.Done()
-
-				level.Debug(fwder.logger).Log("msg", "forward alerts", "alertmanager", u.Host, "numAlerts", len(alerts))
-				u.Path = path.Join(u.Path, fmt.Sprintf("/api/%s/alerts", string(am.version)))
-
-				if err := am.postAlerts(ctx, u, bytes.NewReader(payload[am.version])); err != nil {
-					level.Warn(fwder.logger).Log(
-						"msg", "forwarding alerts failed",
-						"alertmanager", u.Host,
-						"alerts", string(payload[am.version]),
-						"err", err,
-					)
-					return
-				}
-				numSuccess.Inc()
-			}(am, *u)
+	for _, r := range fwder.receivers {
+		alerts := fwder.router.selectFor(r.Name(), alerts)
+		if len(alerts) == 0 {
+			// nothing to send to the receiver, neither a success nor a failure
+			continue
+		}
+		received.attempt(alerts)
+		wg.Add(1)
+		go func(r Receiver, alerts template.Alerts) {
+			defer wg.Done()
+
+			ctx, span := tracing.Tracer().Start(ctx, "receiver.send", trace.WithAttributes(attribute.String("receiver", r.Name())))
+			defer span.End()
+
+			level.Debug(fwder.logger).Log("msg", "forward alerts", "receiver", r.Name(), "numAlerts", len(alerts))
+			err := fwder.sem.acquire(ctx)
+			if err == nil {
+				err = r.Send(ctx, alerts)
+				fwder.sem.release()
+			}
+			fwder.sendResult(r.Name(), len(alerts), err)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				level.Warn(fwder.logger).Log("msg", "forwarding alerts failed", "receiver", r.Name(), "err", err)
+				fwder.stats.failed(r.Name(), len(alerts))
+				return
+			}
+			lastSuccess.success(fwder.lastSuccessKey(r.Name()))
+			received.deliver(alerts)
+		}(r, alerts)
+	}
+	for i, am := range fwder.alertmanagers {
+		if am.mirror && !am.disabled.Load() {
+			attempted[i] = fwder.sendToAlertmanager(ctx, &wg, am, alerts, nil, &amSuccess[i], nil)
+		}
+	}
+	// the alertmanagers of a priority are only sent the alerts none of the alertmanagers
+	// of the preferred priorities delivered
+	tiers := priorityTiers(fwder.alertmanagers)
+	remaining := alerts
+	for t, tier := range tiers {
+		var tierWg sync.WaitGroup
+		ring := fwder.ringFor(tier)
+		for _, i := range tier {
+			if fwder.sendToAlertmanager(ctx, &tierWg, fwder.alertmanagers[i], remaining, ring, &amSuccess[i], forwarded) {
+				attempted[i] = true
+			}
+		}
+		tierWg.Wait()
+		if remaining = forwarded.undelivered(remaining); len(remaining) == 0 {
+			break
+		}
+		if failed := forwarded.failed(remaining); len(failed) > 0 && t < len(tiers)-1 {
+			level.Warn(fwder.logger).Log("msg", "forwarding alerts to the alertmanagers of the priority failed, failing over", "priority", fwder.alertmanagers[tier[0]].priority, "numAlerts", len(failed))
 		}
 	}
 	wg.Wait()
 
-	if numSuccess.Load() > 0 {
+	for i, am := range fwder.alertmanagers {
+		if attempted[i] {
+			am.recordResult(amSuccess[i].Load())
+		}
+	}
+	fwder.archiver.add(alerts)
+
+	// an alert is lost if it was sent to alertmanagers or receivers and none of them accepted it,
+	// none of the alerts being for any of the targets isn't a failure
+	forwarded.merge(received)
+	if failed := forwarded.failed(alerts); len(failed) > 0 {
+		level.Warn(fwder.logger).Log("msg", "failed to send alerts to all alertmanagers", "numAlerts", len(failed))
+		return fmt.Errorf("failed to send %d of the %d alerts to all alertmanagers", len(failed), len(alerts))
+	}
+	// the archive is the only sink if neither alertmanagers nor receivers are configured
+	archiveOnly := len(fwder.alertmanagers) == 0 && len(fwder.receivers) == 0 && fwder.archiver != nil
+	if !forwarded.attempted() && !archiveOnly && len(fwder.receivers) == 0 && len(tiers) == 0 {
+		level.Warn(fwder.logger).Log("msg", "failed to send alerts, no alertmanager is enabled", "numAlerts", len(alerts))
+		return fmt.Errorf("failed to send %d alerts to all alertmanagers", len(alerts))
+	}
+	fwder.stats.forwarded(len(alerts))
+	fwder.firing.track(alerts)
+	return nil
+}
+
+// sendToAlertmanager sends the alerts to each endpoint of the alertmanager in the background, only the
+// alerts the hash ring assigns to the alertmanager if it is set. The sent alerts are recorded in d, and as
+// delivered once an endpoint accepted them. It returns false without sending anything if none of the
+// alerts are for the alertmanager.
+func (fwder *Forwarder) sendToAlertmanager(ctx context.Context, wg *sync.WaitGroup, am *Alertmanager, alerts template.Alerts, ring *hashRing, amSuccess *atomic.Bool, d *deliveries) bool {
+	alerts = ring.selectFor(am.String(), fwder.router.selectFor(am.name, am.filter(alerts)))
+	if len(alerts) == 0 {
+		return false
+	}
+	endpoints := am.currentEndpoints()
+	if len(endpoints) > 0 {
+		if endpoints = fwder.unsharedEndpoints(am, endpoints); len(endpoints) == 0 {
+			// the alertmanagers listed before send the alerts to all the endpoints
+			return false
+		}
+	}
+	d.attempt(alerts)
+	if len(endpoints) == 0 {
+		level.Warn(fwder.logger).Log("msg", "forwarding alerts failed, the alertmanager has no endpoints", "alertmanager", am)
+		fwder.stats.failed(am.String(), len(alerts))
+		fwder.sendResult(am.String(), len(alerts), fmt.Errorf("alertmanager %v has no endpoints", am))
+		return true
+	}
+	reqs, err := am.requests(alerts)
+	if err != nil {
+		level.Warn(fwder.logger).Log("msg", "encoding alerts failed", "alertmanager", am, "version", am.version, "err", err)
+		fwder.stats.failed(am.String(), len(alerts))
+		fwder.sendResult(am.String(), len(alerts), err)
+		return true
+	}
+	delivered := func() {
+		lastSuccess.success(fwder.lastSuccessKey(am.id))
+		amSuccess.Store(true)
+		d.deliver(alerts)
+	}
+
+	if am.cluster {
+		// the members of a cluster gossip the alerts, sending them to one member is enough
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if fwder.sendToCluster(ctx, am, endpoints, reqs) {
+				delivered()
+			}
+		}()
+		return true
+	}
+	for _, u := range endpoints {
+		cb := am.breaker(u)
+		if !cb.allow() {
+			level.Warn(fwder.logger).Log("msg", "circuit breaker is open, skipping endpoint", "alertmanager", u.Host)
+			continue
+		}
+		wg.Add(1)
+		go func(u *url.URL, cb *circuitBreaker) {
+			defer wg.Done()
+			if fwder.sendToEndpoint(ctx, am, u, cb, reqs) {
+				delivered()
+			}
+		}(u, cb)
+	}
+	return true
+}
+
+// sendToCluster sends the requests to one member of the alertmanager cluster, starting with the member
+// that accepted the last requests and failing over to the next members, it reports whether a member accepted them
+func (fwder *Forwarder) sendToCluster(ctx context.Context, am *Alertmanager, members []*url.URL, reqs []request) bool {
+	first := int(am.clusterMember.Load()) % len(members)
+	for n := 0; n < len(members); n++ {
+		i := (first + n) % len(members)
+		u := members[i]
+		cb := am.breaker(u)
+		if !cb.allow() {
+			level.Warn(fwder.logger).Log("msg", "circuit breaker is open, skipping cluster member", "alertmanager", u.Host)
+			continue
+		}
+		if fwder.sendToEndpoint(ctx, am, u, cb, reqs) {
+			am.clusterMember.Store(uint64(i))
+			return true
+		}
+		if n < len(members)-1 {
+			level.Warn(fwder.logger).Log("msg", "forwarding alerts to cluster member failed, failing over to the next member", "alertmanager", u.Host)
+		}
+	}
+	return false
+}
+
+// sendToEndpoint posts the requests to the endpoint of the alertmanager and records the result
+// in the circuit breaker, it reports whether all requests were accepted
+func (fwder *Forwarder) sendToEndpoint(ctx context.Context, am *Alertmanager, endpoint *url.URL, cb *circuitBreaker, reqs []request) bool {
+	var numAlerts int
+	for _, req := range reqs {
+		numAlerts += len(req.alerts)
+	}
+	level.Debug(fwder.logger).Log("msg", "forward alerts", "alertmanager", endpoint.Host, "numAlerts", numAlerts)
+	if am.endpointTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, am.endpointTimeout)
+		defer cancel()
+	}
+	u := am.alertsURL(*endpoint)
+
+	var failed error
+	defer func() { fwder.sendResult(u.Host, numAlerts, failed) }()
+	for _, req := range reqs {
+		if err := fwder.post(ctx, am, u, req); err != nil {
+			if am.mirror {
+				// failures of a mirror don't affect the delivery
+				level.Warn(fwder.logger).Log("msg", "forwarding alerts to mirror failed", "alertmanager", u.Host, "tenant", req.tenant, "err", err)
+				failed = err
+				continue
+			}
+			if fwder.redactPayloads {
+				level.Warn(fwder.logger).Log(
+					"msg", "forwarding alerts failed",
+					"alertmanager", u.Host,
+					"tenant", req.tenant,
+					"numAlerts", len(req.alerts),
+					"fingerprints", strings.Join(fingerprints(req.alerts), ","),
+					"err", err,
+				)
+			} else {
+				level.Warn(fwder.logger).Log(
+					"msg", "forwarding alerts failed",
+					"alertmanager", u.Host,
+					"tenant", req.tenant,
+					"alerts", string(req.body),
+					"err", err,
+				)
+			}
+			fwder.stats.failed(am.String(), len(req.alerts))
+			failed = err
+		}
+	}
+	if failed != nil {
+		cb.failure()
+		upstreamUp.WithLabelValues(endpoint.String()).Set(0)
+		return false
+	}
+	cb.success()
+	upstreamUp.WithLabelValues(endpoint.String()).Set(1)
+	upstreamLastSuccess.WithLabelValues(endpoint.String()).SetToCurrentTime()
+	return true
+}
+
+// sendResult reports the result of a send to the target to the OnSendResult callback if it is set
+func (fwder *Forwarder) sendResult(target string, numAlerts int, err error) {
+	if fwder.onSendResult != nil {
+		fwder.onSendResult(target, numAlerts, err)
+	}
+}
+
+// priorityTiers returns the indexes of the enabled alertmanagers other than mirrors grouped by priority,
+// the preferred priority (lowest value) first
+func priorityTiers(ams []*Alertmanager) [][]int {
+	byPriority := make(map[int][]int)
+	var priorities []int
+	for i, am := range ams {
+		if am.mirror || am.disabled.Load() {
+			continue
+		}
+		if _, found := byPriority[am.priority]; !found {
+			priorities = append(priorities, am.priority)
+		}
+		byPriority[am.priority] = append(byPriority[am.priority], i)
+	}
+	sort.Ints(priorities)
+
+	tiers := make([][]int, 0, len(priorities))
+	for _, p := range priorities {
+		tiers = append(tiers, byPriority[p])
+	}
+	return tiers
+}
+
+// ringFor returns the hash ring distributing the alerts across the alertmanagers of the priority tier,
+// nil if sharding is not configured. The rings are cached as the enabled alertmanagers rarely change.
+func (fwder *Forwarder) ringFor(tier []int) *hashRing {
+	if fwder.sharding.Label == "" {
 		return nil
 	}
-	level.Warn(fwder.logger).Log("msg", "failed to send alerts to all alertmanagers", "numAlerts", len(alerts))
-	return fmt.Errorf("failed to send %d alerts to all alertmanagers", len(alerts))
+	members := make([]string, 0, len(tier))
+	for _, i := range tier {
+		members = append(members, fwder.alertmanagers[i].String())
+	}
+	key := strings.Join(members, "\x00")
+
+	fwder.ringMtx.Lock()
+	defer fwder.ringMtx.Unlock()
+	if r, found := fwder.rings[key]; found {
+		return r
+	}
+	if fwder.rings == nil {
+		fwder.rings = make(map[string]*hashRing)
+	}
+	r := newHashRing(fwder.sharding, members)
+	fwder.rings[key] = r
+	return r
+}
+
+// post posts the request to the alertmanager endpoint once a slot of the concurrency limit is free
+func (fwder *Forwarder) post(ctx context.Context, am *Alertmanager, u url.URL, req request) error {
+	if err := fwder.sem.acquire(ctx); err != nil {
+		return err
+	}
+	defer fwder.sem.release()
+	payloadBytes.WithLabelValues(am.String()).Observe(float64(len(req.body)))
+	return am.postAlerts(ctx, u, req.tenant, fingerprints(req.alerts), bytes.NewReader(req.body))
+}
+
+// fingerprints returns the fingerprints of the alerts
+func fingerprints(alerts template.Alerts) []string {
+	fps := make([]string, 0, len(alerts))
+	for _, alt := range alerts {
+		fps = append(fps, Fingerprint(alt))
+	}
+	return fps
+}
+
+// alertKeyvals appends the alertname of the alert to the log key-values identifying it,
+// unless the payloads are redacted and the alert is only identified by its fingerprint
+func alertKeyvals(redact bool, alt template.Alert, keyvals ...interface{}) []interface{} {
+	if redact {
+		return keyvals
+	}
+	return append(keyvals, "alertname", alt.Labels[model.AlertNameLabel])
+}
+
+// allCircuitsOpen reports whether no alertmanager endpoint would currently accept a request,
+// receivers have no circuit breaker and are always considered reachable, mirrors and disabled alertmanagers are ignored
+func (fwder *Forwarder) allCircuitsOpen() bool {
+	if len(fwder.receivers) > 0 {
+		return false
+	}
+	var primaries int
+	for _, am := range fwder.alertmanagers {
+		if am.mirror || am.disabled.Load() {
+			continue
+		}
+		primaries++
+		endpoints := am.currentEndpoints()
+		if len(endpoints) == 0 {
+			return false
+		}
+		for _, u := range endpoints {
+			if !am.breaker(u).open() {
+				return false
+			}
+		}
+	}
+	return primaries > 0
+}
+
+// Ready returns error if there is no target to forward the alerts to unless allow_empty is set, if an alertmanager
+// has no endpoints, or if any critical alertmanager has been failing for longer than its threshold
+func (fwder *Forwarder) Ready() error {
+	if len(fwder.alertmanagers) == 0 && len(fwder.receivers) == 0 && len(fwder.groups) == 0 && fwder.archiver == nil && !fwder.allowEmpty {
+		return fmt.Errorf("no alertmanager or receiver configured")
+	}
+	for _, am := range fwder.alertmanagers {
+		if err := am.ready(); err != nil {
+			return err
+		}
+	}
+	for _, gfwder := range fwder.groups {
+		if err := gfwder.Ready(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fingerprint returns the fingerprint of the alert, a hash of its sorted labels. The fingerprint set by
+// the sender is ignored, so the same alert gets the same fingerprint whoever sends it.
+func Fingerprint(alt template.Alert) string {
+	ls := make(model.LabelSet, len(alt.Labels))
+	for k, v := range alt.Labels {
+		ls[model.LabelName(k)] = model.LabelValue(v)
+	}
+	return ls.Fingerprint().String()
 }
 
 // kvToLabelSet translate KC to LabelSet
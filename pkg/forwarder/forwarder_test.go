@@ -0,0 +1,989 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/version"
+)
+
+// testAlertmanager is an upstream alertmanager recording the alerts posted to it
+type testAlertmanager struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	status   int
+	requests []*http.Request
+	alerts   []string            // alertnames of the received alerts
+	tenants  map[string][]string // alertnames of the received alerts by X-Scope-OrgID header
+}
+
+// newTestAlertmanager returns a started test alertmanager answering with the status
+func newTestAlertmanager(t *testing.T, status int) *testAlertmanager {
+	t.Helper()
+	am := &testAlertmanager{status: status, tenants: make(map[string][]string)}
+	am.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts models.PostableAlerts
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("failed to decode the posted alerts: %v", err)
+		}
+		am.mtx.Lock()
+		am.requests = append(am.requests, r)
+		tenant := r.Header.Get(tenantHeader)
+		for _, alt := range alerts {
+			am.alerts = append(am.alerts, alt.Labels["alertname"])
+			am.tenants[tenant] = append(am.tenants[tenant], alt.Labels["alertname"])
+		}
+		status := am.status
+		am.mtx.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(am.Close)
+	return am
+}
+
+// addr returns the host:port address of the test alertmanager
+func (am *testAlertmanager) addr() string {
+	return strings.TrimPrefix(am.URL, "http://")
+}
+
+// received returns the alertnames of the received alerts
+func (am *testAlertmanager) received() []string {
+	am.mtx.Lock()
+	defer am.mtx.Unlock()
+	return append([]string(nil), am.alerts...)
+}
+
+// writeFile writes the content to a file of the test temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+// newTestForwarder returns a forwarder of the alerting configuration, stopped at the end of the test
+func newTestForwarder(t *testing.T, config string) *Forwarder {
+	t.Helper()
+	fwder, err := NewForwarder(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", config))
+	if err != nil {
+		t.Fatalf("failed to create the forwarder: %v", err)
+	}
+	t.Cleanup(fwder.Stop)
+	return fwder
+}
+
+// firing returns firing alerts with the alertnames
+func firing(names ...string) template.Alerts {
+	alerts := make(template.Alerts, 0, len(names))
+	for _, name := range names {
+		alerts = append(alerts, template.Alert{
+			Labels:   template.KV{"alertname": name},
+			StartsAt: time.Now().Add(-time.Minute),
+		})
+	}
+	return alerts
+}
+
+// resolved returns resolved alerts with the alertnames
+func resolved(names ...string) template.Alerts {
+	alerts := firing(names...)
+	for i := range alerts {
+		alerts[i].EndsAt = time.Now().Add(-time.Second)
+	}
+	return alerts
+}
+
+// withSeverity returns a firing alert with the alertname and severity
+func withSeverity(name, severity string) template.Alert {
+	alt := firing(name)[0]
+	alt.Labels["severity"] = severity
+	return alt
+}
+
+// statuses of the alerts derived by the forwarder
+const (
+	statusFiring   = string(model.AlertFiring)
+	statusResolved = string(model.AlertResolved)
+)
+
+// withStatus returns an alert with the alertname, status and extra labels
+func withStatus(name, status string, labels ...string) template.Alert {
+	alt := template.Alert{Status: status, Labels: template.KV{"alertname": name}}
+	for i := 0; i+1 < len(labels); i += 2 {
+		alt.Labels[labels[i]] = labels[i+1]
+	}
+	return alt
+}
+
+// withAnnotations returns a firing alert with the alertname and the annotations
+func withAnnotations(name string, annotations ...string) template.Alert {
+	alt := withStatus(name, statusFiring)
+	alt.Annotations = template.KV{}
+	for i := 0; i+1 < len(annotations); i += 2 {
+		alt.Annotations[annotations[i]] = annotations[i+1]
+	}
+	return alt
+}
+
+// checkAlertnames checks the alertnames received by the alertmanager regardless of their order
+func checkAlertnames(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	got = append([]string(nil), got...)
+	want = append([]string(nil), want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s received %v, want %v", name, got, want)
+	}
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		status    int
+		forward   bool
+		wantReady bool
+	}{
+		{name: "no target allowed", config: "allow_empty: true\nalertmanagers: []\n", status: http.StatusOK, wantReady: true},
+		{
+			name:      "healthy critical alertmanager",
+			config:    "  critical: true\n",
+			status:    http.StatusOK,
+			forward:   true,
+			wantReady: true,
+		},
+		{
+			name:    "failing critical alertmanager",
+			config:  "  critical: true\n",
+			status:  http.StatusInternalServerError,
+			forward: true,
+		},
+		{
+			name:      "critical alertmanager failing for less than unhealthy_after",
+			config:    "  critical: true\n  unhealthy_after: 1h\n",
+			status:    http.StatusInternalServerError,
+			forward:   true,
+			wantReady: true,
+		},
+		{
+			name:      "failing alertmanager that isn't critical",
+			status:    http.StatusInternalServerError,
+			forward:   true,
+			wantReady: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newTestAlertmanager(t, tc.status)
+			config := tc.config
+			if !strings.Contains(config, "alertmanagers:") {
+				config = "alertmanagers:\n- static_configs: [" + upstream.addr() + "]\n  scheme: http\n  api_version: v1\n" + config
+			}
+			fwder := newTestForwarder(t, config)
+			now := time.Now()
+			for _, am := range fwder.alertmanagers {
+				am.now = func() time.Time { return now }
+			}
+			if tc.forward {
+				_ = fwder.Forward(context.Background(), firing("a"))
+				now = now.Add(time.Second)
+			}
+			if err := fwder.Ready(); (err == nil) != tc.wantReady {
+				t.Errorf("Ready() = %v, want ready %v", err, tc.wantReady)
+			}
+		})
+	}
+}
+
+func TestReadyTransition(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusInternalServerError)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+  critical: true
+  unhealthy_after: 1m
+`)
+	now := time.Now()
+	fwder.alertmanagers[0].now = func() time.Time { return now }
+
+	_ = fwder.Forward(context.Background(), firing("a"))
+	now = now.Add(time.Minute)
+	if err := fwder.Ready(); err != nil {
+		t.Fatalf("Ready() = %v after failing for unhealthy_after, want nil", err)
+	}
+	now = now.Add(time.Second)
+	if err := fwder.Ready(); err == nil {
+		t.Fatal("Ready() succeeded after failing for longer than unhealthy_after, want error")
+	}
+
+	// a successful forward makes the alertmanager ready again
+	upstream.mtx.Lock()
+	upstream.status = http.StatusOK
+	upstream.mtx.Unlock()
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+	if err := fwder.Ready(); err != nil {
+		t.Errorf("Ready() = %v after a successful forward, want nil", err)
+	}
+}
+
+func TestNewForwarderEmpty(t *testing.T) {
+	if _, err := NewForwarder(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", "alertmanagers: []\n")); err == nil {
+		t.Error("NewForwarder() succeeded without alertmanager nor allow_empty, want error")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	want := model.LabelSet{"alertname": "a", "severity": "critical", "cluster": "c1"}.Fingerprint().String()
+	for _, alt := range []template.Alert{
+		{Labels: template.KV{"alertname": "a", "severity": "critical", "cluster": "c1"}},
+		{Labels: template.KV{"cluster": "c1", "severity": "critical", "alertname": "a"}},
+		{Labels: template.KV{"alertname": "a", "severity": "critical", "cluster": "c1"}, Fingerprint: "set-by-the-sender"},
+	} {
+		for i := 0; i < 3; i++ {
+			if got := Fingerprint(alt); got != want {
+				t.Fatalf("Fingerprint(%v) = %q, want %q", alt, got, want)
+			}
+		}
+	}
+	if Fingerprint(template.Alert{Labels: template.KV{"alertname": "b", "severity": "critical", "cluster": "c1"}}) == want {
+		t.Error("alerts with different labels have the same fingerprint")
+	}
+}
+
+func TestForwardTenants(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		alerts      template.Alerts
+		wantTenants map[string][]string
+	}{
+		{
+			name:        "single tenant",
+			alerts:      withTenants(map[string]string{"a": "team-a", "b": "team-b"}),
+			wantTenants: map[string][]string{"": {"a", "b"}},
+		},
+		{
+			name:        "tenant label",
+			config:      "  tenant_label: tenant\n",
+			alerts:      withTenants(map[string]string{"a": "team-a", "b": "team-b", "c": "team-a"}),
+			wantTenants: map[string][]string{"team-a": {"a", "c"}, "team-b": {"b"}},
+		},
+		{
+			name:        "default tenant",
+			config:      "  tenant_label: tenant\n  default_tenant: ops\n",
+			alerts:      withTenants(map[string]string{"a": "team-a", "b": ""}),
+			wantTenants: map[string][]string{"team-a": {"a"}, "ops": {"b"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newTestAlertmanager(t, http.StatusOK)
+			fwder := newTestForwarder(t, "alertmanagers:\n- static_configs: ["+upstream.addr()+"]\n  scheme: http\n  api_version: v1\n"+tc.config)
+			if err := fwder.Forward(context.Background(), tc.alerts); err != nil {
+				t.Fatalf("Forward() = %v", err)
+			}
+			upstream.mtx.Lock()
+			defer upstream.mtx.Unlock()
+			if len(upstream.tenants) != len(tc.wantTenants) {
+				t.Errorf("upstream received the tenants %v, want %v", upstream.tenants, tc.wantTenants)
+			}
+			for tenant, want := range tc.wantTenants {
+				checkAlertnames(t, "tenant "+tenant, upstream.tenants[tenant], want)
+			}
+		})
+	}
+}
+
+// withTenants returns firing alerts by alertname with the tenant label, unset if empty
+func withTenants(tenants map[string]string) template.Alerts {
+	var alerts template.Alerts
+	for name, tenant := range tenants {
+		alt := firing(name)[0]
+		if tenant != "" {
+			alt.Labels["tenant"] = tenant
+		}
+		alerts = append(alerts, alt)
+	}
+	return alerts
+}
+
+func TestForwardFailover(t *testing.T) {
+	tests := []struct {
+		name                string
+		primaryStatus       int
+		secondaryStatus     int
+		primaryResolved     bool
+		secondaryResolved   bool
+		alerts              template.Alerts
+		wantErr             bool
+		wantPrimaryAlerts   int
+		wantSecondaryAlerts int
+	}{
+		{
+			name:              "primary delivers",
+			primaryStatus:     http.StatusOK,
+			secondaryStatus:   http.StatusOK,
+			primaryResolved:   true,
+			secondaryResolved: true,
+			alerts:            firing("a"),
+			wantPrimaryAlerts: 1,
+		},
+		{
+			name:                "failing primary fails over to the secondary",
+			primaryStatus:       http.StatusInternalServerError,
+			secondaryStatus:     http.StatusOK,
+			primaryResolved:     true,
+			secondaryResolved:   true,
+			alerts:              firing("a"),
+			wantPrimaryAlerts:   1,
+			wantSecondaryAlerts: 1,
+		},
+		{
+			name:                "both failing",
+			primaryStatus:       http.StatusInternalServerError,
+			secondaryStatus:     http.StatusInternalServerError,
+			primaryResolved:     true,
+			secondaryResolved:   true,
+			alerts:              firing("a"),
+			wantErr:             true,
+			wantPrimaryAlerts:   1,
+			wantSecondaryAlerts: 1,
+		},
+		{
+			name:                "nothing for the primary fails over to the secondary",
+			primaryStatus:       http.StatusOK,
+			secondaryStatus:     http.StatusOK,
+			primaryResolved:     false,
+			secondaryResolved:   true,
+			alerts:              resolved("a"),
+			wantSecondaryAlerts: 1,
+		},
+		{
+			name:              "nothing for any alertmanager isn't a failure",
+			primaryStatus:     http.StatusOK,
+			secondaryStatus:   http.StatusOK,
+			primaryResolved:   false,
+			secondaryResolved: false,
+			alerts:            resolved("a"),
+		},
+		{
+			name:                "nothing for the secondary after a failing primary",
+			primaryStatus:       http.StatusInternalServerError,
+			secondaryStatus:     http.StatusOK,
+			primaryResolved:     true,
+			secondaryResolved:   false,
+			alerts:              resolved("a"),
+			wantErr:             true,
+			wantPrimaryAlerts:   1,
+			wantSecondaryAlerts: 0,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := newTestAlertmanager(t, tc.primaryStatus)
+			secondary := newTestAlertmanager(t, tc.secondaryStatus)
+			fwder := newTestForwarder(t, `
+alertmanagers:
+- name: primary
+  static_configs: [`+primary.addr()+`]
+  forward_resolved: `+strconv.FormatBool(tc.primaryResolved)+`
+- name: secondary
+  priority: 1
+  static_configs: [`+secondary.addr()+`]
+  forward_resolved: `+strconv.FormatBool(tc.secondaryResolved)+`
+`)
+
+			err := fwder.Forward(context.Background(), tc.alerts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Forward() error = %v, want error %v", err, tc.wantErr)
+			}
+			if got := len(primary.received()); got != tc.wantPrimaryAlerts {
+				t.Errorf("primary received %d alerts, want %d", got, tc.wantPrimaryAlerts)
+			}
+			if got := len(secondary.received()); got != tc.wantSecondaryAlerts {
+				t.Errorf("secondary received %d alerts, want %d", got, tc.wantSecondaryAlerts)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: "10.0.0.1:9093", want: "10.0.0.1:9093"},
+		{addr: "10.0.0.1", want: "10.0.0.1"},
+		{addr: "alertmanager:9093", want: "alertmanager:9093"},
+		{addr: "alertmanager", want: "alertmanager"},
+		{addr: "alertmanager.monitoring.svc", want: "alertmanager.monitoring.svc"},
+		{addr: "[::1]:9093", want: "[::1]:9093"},
+		{addr: "::1", want: "[::1]"},
+		{addr: "[::1]", want: "[::1]"},
+		{addr: "[fe80::1%eth0]:9093", want: "[fe80::1%eth0]:9093"},
+		{addr: "fe80::1%eth0", want: "[fe80::1%eth0]"},
+		{addr: "[fe80::1%eth0]", want: "[fe80::1%eth0]"},
+		{addr: "", wantErr: true},
+		{addr: ":9093", wantErr: true},
+		{addr: "alertmanager:0", wantErr: true},
+		{addr: "alertmanager:65536", wantErr: true},
+		{addr: "alertmanager:http", wantErr: true},
+		{addr: "10.0.0.1%eth0", wantErr: true},
+		{addr: "10.0.0.1%eth0:9093", wantErr: true},
+		{addr: "[alertmanager]", wantErr: true},
+		{addr: "http://alertmanager", wantErr: true},
+		{addr: "alert manager", wantErr: true},
+	}
+	for _, tc := range tests {
+		got, err := normalizeAddress(tc.addr)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("normalizeAddress(%q) error = %v, want error %v", tc.addr, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("normalizeAddress(%q) = %q, want %q", tc.addr, got, tc.want)
+		}
+	}
+
+	// the zone is escaped in the endpoint URL
+	am := &Alertmanager{scheme: "http"}
+	if got, want := am.endpointURL("[fe80::1%eth0]:9093").String(), "http://[fe80::1%25eth0]:9093/"; got != want {
+		t.Errorf("endpoint URL = %q, want %q", got, want)
+	}
+}
+
+func TestForwardDedupEndpoints(t *testing.T) {
+	tests := []struct {
+		name        string
+		dedup       bool
+		discovered  bool // the shared endpoint is discovered by the second alertmanager instead of listed
+		wantShared  int
+		wantTracked bool // whether the second alertmanager holds the series of the shared endpoint
+	}{
+		{name: "sent twice", wantShared: 2, wantTracked: true},
+		{name: "deduplicated", dedup: true, wantShared: 1},
+		{name: "sent twice to the discovered endpoint", discovered: true, wantShared: 2, wantTracked: true},
+		{name: "deduplicated discovered endpoint", dedup: true, discovered: true, wantShared: 1, wantTracked: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			shared := newTestAlertmanager(t, http.StatusOK)
+			other := newTestAlertmanager(t, http.StatusOK)
+			secondEndpoints := other.addr()
+			if !tc.discovered {
+				secondEndpoints += ", " + shared.addr()
+			}
+			fwder := newTestForwarder(t, `
+dedup_endpoints: `+strconv.FormatBool(tc.dedup)+`
+alertmanagers:
+- name: first
+  static_configs: [`+shared.addr()+`]
+- name: second
+  static_configs: [`+secondEndpoints+`]
+`)
+			second := fwder.alertmanagers[1]
+			if tc.discovered {
+				second.epMtx.Lock()
+				second.discovered = make([][]*url.URL, 1)
+				second.epMtx.Unlock()
+				second.setDiscovered(0, []string{shared.addr()})
+			}
+
+			if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+				t.Fatalf("Forward() error = %v", err)
+			}
+			if got := len(shared.received()); got != tc.wantShared {
+				t.Errorf("shared endpoint received %d alerts, want %d", got, tc.wantShared)
+			}
+			checkAlertnames(t, "other endpoint", other.received(), []string{"a"})
+			second.epMtx.RLock()
+			tracked := second.tracked[shared.URL+"/"]
+			second.epMtx.RUnlock()
+			if tracked != tc.wantTracked {
+				t.Errorf("second alertmanager tracks the shared endpoint = %v, want %v", tracked, tc.wantTracked)
+			}
+		})
+	}
+}
+
+func TestForwardMirror(t *testing.T) {
+	tests := []struct {
+		name          string
+		primaryStatus int
+		mirrorStatus  int
+		wantErr       bool
+	}{
+		{name: "mirrored", primaryStatus: http.StatusOK, mirrorStatus: http.StatusOK},
+		{name: "failing mirror", primaryStatus: http.StatusOK, mirrorStatus: http.StatusInternalServerError},
+		{name: "failing primary", primaryStatus: http.StatusInternalServerError, mirrorStatus: http.StatusOK, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := newTestAlertmanager(t, tc.primaryStatus)
+			mirror := newTestAlertmanager(t, tc.mirrorStatus)
+			fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+primary.addr()+`]
+- static_configs: [`+mirror.addr()+`]
+  mirror: true
+`)
+			err := fwder.Forward(context.Background(), firing("a", "b"))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Forward() error = %v, want error %v", err, tc.wantErr)
+			}
+			checkAlertnames(t, "primary", primary.received(), []string{"a", "b"})
+			checkAlertnames(t, "mirror", mirror.received(), []string{"a", "b"})
+		})
+	}
+}
+
+func TestForwardClusterFailover(t *testing.T) {
+	down := newTestAlertmanager(t, http.StatusOK)
+	down.Close()
+	second := newTestAlertmanager(t, http.StatusOK)
+	third := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+down.addr()+`, `+second.addr()+`, `+third.addr()+`]
+  cluster: true
+`)
+
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	checkAlertnames(t, "second member", second.received(), []string{"a"})
+	checkAlertnames(t, "third member", third.received(), nil)
+
+	// the member that accepted the alerts gets the next ones first
+	if err := fwder.Forward(context.Background(), firing("b")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	checkAlertnames(t, "second member", second.received(), []string{"a", "b"})
+	checkAlertnames(t, "third member", third.received(), nil)
+}
+
+func TestForwardDefaultTimeout(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+`)
+	if got := fwder.alertmanagers[0].timeout; got != defaultTimeout {
+		t.Errorf("timeout = %s without timeout configured, want the default %s", got, defaultTimeout)
+	}
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+	checkAlertnames(t, "upstream", upstream.received(), []string{"a"})
+}
+
+func TestForwardEndpointTimeout(t *testing.T) {
+	fast := newTestAlertmanager(t, http.StatusOK)
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(release) })
+
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+fast.addr()+`, `+strings.TrimPrefix(hanging.URL, "http://")+`]
+  timeout: 1m
+  endpoint_timeout: 200ms
+`)
+	start := time.Now()
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	// the hanging endpoint is abandoned after the endpoint timeout instead of the request timeout
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Forward() took %s with an endpoint timeout of 200ms", elapsed)
+	}
+	checkAlertnames(t, "fast endpoint", fast.received(), []string{"a"})
+	if up := testutil.ToFloat64(upstreamUp.WithLabelValues(fast.URL + "/")); up != 1 {
+		t.Errorf("fast endpoint up = %v, want 1", up)
+	}
+	if up := testutil.ToFloat64(upstreamUp.WithLabelValues(hanging.URL + "/")); up != 0 {
+		t.Errorf("hanging endpoint up = %v, want 0", up)
+	}
+}
+
+func TestStopDrainTimeout(t *testing.T) {
+	t.Run("flushed within the timeout", func(t *testing.T) {
+		upstream := newTestAlertmanager(t, http.StatusOK)
+		fwder, err := NewForwarder(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+batch_window: 1h
+drain_timeout: 5s
+`))
+		if err != nil {
+			t.Fatalf("failed to create the forwarder: %v", err)
+		}
+		if err := fwder.Forward(context.Background(), firing("a", "b")); err != nil {
+			t.Fatalf("Forward() = %v, want nil", err)
+		}
+		checkAlertnames(t, "before stop", upstream.received(), nil)
+
+		fwder.Stop()
+		checkAlertnames(t, "after stop", upstream.received(), []string{"a", "b"})
+	})
+
+	t.Run("dropped after the timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}))
+		t.Cleanup(hanging.Close)
+		t.Cleanup(func() { close(release) })
+
+		var buf bytes.Buffer
+		fwder, err := NewForwarder(log.NewLogfmtLogger(log.NewSyncWriter(&buf)), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- static_configs: [`+strings.TrimPrefix(hanging.URL, "http://")+`]
+  timeout: 1m
+batch_window: 1h
+drain_timeout: 200ms
+`))
+		if err != nil {
+			t.Fatalf("failed to create the forwarder: %v", err)
+		}
+		if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+			t.Fatalf("Forward() = %v, want nil", err)
+		}
+
+		start := time.Now()
+		fwder.Stop()
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("Stop() took %s with a drain timeout of 200ms", elapsed)
+		}
+		logs := buf.String()
+		if !strings.Contains(logs, "forwarding alert batch failed") || !strings.Contains(logs, "numAlerts=1") {
+			t.Errorf("the dropped batch isn't logged: %s", logs)
+		}
+	})
+}
+
+func TestForwardHeaders(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+  headers:
+    X-Scope-OrgID: team-a
+    X-Custom-Header: custom value
+`)
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+
+	upstream.mtx.Lock()
+	defer upstream.mtx.Unlock()
+	if len(upstream.requests) != 1 {
+		t.Fatalf("upstream received %d requests, want 1", len(upstream.requests))
+	}
+	for name, want := range map[string]string{"X-Scope-OrgID": "team-a", "X-Custom-Header": "custom value"} {
+		if got := upstream.requests[0].Header.Get(name); got != want {
+			t.Errorf("%s header = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestForwardUserAgent(t *testing.T) {
+	defer func(v string) { version.Version = v }(version.Version)
+	version.Version = "1.2.3-test"
+
+	var (
+		mtx        sync.Mutex
+		userAgents = make(map[string]string)
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		userAgents[r.URL.Path] = r.Header.Get("User-Agent")
+	}))
+	t.Cleanup(upstream.Close)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+strings.TrimPrefix(upstream.URL, "http://")+`]
+receivers:
+- name: hook
+  webhook:
+    url: `+upstream.URL+`/hook
+`)
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	want := map[string]string{"/api/v1/alerts": "alerts-collector/1.2.3-test", "/hook": "alerts-collector/1.2.3-test"}
+	if !reflect.DeepEqual(userAgents, want) {
+		t.Errorf("User-Agent by path = %v, want %v", userAgents, want)
+	}
+}
+
+func TestForwardCircuitBreaker(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusInternalServerError)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+  circuit_breaker:
+    failure_threshold: 2
+    cooldown: 1m
+`)
+	am := fwder.alertmanagers[0]
+	now := time.Now()
+	am.breaker(am.currentEndpoints()[0]).now = func() time.Time { return now }
+
+	// the circuit opens after 2 consecutive failures and the endpoint is skipped while it is open
+	for _, name := range []string{"a", "b", "c"} {
+		if err := fwder.Forward(context.Background(), firing(name)); err == nil {
+			t.Fatalf("Forward(%s) succeeded with a failing endpoint, want error", name)
+		}
+	}
+	checkAlertnames(t, "failing endpoint", upstream.received(), []string{"a", "b"})
+
+	// the endpoint recovers, it receives alerts again once the cooldown has elapsed
+	upstream.mtx.Lock()
+	upstream.status = http.StatusOK
+	upstream.mtx.Unlock()
+	now = now.Add(30 * time.Second)
+	if err := fwder.Forward(context.Background(), firing("d")); err == nil {
+		t.Fatal("Forward() succeeded within the cooldown, want error")
+	}
+	now = now.Add(30 * time.Second)
+	for _, name := range []string{"e", "f"} {
+		if err := fwder.Forward(context.Background(), firing(name)); err != nil {
+			t.Fatalf("Forward(%s) = %v after the cooldown, want nil", name, err)
+		}
+	}
+	checkAlertnames(t, "recovered endpoint", upstream.received(), []string{"a", "b", "e", "f"})
+}
+
+func TestForwardFailFast(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(hanging.Close)
+	t.Cleanup(func() { close(release) })
+
+	fwder := newTestForwarder(t, `
+fail_fast: true
+alertmanagers:
+- static_configs: [`+strings.TrimPrefix(hanging.URL, "http://")+`]
+  timeout: 1s
+  circuit_breaker:
+    failure_threshold: 1
+    cooldown: 1h
+`)
+	// the first request times out and opens the circuit of the only endpoint
+	if err := fwder.Forward(context.Background(), firing("a")); err == nil {
+		t.Fatal("Forward() succeeded with a hanging upstream, want error")
+	}
+
+	start := time.Now()
+	err := fwder.Forward(context.Background(), firing("b"))
+	if err == nil || !strings.Contains(err.Error(), "circuit breakers of all alertmanager endpoints are open") {
+		t.Errorf("Forward() = %v, want the open circuits error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Forward() took %s with all the circuits open, want it to return before the 1s timeout", elapsed)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("hanging upstream received %d requests, want 1", got)
+	}
+}
+
+func TestForwardBadResponseBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantErr     string // formatted with the alerts URL
+		wantMissing string
+	}{
+		{name: "explanatory body", body: "invalid alert: missing alertname\n", wantErr: "400 Bad Request from %q: invalid alert: missing alertname"},
+		{name: "truncated body", body: strings.Repeat("a", maxErrorBodyBytes) + "TAIL", wantErr: "400 Bad Request from %q: " + strings.Repeat("a", maxErrorBodyBytes), wantMissing: "TAIL"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, tc.body)
+			}))
+			t.Cleanup(upstream.Close)
+			var buf bytes.Buffer
+			fwder, err := NewForwarderWithOptions(log.NewLogfmtLogger(log.NewSyncWriter(&buf)), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- static_configs: [`+strings.TrimPrefix(upstream.URL, "http://")+`]
+`), Options{})
+			if err != nil {
+				t.Fatalf("failed to create the forwarder: %v", err)
+			}
+			t.Cleanup(fwder.Stop)
+
+			am := fwder.alertmanagers[0]
+			u := am.alertsURL(*am.currentEndpoints()[0])
+			err = am.postAlerts(context.Background(), u, "", nil, strings.NewReader("[]"))
+			if err == nil {
+				t.Fatal("postAlerts() succeeded with a bad response, want error")
+			}
+			if want := fmt.Sprintf(tc.wantErr, u.String()); !strings.Contains(err.Error(), want) {
+				t.Errorf("postAlerts() error %q doesn't contain %q", err, want)
+			}
+			if tc.wantMissing != "" && strings.Contains(err.Error(), tc.wantMissing) {
+				t.Errorf("postAlerts() error %q contains the body beyond %d bytes", err, maxErrorBodyBytes)
+			}
+
+			// the failure of the forwarding is logged with the body
+			if err := fwder.Forward(context.Background(), firing("a")); err == nil {
+				t.Fatal("Forward() succeeded with a bad response, want error")
+			}
+			if body := strings.TrimSpace(strings.TrimSuffix(tc.body, tc.wantMissing)); !strings.Contains(buf.String(), body) {
+				t.Errorf("the response body isn't logged: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestForwardFailedLog(t *testing.T) {
+	tests := []struct {
+		name           string
+		redactPayloads bool
+		wantPayload    bool
+	}{
+		{name: "payload logged", wantPayload: true},
+		{name: "payload redacted", redactPayloads: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newTestAlertmanager(t, http.StatusInternalServerError)
+			var buf bytes.Buffer
+			config := writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+`)
+			fwder, err := NewForwarderWithOptions(log.NewLogfmtLogger(log.NewSyncWriter(&buf)), config, Options{RedactPayloads: tc.redactPayloads})
+			if err != nil {
+				t.Fatalf("failed to create the forwarder: %v", err)
+			}
+			t.Cleanup(fwder.Stop)
+
+			alerts := firing("a")
+			alerts[0].Labels["secret_label"] = "label-value"
+			alerts[0].Annotations = template.KV{"description": "annotation-value"}
+			if err := fwder.Forward(context.Background(), alerts); err == nil {
+				t.Fatal("Forward() succeeded, want an error")
+			}
+
+			logs := buf.String()
+			if !strings.Contains(logs, "forwarding alerts failed") {
+				t.Fatalf("the failure isn't logged: %s", logs)
+			}
+			for _, value := range []string{"label-value", "annotation-value"} {
+				if got := strings.Contains(logs, value); got != tc.wantPayload {
+					t.Errorf("%q logged = %v, want %v: %s", value, got, tc.wantPayload, logs)
+				}
+			}
+			if tc.redactPayloads && !strings.Contains(logs, Fingerprint(alerts[0])) {
+				t.Errorf("the fingerprint of the alert isn't logged: %s", logs)
+			}
+		})
+	}
+}
+
+func TestFilterLogRedaction(t *testing.T) {
+	secret := withStatus("secret-name", statusFiring, "severity", "critical")
+	secretResolved := withStatus("secret-name", statusResolved, "severity", "critical")
+	filters := []struct {
+		name   string
+		filter func(l log.Logger, redact bool)
+	}{
+		{name: "resolved dedup", filter: func(l log.Logger, redact bool) {
+			d := newResolvedDeduper(l, time.Minute, nil, redact)
+			d.filter(template.Alerts{secretResolved})
+			d.filter(template.Alerts{secretResolved})
+		}},
+		{name: "flap detection", filter: func(l log.Logger, redact bool) {
+			d := newFlapDetector(l, FlapDetectionConfig{MaxTransitions: 1}, redact)
+			for _, alt := range []template.Alert{secret, secretResolved, secret, secretResolved} {
+				d.filter(template.Alerts{alt})
+			}
+		}},
+		{name: "inhibition", filter: func(l log.Logger, redact bool) {
+			ih, err := newInhibitor(l, []InhibitRuleConfig{{
+				SourceMatchers: []MatcherConfig{{Name: "alertname", Value: "source"}},
+				TargetMatchers: []MatcherConfig{{Name: "severity", Value: "critical"}},
+			}}, 0, redact)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ih.filter(template.Alerts{withStatus("source", statusFiring), secret})
+		}},
+		{name: "alertname limit", filter: func(l log.Logger, redact bool) {
+			newAlertnameLimiter(l, 1, time.Minute, redact).filter(template.Alerts{withStatus("first", statusFiring), secret})
+		}},
+	}
+	for _, f := range filters {
+		for _, redact := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s redacted %v", f.name, redact), func(t *testing.T) {
+				var buf bytes.Buffer
+				f.filter(log.NewLogfmtLogger(&buf), redact)
+				logs := buf.String()
+				if !strings.Contains(logs, Fingerprint(secret)) && !strings.Contains(logs, Fingerprint(secretResolved)) {
+					t.Fatalf("the fingerprint of the alert isn't logged: %s", logs)
+				}
+				if got := strings.Contains(logs, "secret-name"); got != !redact {
+					t.Errorf("alertname logged = %v, want %v: %s", got, !redact, logs)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// TemplateFuncs are the functions available in the templates, in addition to the alertmanager
+// template functions toUpper, toLower, title, join, match, reReplaceAll and stringSlice:
+//
+//	default DEFAULT VALUE  returns the value, or the default if the value is empty
+//	trimSpace S            removes the leading and trailing white space
+//	toJson V               encodes the value as JSON, e.g. to quote a string in a JSON payload
+//	humanizeDuration V     formats seconds or a time.Duration, e.g. 1d 2h 3m 4s
+//	since T                returns the time.Duration elapsed since the time
+var TemplateFuncs = newTemplateFuncs()
+
+// newTemplateFuncs returns the template functions
+func newTemplateFuncs() texttemplate.FuncMap {
+	funcs := texttemplate.FuncMap{}
+	for name, fn := range template.DefaultFuncs {
+		// safeHtml is only meaningful for HTML templates
+		if name != "safeHtml" {
+			funcs[name] = fn
+		}
+	}
+	funcs["default"] = func(def string, value interface{}) string {
+		if s := fmt.Sprint(value); value != nil && s != "" {
+			return s
+		}
+		return def
+	}
+	funcs["trimSpace"] = strings.TrimSpace
+	funcs["toJson"] = func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	}
+	funcs["humanizeDuration"] = humanizeDuration
+	funcs["since"] = time.Since
+	return funcs
+}
+
+// humanizeDuration formats the duration given as seconds or as time.Duration
+func humanizeDuration(v interface{}) (string, error) {
+	var seconds float64
+	switch d := v.(type) {
+	case time.Duration:
+		seconds = d.Seconds()
+	case float64:
+		seconds = d
+	case int:
+		seconds = float64(d)
+	case int64:
+		seconds = float64(d)
+	case string:
+		f, err := strconv.ParseFloat(d, 64)
+		if err != nil {
+			return "", fmt.Errorf("humanizeDuration: invalid number of seconds %q", d)
+		}
+		seconds = f
+	default:
+		return "", fmt.Errorf("humanizeDuration: unsupported type %T", v)
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return fmt.Sprintf("%.4g", seconds), nil
+	}
+
+	sign := ""
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	if seconds < 1 {
+		switch {
+		case seconds == 0:
+			return "0s", nil
+		case seconds >= 1e-3:
+			return fmt.Sprintf("%s%.4gms", sign, seconds*1e3), nil
+		default:
+			return fmt.Sprintf("%s%.4gus", sign, seconds*1e6), nil
+		}
+	}
+
+	total := int64(seconds)
+	days, hours, minutes := total/86400, total/3600%24, total/60%60
+	secs := seconds - float64(total/60*60)
+	var parts []string
+	if days > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", days))
+	}
+	if hours > 0 {
+		parts = append(parts, fmt.Sprintf("%dh", hours))
+	}
+	if minutes > 0 {
+		parts = append(parts, fmt.Sprintf("%dm", minutes))
+	}
+	if secs >= 0.001 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%.4gs", secs))
+	}
+	return sign + strings.Join(parts, " "), nil
+}
@@ -0,0 +1,50 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"bytes"
+	"testing"
+	texttemplate "text/template"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		data    interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "default of an empty value", tmpl: `{{ .Missing | default "none" }}`, data: map[string]string{}, want: "none"},
+		{name: "default of a value", tmpl: `{{ .Set | default "none" }}`, data: map[string]string{"Set": "a"}, want: "a"},
+		{name: "trimSpace", tmpl: `{{ trimSpace " a " }}`, want: "a"},
+		{name: "toJson", tmpl: `{{ toJson "say \"hi\"" }}`, want: `"say \"hi\""`},
+		{name: "alertmanager functions", tmpl: `{{ toUpper "a" }}{{ stringSlice "b" "c" | join "," }}`, want: "Ab,c"},
+		{name: "humanizeDuration of seconds", tmpl: `{{ humanizeDuration 93784.5 }}`, want: "1d 2h 3m 4.5s"},
+		{name: "humanizeDuration of a duration", tmpl: `{{ humanizeDuration .D }}`, data: map[string]time.Duration{"D": 90 * time.Second}, want: "1m 30s"},
+		{name: "humanizeDuration of a string", tmpl: `{{ humanizeDuration "0.25" }}`, want: "250ms"},
+		{name: "humanizeDuration of a negative duration", tmpl: `{{ humanizeDuration -61 }}`, want: "-1m 1s"},
+		{name: "humanizeDuration of an invalid string", tmpl: `{{ humanizeDuration "soon" }}`, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpl, err := texttemplate.New(tc.name).Funcs(TemplateFuncs).Parse(tc.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			err = tmpl.Execute(&buf, tc.data)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Execute() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && buf.String() != tc.want {
+				t.Errorf("Execute() = %q, want %q", buf.String(), tc.want)
+			}
+		})
+	}
+	if _, found := TemplateFuncs["safeHtml"]; found {
+		t.Error("safeHtml is available in the text templates")
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// groupAlerts splits the alerts into groups with the same values of the group_by labels,
+// alerts with the same fingerprint are deduplicated within a group keeping the latest one.
+// The groups are returned in the order of their first alert.
+func groupAlerts(alerts template.Alerts, groupBy []string) []template.Alerts {
+	var groups []template.Alerts
+	byKey := make(map[string]int)         // group key -> index in groups
+	byFingerprint := make(map[string]int) // fingerprint -> index in its group
+	for _, alt := range alerts {
+		values := make([]string, 0, len(groupBy))
+		for _, name := range groupBy {
+			values = append(values, alt.Labels[name])
+		}
+		key := strings.Join(values, "\xff")
+
+		g, found := byKey[key]
+		if !found {
+			g = len(groups)
+			byKey[key] = g
+			groups = append(groups, nil)
+		}
+		fp := Fingerprint(alt)
+		if i, found := byFingerprint[fp]; found {
+			groups[g][i] = alt
+			continue
+		}
+		byFingerprint[fp] = len(groups[g])
+		groups[g] = append(groups[g], alt)
+	}
+	return groups
+}
@@ -0,0 +1,45 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestGroupAlerts(t *testing.T) {
+	alerts := template.Alerts{
+		withStatus("a", statusFiring, "cluster", "east"),
+		withStatus("b", statusFiring, "cluster", "west"),
+		withStatus("c", statusFiring, "cluster", "east"),
+		withStatus("a", statusResolved, "cluster", "east"),
+		withStatus("d", statusFiring),
+	}
+	tests := []struct {
+		name    string
+		groupBy []string
+		want    [][]string
+	}{
+		{name: "single group", want: [][]string{{"a", "b", "c", "d"}}},
+		{name: "by cluster", groupBy: []string{"cluster"}, want: [][]string{{"a", "c"}, {"b"}, {"d"}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			groups := groupAlerts(alerts, tc.groupBy)
+			got := make([][]string, 0, len(groups))
+			for _, g := range groups {
+				got = append(got, alertnamesOf(g))
+				for _, alt := range g {
+					if alt.Labels["alertname"] == "a" && alt.Status != statusResolved {
+						t.Errorf("alert a has status %s, want the latest state resolved", alt.Status)
+					}
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("groups = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// http2RoundTripper speaks HTTP/2 to the targets, negotiated over TLS for https
+// and with prior knowledge over cleartext (h2c) for http
+type http2RoundTripper struct {
+	tls http.RoundTripper
+	h2c http.RoundTripper
+}
+
+// newHTTP2RoundTripper returns a round tripper using HTTP/2 with the TLS settings of the transport
+func newHTTP2RoundTripper(transport *http.Transport) (http.RoundTripper, error) {
+	if err := http2.ConfigureTransport(transport); err != nil {
+		return nil, fmt.Errorf("failed to configure HTTP/2: %v", err)
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	return &http2RoundTripper{
+		tls: transport,
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			// dial without TLS, the transport only dials TLS connections by default
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.Dial(network, addr)
+			},
+		},
+	}, nil
+}
+
+// RoundTrip implements http.RoundTripper
+func (rt *http2RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return rt.h2c.RoundTrip(req)
+	}
+	return rt.tls.RoundTrip(req)
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestHTTP2(t *testing.T) {
+	tests := []struct {
+		name      string
+		http2     bool
+		wantProto int
+	}{
+		{name: "HTTP/1.1 by default", wantProto: 1},
+		{name: "h2c with prior knowledge", http2: true, wantProto: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			protos := make(chan int, 1)
+			s := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				protos <- r.ProtoMajor
+			}), &http2.Server{}))
+			defer s.Close()
+			fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+strings.TrimPrefix(s.URL, "http://")+`]
+  http2: `+strconv.FormatBool(tc.http2)+`
+`)
+			if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+				t.Fatalf("Forward() = %v", err)
+			}
+			if got := <-protos; got != tc.wantProto {
+				t.Errorf("upstream received HTTP/%d, want HTTP/%d", got, tc.wantProto)
+			}
+		})
+	}
+}
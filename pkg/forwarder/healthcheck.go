@@ -0,0 +1,112 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// defaultHealthCheckPath is the path probed on the alertmanager endpoints if it is not configured
+const defaultHealthCheckPath = "/-/healthy"
+
+// healthChecker periodically probes the endpoints of an alertmanager
+type healthChecker struct {
+	logger   log.Logger
+	am       *Alertmanager
+	path     string
+	interval time.Duration
+
+	stopc chan struct{}
+	done  chan struct{}
+}
+
+// newHealthChecker starts probing the endpoints of the alertmanager, nil if the interval is not set
+func newHealthChecker(l log.Logger, am *Alertmanager, interval time.Duration, path string) *healthChecker {
+	if interval <= 0 {
+		return nil
+	}
+	if path == "" {
+		path = defaultHealthCheckPath
+	}
+	hc := &healthChecker{
+		logger:   l,
+		am:       am,
+		path:     path,
+		interval: interval,
+		stopc:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go hc.run()
+	return hc
+}
+
+// run probes the endpoints at every interval until the health checker is stopped
+func (hc *healthChecker) run() {
+	defer close(hc.done)
+
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			hc.check()
+		case <-hc.stopc:
+			return
+		}
+	}
+}
+
+// check probes all the endpoints, the alertmanager is healthy if any of them is
+func (hc *healthChecker) check() {
+	var healthy bool
+	for _, u := range hc.am.currentEndpoints() {
+		if err := hc.probe(*u); err != nil {
+			level.Debug(hc.logger).Log("msg", "health check of alertmanager endpoint failed", "endpoint", u.String(), "err", err)
+			upstreamUp.WithLabelValues(u.String()).Set(0)
+			continue
+		}
+		upstreamUp.WithLabelValues(u.String()).Set(1)
+		healthy = true
+	}
+	hc.am.recordResult(healthy)
+}
+
+// probe sends a GET request to the health check path of the endpoint
+func (hc *healthChecker) probe(u url.URL) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.am.timeout)
+	defer cancel()
+
+	u.Path = path.Join(u.Path, hc.path)
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.am.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, u.String())
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// stop stops probing
+func (hc *healthChecker) stop() {
+	if hc == nil {
+		return
+	}
+	close(hc.stopc)
+	<-hc.done
+}
@@ -0,0 +1,73 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthChecker(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		status    int
+		wantPath  string
+		wantReady bool
+	}{
+		{name: "healthy", status: http.StatusOK, wantPath: defaultHealthCheckPath, wantReady: true},
+		{name: "custom path", path: "/api/v2/status", status: http.StatusOK, wantPath: "/api/v2/status", wantReady: true},
+		{name: "unhealthy", status: http.StatusServiceUnavailable, wantPath: defaultHealthCheckPath},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mtx   sync.Mutex
+				paths []string
+			)
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mtx.Lock()
+				paths = append(paths, r.Method+" "+r.URL.Path)
+				mtx.Unlock()
+				w.WriteHeader(tc.status)
+			}))
+			defer s.Close()
+			config := `
+alertmanagers:
+- static_configs: [` + strings.TrimPrefix(s.URL, "http://") + `]
+  critical: true
+  health_check_interval: 10ms
+`
+			if tc.path != "" {
+				config += "  health_check_path: " + tc.path + "\n"
+			}
+			fwder := newTestForwarder(t, config)
+
+			deadline := time.Now().Add(time.Second)
+			for {
+				mtx.Lock()
+				probed := len(paths) > 1
+				mtx.Unlock()
+				if probed {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("the endpoint wasn't probed")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			mtx.Lock()
+			if want := "GET " + tc.wantPath; paths[0] != want {
+				t.Errorf("probe = %q, want %q", paths[0], want)
+			}
+			mtx.Unlock()
+			if err := fwder.Ready(); (err == nil) != tc.wantReady {
+				t.Errorf("Ready() = %v, want ready %v", err, tc.wantReady)
+			}
+		})
+	}
+}
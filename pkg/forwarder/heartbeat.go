@@ -0,0 +1,107 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// defaultHeartbeatAlertname is the alertname of the heartbeat alert if the labels don't set it
+const defaultHeartbeatAlertname = "AlertsCollectorHeartbeat"
+
+// HeartbeatConfig configures a heartbeat alert the alerts collector forwards periodically, so the
+// upstreams can detect that the alerts collector is down when it stops firing (deadman's switch).
+type HeartbeatConfig struct {
+	// Interval the heartbeat alert is forwarded at, 0 disables the heartbeat.
+	Interval model.Duration `yaml:"interval"`
+	// Labels of the heartbeat alert, the alertname defaults to AlertsCollectorHeartbeat.
+	Labels map[string]string `yaml:"labels"`
+	// Annotations of the heartbeat alert.
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// heartbeat periodically forwards the heartbeat alert
+type heartbeat struct {
+	logger   log.Logger
+	interval time.Duration
+	alert    template.Alert
+	forward  func(context.Context, template.Alerts) error
+	now      func() time.Time
+
+	stopc chan struct{}
+	done  chan struct{}
+}
+
+// newHeartbeat starts forwarding the heartbeat alert, nil if the interval is not set
+func newHeartbeat(l log.Logger, cfg HeartbeatConfig, forward func(context.Context, template.Alerts) error) *heartbeat {
+	if cfg.Interval <= 0 {
+		return nil
+	}
+	alt := template.Alert{
+		Labels:      template.KV{model.AlertNameLabel: defaultHeartbeatAlertname},
+		Annotations: template.KV{},
+	}
+	for k, v := range cfg.Labels {
+		alt.Labels[k] = v
+	}
+	for k, v := range cfg.Annotations {
+		alt.Annotations[k] = v
+	}
+	h := &heartbeat{
+		logger:   l,
+		interval: time.Duration(cfg.Interval),
+		alert:    alt,
+		forward:  forward,
+		now:      time.Now,
+		stopc:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	h.alert.StartsAt = h.now()
+	go h.run()
+	return h
+}
+
+// run forwards the heartbeat alert at every interval until the heartbeat is stopped
+func (h *heartbeat) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.beat()
+		case <-h.stopc:
+			return
+		}
+	}
+}
+
+// beat forwards the heartbeat alert, it ends after a few missed intervals so the upstreams
+// resolve it if the alerts collector stops
+func (h *heartbeat) beat() {
+	alt := h.alert
+	alt.Status = string(model.AlertFiring)
+	alt.EndsAt = h.now().Add(3 * h.interval)
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+	defer cancel()
+	if err := h.forward(ctx, template.Alerts{alt}); err != nil {
+		level.Warn(h.logger).Log("msg", "forwarding the heartbeat alert failed", "err", err)
+	}
+}
+
+// stop stops forwarding the heartbeat alert
+func (h *heartbeat) stop() {
+	if h == nil {
+		return
+	}
+	close(h.stopc)
+	<-h.done
+}
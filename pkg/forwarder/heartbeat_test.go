@@ -0,0 +1,122 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+func TestHeartbeat(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           HeartbeatConfig
+		wantNil       bool
+		wantAlertname string
+		wantLabels    template.KV
+	}{
+		{name: "disabled", wantNil: true},
+		{
+			name:          "default alertname",
+			cfg:           HeartbeatConfig{Interval: model.Duration(10 * time.Millisecond)},
+			wantAlertname: defaultHeartbeatAlertname,
+		},
+		{
+			name: "custom labels",
+			cfg: HeartbeatConfig{
+				Interval: model.Duration(10 * time.Millisecond),
+				Labels:   map[string]string{"alertname": "Watchdog", "severity": "none"},
+			},
+			wantAlertname: "Watchdog",
+			wantLabels:    template.KV{"severity": "none"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			beats := make(chan template.Alerts, 10)
+			h := newHeartbeat(log.NewNopLogger(), tc.cfg, func(_ context.Context, alerts template.Alerts) error {
+				select {
+				case beats <- alerts:
+				default:
+				}
+				return nil
+			})
+			defer h.stop()
+			if tc.wantNil {
+				if h != nil {
+					t.Fatal("newHeartbeat() returned a heartbeat, want nil")
+				}
+				return
+			}
+
+			select {
+			case alerts := <-beats:
+				alt := alerts[0]
+				if alt.Labels["alertname"] != tc.wantAlertname {
+					t.Errorf("alertname = %q, want %q", alt.Labels["alertname"], tc.wantAlertname)
+				}
+				for k, v := range tc.wantLabels {
+					if alt.Labels[k] != v {
+						t.Errorf("label %s = %q, want %q", k, alt.Labels[k], v)
+					}
+				}
+				if !alt.EndsAt.After(time.Now()) {
+					t.Errorf("EndsAt = %v, want in the future", alt.EndsAt)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("no heartbeat forwarded")
+			}
+		})
+	}
+}
+
+func TestForwarderRunsHeartbeat(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder, err := NewForwarder(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+heartbeat:
+  interval: 10ms
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stopOnce sync.Once
+	defer stopOnce.Do(fwder.Stop)
+
+	// the forwarder isn't run, e.g. when it is built to validate a reload
+	time.Sleep(50 * time.Millisecond)
+	if got := upstream.received(); len(got) != 0 {
+		t.Fatalf("upstream received %v before the forwarder runs, want nothing", got)
+	}
+
+	fwder.Run()
+	deadline := time.Now().Add(time.Second)
+	for len(upstream.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("upstream received no heartbeat once the forwarder runs")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopOnce.Do(fwder.Stop)
+	stopped := len(upstream.received())
+	time.Sleep(50 * time.Millisecond)
+	if got := len(upstream.received()); got != stopped {
+		t.Errorf("upstream received %d heartbeats after the forwarder stopped, want none", got-stopped)
+	}
+
+	// running a stopped forwarder doesn't restart the heartbeat
+	fwder.Run()
+	time.Sleep(50 * time.Millisecond)
+	if got := len(upstream.received()); got != stopped {
+		t.Errorf("upstream received %d heartbeats after running the stopped forwarder, want none", got-stopped)
+	}
+}
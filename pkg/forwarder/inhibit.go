@@ -0,0 +1,166 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// defaultInhibitSourceTTL is the time a source alert without EndsAt inhibits the targets after it was last
+// received if resolve_timeout is not set, like the default resolve_timeout of the alertmanager
+const defaultInhibitSourceTTL = 5 * time.Minute
+
+// InhibitRuleConfig suppresses the alerts matching the target matchers while an alert
+// matching the source matchers with the same values of the equal labels is firing.
+type InhibitRuleConfig struct {
+	SourceMatchers []MatcherConfig `yaml:"source_matchers"`
+	TargetMatchers []MatcherConfig `yaml:"target_matchers"`
+	// Labels that must have the same value in the source and target alerts.
+	Equal []string `yaml:"equal"`
+}
+
+// inhibitRule is a compiled inhibition rule
+type inhibitRule struct {
+	source []*matcher
+	target []*matcher
+	equal  []string
+
+	// firing source alerts by fingerprint, the value is the key of the equal labels
+	sources map[string]sourceAlert
+}
+
+type sourceAlert struct {
+	key    string
+	endsAt time.Time
+	seen   time.Time // last time the alert was received
+}
+
+// inhibitor keeps track of the firing source alerts and drops the inhibited alerts
+type inhibitor struct {
+	logger log.Logger
+	now    func() time.Time
+	ttl    time.Duration // time a source alert without EndsAt is active after it was last received
+	redact bool          // whether the alertnames are kept out of the logs
+
+	mtx   sync.Mutex
+	rules []*inhibitRule
+}
+
+// newInhibitor compiles the inhibition rules, nil if there are none. Source alerts without EndsAt
+// expire after the ttl, the default TTL applies if it is not set.
+func newInhibitor(l log.Logger, cfgs []InhibitRuleConfig, ttl time.Duration, redact bool) (*inhibitor, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	if ttl <= 0 {
+		ttl = defaultInhibitSourceTTL
+	}
+	ih := &inhibitor{logger: l, now: time.Now, ttl: ttl, redact: redact}
+	for i, cfg := range cfgs {
+		source, err := newMatchers(cfg.SourceMatchers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source matchers in inhibit rule %d: %v", i, err)
+		}
+		target, err := newMatchers(cfg.TargetMatchers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target matchers in inhibit rule %d: %v", i, err)
+		}
+		ih.rules = append(ih.rules, &inhibitRule{
+			source:  source,
+			target:  target,
+			equal:   cfg.Equal,
+			sources: make(map[string]sourceAlert),
+		})
+	}
+	return ih, nil
+}
+
+// filter records the source alerts and returns the alerts that are not inhibited, source alerts are
+// active until they are resolved, their EndsAt has passed or, without EndsAt, the TTL has passed
+// since they were last received. Resolved alerts are never inhibited.
+func (ih *inhibitor) filter(alerts template.Alerts) template.Alerts {
+	if ih == nil {
+		return alerts
+	}
+
+	ih.mtx.Lock()
+	defer ih.mtx.Unlock()
+
+	now := ih.now()
+	for _, r := range ih.rules {
+		for _, alt := range alerts {
+			if !matchAll(r.source, alt) {
+				continue
+			}
+			fp := Fingerprint(alt)
+			if alt.Status == string(model.AlertResolved) {
+				delete(r.sources, fp)
+				continue
+			}
+			r.sources[fp] = sourceAlert{key: r.key(alt), endsAt: alt.EndsAt, seen: now}
+		}
+		for fp, src := range r.sources {
+			if src.expired(now, ih.ttl) {
+				delete(r.sources, fp)
+			}
+		}
+	}
+
+	kept := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		if ih.inhibited(alt) {
+			level.Debug(ih.logger).Log(alertKeyvals(ih.redact, alt, "msg", "alert inhibited", "fingerprint", Fingerprint(alt))...)
+			continue
+		}
+		kept = append(kept, alt)
+	}
+	return kept
+}
+
+// inhibited reports whether a firing source alert inhibits the alert, the lock must be held.
+// Resolved alerts always pass so that the upstreams don't keep them firing.
+func (ih *inhibitor) inhibited(alt template.Alert) bool {
+	if alt.Status == string(model.AlertResolved) {
+		return false
+	}
+	for _, r := range ih.rules {
+		if !matchAll(r.target, alt) {
+			continue
+		}
+		key := r.key(alt)
+		fp := Fingerprint(alt)
+		for srcFP, src := range r.sources {
+			// an alert matching both sides doesn't inhibit itself
+			if src.key == key && srcFP != fp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expired reports whether the source alert has stopped inhibiting, by its EndsAt if it is set
+// or else when the ttl has passed since it was last received
+func (src sourceAlert) expired(now time.Time, ttl time.Duration) bool {
+	if !src.endsAt.IsZero() {
+		return src.endsAt.Before(now)
+	}
+	return now.Sub(src.seen) > ttl
+}
+
+// key returns the values of the equal labels of the alert
+func (r *inhibitRule) key(alt template.Alert) string {
+	values := make([]string, 0, len(r.equal))
+	for _, name := range r.equal {
+		values = append(values, alt.Labels[name])
+	}
+	return strings.Join(values, "\xff")
+}
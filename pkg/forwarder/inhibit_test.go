@@ -0,0 +1,190 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestInhibitor(t *testing.T) {
+	rules := []InhibitRuleConfig{{
+		SourceMatchers: []MatcherConfig{{Name: "severity", Value: "critical"}},
+		TargetMatchers: []MatcherConfig{{Name: "severity", Value: "warning|info", Regex: true}},
+		Equal:          []string{"cluster"},
+	}}
+	tests := []struct {
+		name    string
+		batches []template.Alerts
+		want    []string // alertnames kept of the last batch
+	}{
+		{
+			name: "source inhibits the target of the same batch",
+			batches: []template.Alerts{{
+				withStatus("down", statusFiring, "severity", "critical", "cluster", "a"),
+				withStatus("slow", statusFiring, "severity", "warning", "cluster", "a"),
+			}},
+			want: []string{"down"},
+		},
+		{
+			name: "equal labels differ",
+			batches: []template.Alerts{{
+				withStatus("down", statusFiring, "severity", "critical", "cluster", "a"),
+				withStatus("slow", statusFiring, "severity", "warning", "cluster", "b"),
+			}},
+			want: []string{"down", "slow"},
+		},
+		{
+			name: "source of a previous batch",
+			batches: []template.Alerts{
+				{withStatus("down", statusFiring, "severity", "critical", "cluster", "a")},
+				{withStatus("slow", statusFiring, "severity", "info", "cluster", "a")},
+			},
+			want: nil,
+		},
+		{
+			name: "resolved source",
+			batches: []template.Alerts{
+				{withStatus("down", statusFiring, "severity", "critical", "cluster", "a")},
+				{withStatus("down", statusResolved, "severity", "critical", "cluster", "a")},
+				{withStatus("slow", statusFiring, "severity", "warning", "cluster", "a")},
+			},
+			want: []string{"slow"},
+		},
+		{
+			name: "expired source",
+			batches: []template.Alerts{
+				{func() template.Alert {
+					alt := withStatus("down", statusFiring, "severity", "critical", "cluster", "a")
+					alt.EndsAt = time.Now().Add(-time.Minute)
+					return alt
+				}()},
+				{withStatus("slow", statusFiring, "severity", "warning", "cluster", "a")},
+			},
+			want: []string{"slow"},
+		},
+		{
+			name: "resolved target passes",
+			batches: []template.Alerts{{
+				withStatus("down", statusFiring, "severity", "critical", "cluster", "a"),
+				withStatus("slow", statusResolved, "severity", "warning", "cluster", "a"),
+			}},
+			want: []string{"down", "slow"},
+		},
+		{
+			name: "target not matching",
+			batches: []template.Alerts{{
+				withStatus("down", statusFiring, "severity", "critical", "cluster", "a"),
+				withStatus("other", statusFiring, "severity", "critical", "cluster", "a"),
+			}},
+			want: []string{"down", "other"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ih, err := newInhibitor(log.NewNopLogger(), rules, 0, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var kept template.Alerts
+			for _, batch := range tc.batches {
+				kept = ih.filter(batch)
+			}
+			checkAlertnames(t, "kept", alertnamesOf(kept), tc.want)
+		})
+	}
+}
+
+func TestInhibitorSourceTTL(t *testing.T) {
+	rules := []InhibitRuleConfig{{
+		SourceMatchers: []MatcherConfig{{Name: "severity", Value: "critical"}},
+		TargetMatchers: []MatcherConfig{{Name: "severity", Value: "warning"}},
+	}}
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration // since the source was last received
+		want    []string
+	}{
+		{name: "within the default TTL", elapsed: defaultInhibitSourceTTL - time.Second},
+		{name: "after the default TTL", elapsed: defaultInhibitSourceTTL + time.Second, want: []string{"slow"}},
+		{name: "within resolve_timeout", ttl: time.Hour, elapsed: 30 * time.Minute},
+		{name: "after resolve_timeout", ttl: time.Minute, elapsed: 2 * time.Minute, want: []string{"slow"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ih, err := newInhibitor(log.NewNopLogger(), rules, tc.ttl, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			now := time.Now()
+			ih.now = func() time.Time { return now }
+			ih.filter(template.Alerts{withStatus("down", statusFiring, "severity", "critical")})
+
+			now = now.Add(tc.elapsed)
+			kept := ih.filter(template.Alerts{withStatus("slow", statusFiring, "severity", "warning")})
+			checkAlertnames(t, "kept", alertnamesOf(kept), tc.want)
+		})
+	}
+}
+
+func TestInhibitorOnAnnotations(t *testing.T) {
+	value := MatcherConfig{Name: "impact", Value: "outage", On: matchOnAnnotations}
+	presence := MatcherConfig{Name: "runbook_url", Value: ".+", Regex: true, On: matchOnAnnotations}
+	tests := []struct {
+		name   string
+		source MatcherConfig
+		alerts template.Alerts
+		want   []string
+	}{
+		{
+			name:   "annotation value",
+			source: value,
+			alerts: template.Alerts{withAnnotations("down", "impact", "outage"), withAnnotations("slow")},
+			want:   []string{"down"},
+		},
+		{
+			name:   "label of the annotation name",
+			source: value,
+			alerts: template.Alerts{withStatus("down", statusFiring, "impact", "outage"), withAnnotations("slow")},
+			want:   []string{"down", "slow"},
+		},
+		{
+			name:   "annotation presence",
+			source: presence,
+			alerts: template.Alerts{withAnnotations("down", "runbook_url", "https://runbooks.example.com/down"), withAnnotations("slow")},
+			want:   []string{"down"},
+		},
+		{
+			name:   "empty annotation",
+			source: presence,
+			alerts: template.Alerts{withAnnotations("down", "runbook_url", ""), withAnnotations("slow")},
+			want:   []string{"down", "slow"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ih, err := newInhibitor(log.NewNopLogger(), []InhibitRuleConfig{{
+				SourceMatchers: []MatcherConfig{tc.source},
+				TargetMatchers: []MatcherConfig{{Name: "alertname", Value: "slow"}},
+			}}, 0, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkAlertnames(t, "kept", alertnamesOf(ih.filter(tc.alerts)), tc.want)
+		})
+	}
+}
+
+func TestNewInhibitor(t *testing.T) {
+	if ih, err := newInhibitor(log.NewNopLogger(), nil, 0, false); ih != nil || err != nil {
+		t.Errorf("newInhibitor(nil) = %v, %v, want nil", ih, err)
+	}
+	_, err := newInhibitor(log.NewNopLogger(), []InhibitRuleConfig{{SourceMatchers: []MatcherConfig{{Value: "a"}}}}, 0, false)
+	if err == nil {
+		t.Error("newInhibitor() succeeded with an invalid matcher, want error")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// k8sResyncPeriod is the resync period of the informers
+	k8sResyncPeriod = 10 * time.Minute
+	// k8sCacheSyncTimeout is the time to wait for the informer caches to sync on start
+	k8sCacheSyncTimeout = time.Minute
+)
+
+// K8sEnrichConfig configures enriching alerts carrying pod and namespace labels with Kubernetes metadata.
+type K8sEnrichConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Path to the kubeconfig file, the in-cluster configuration is used if it is empty.
+	Kubeconfig string `yaml:"kubeconfig"`
+}
+
+// k8sEnricher adds the node and owner of the pod an alert refers to as labels,
+// alerts are forwarded unchanged if the lookup fails
+type k8sEnricher struct {
+	logger     log.Logger
+	pods       corelisters.PodLister
+	replicaSet appslisters.ReplicaSetLister
+	stopc      chan struct{}
+}
+
+// newK8sEnricher returns a new enricher and starts its informers, nil if enrichment is not enabled
+func newK8sEnricher(l log.Logger, cfg K8sEnrichConfig) (*k8sEnricher, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	client, err := newK8sClient(cfg.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	return startK8sEnricher(l, client)
+}
+
+// newK8sClient returns a new kubernetes client, the in-cluster configuration is used if kubeconfig is empty
+func newK8sClient(kubeconfig string) (kubernetes.Interface, error) {
+	var (
+		restCfg *rest.Config
+		err     error
+	)
+	if kubeconfig != "" {
+		restCfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	} else {
+		restCfg, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes client configuration: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	return client, nil
+}
+
+// startK8sEnricher returns a new enricher using the client and waits for the informer caches to sync
+func startK8sEnricher(l log.Logger, client kubernetes.Interface) (*k8sEnricher, error) {
+	factory := informers.NewSharedInformerFactory(client, k8sResyncPeriod)
+	e := &k8sEnricher{
+		logger:     l,
+		pods:       factory.Core().V1().Pods().Lister(),
+		replicaSet: factory.Apps().V1().ReplicaSets().Lister(),
+		stopc:      make(chan struct{}),
+	}
+	factory.Start(e.stopc)
+
+	syncc := make(chan struct{})
+	timer := time.AfterFunc(k8sCacheSyncTimeout, func() { close(syncc) })
+	defer timer.Stop()
+	for typ, synced := range factory.WaitForCacheSync(mergeStop(e.stopc, syncc)) {
+		if !synced {
+			close(e.stopc)
+			return nil, fmt.Errorf("failed to sync informer cache for %v", typ)
+		}
+	}
+	return e, nil
+}
+
+// enrich adds the node and owner labels to the alerts referring to a pod
+func (e *k8sEnricher) enrich(alerts template.Alerts) template.Alerts {
+	if e == nil {
+		return alerts
+	}
+
+	for i, alt := range alerts {
+		namespace, name := alt.Labels["namespace"], alt.Labels["pod"]
+		if namespace == "" || name == "" {
+			continue
+		}
+		pod, err := e.pods.Pods(namespace).Get(name)
+		if err != nil {
+			level.Debug(e.logger).Log("msg", "failed to look up pod, forwarding alert without kubernetes metadata", "namespace", namespace, "pod", name, "err", err)
+			continue
+		}
+
+		labels := make(template.KV, len(alt.Labels)+3)
+		for k, v := range alt.Labels {
+			labels[k] = v
+		}
+		setIfAbsent(labels, "node", pod.Spec.NodeName)
+		if owner := metav1.GetControllerOf(pod); owner != nil {
+			kind, name := owner.Kind, owner.Name
+			// resolve the deployment owning the replicaset of the pod
+			if kind == "ReplicaSet" {
+				if rs, err := e.replicaSet.ReplicaSets(namespace).Get(name); err == nil {
+					if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil {
+						kind, name = rsOwner.Kind, rsOwner.Name
+					}
+				}
+			}
+			setIfAbsent(labels, "owner_kind", kind)
+			setIfAbsent(labels, "owner_name", name)
+		}
+		alerts[i].Labels = labels
+	}
+	return alerts
+}
+
+// stop stops the informers of the enricher
+func (e *k8sEnricher) stop() {
+	if e == nil {
+		return
+	}
+	close(e.stopc)
+}
+
+// setIfAbsent sets the label if the value is not empty and the label isn't set yet
+func setIfAbsent(kv template.KV, name, value string) {
+	if _, found := kv[name]; found || value == "" {
+		return
+	}
+	kv[name] = value
+}
+
+// mergeStop returns a channel closed once any of the channels is closed
+func mergeStop(a, b <-chan struct{}) <-chan struct{} {
+	c := make(chan struct{})
+	go func() {
+		defer close(c)
+		select {
+		case <-a:
+		case <-b:
+		}
+	}()
+	return c
+}
@@ -0,0 +1,100 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// controllerRef returns the reference to the controller owning an object
+func controllerRef(kind, name string) []metav1.OwnerReference {
+	controller := true
+	return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+}
+
+func TestK8sEnricher(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "web-5d9c7-x2x4z", OwnerReferences: controllerRef("ReplicaSet", "web-5d9c7")},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+		},
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "web-5d9c7", OwnerReferences: controllerRef("Deployment", "web")},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "db-0", OwnerReferences: controllerRef("StatefulSet", "db")},
+			Spec:       corev1.PodSpec{NodeName: "node-2"},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "standalone"},
+			Spec:       corev1.PodSpec{NodeName: "node-3"},
+		},
+	)
+	e, err := startK8sEnricher(log.NewNopLogger(), client)
+	if err != nil {
+		t.Fatalf("startK8sEnricher() = %v, want nil", err)
+	}
+	defer e.stop()
+
+	tests := []struct {
+		name       string
+		labels     template.KV
+		wantLabels template.KV
+	}{
+		{
+			name:       "deployment resolved from the replicaset",
+			labels:     template.KV{"namespace": "app", "pod": "web-5d9c7-x2x4z"},
+			wantLabels: template.KV{"namespace": "app", "pod": "web-5d9c7-x2x4z", "node": "node-1", "owner_kind": "Deployment", "owner_name": "web"},
+		},
+		{
+			name:       "controller other than a replicaset",
+			labels:     template.KV{"namespace": "app", "pod": "db-0"},
+			wantLabels: template.KV{"namespace": "app", "pod": "db-0", "node": "node-2", "owner_kind": "StatefulSet", "owner_name": "db"},
+		},
+		{
+			name:       "pod without controller",
+			labels:     template.KV{"namespace": "app", "pod": "standalone"},
+			wantLabels: template.KV{"namespace": "app", "pod": "standalone", "node": "node-3"},
+		},
+		{
+			name:       "existing labels are kept",
+			labels:     template.KV{"namespace": "app", "pod": "db-0", "node": "original"},
+			wantLabels: template.KV{"namespace": "app", "pod": "db-0", "node": "original", "owner_kind": "StatefulSet", "owner_name": "db"},
+		},
+		{
+			name:       "unknown pod",
+			labels:     template.KV{"namespace": "app", "pod": "missing"},
+			wantLabels: template.KV{"namespace": "app", "pod": "missing"},
+		},
+		{
+			name:       "alert without pod",
+			labels:     template.KV{"namespace": "app"},
+			wantLabels: template.KV{"namespace": "app"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts := e.enrich(template.Alerts{{Status: statusFiring, Labels: tc.labels}})
+			if !reflect.DeepEqual(alerts[0].Labels, tc.wantLabels) {
+				t.Errorf("labels = %v, want %v", alerts[0].Labels, tc.wantLabels)
+			}
+		})
+	}
+}
+
+func TestK8sEnricherNil(t *testing.T) {
+	var e *k8sEnricher
+	alerts := template.Alerts{{Status: statusFiring, Labels: template.KV{"namespace": "app", "pod": "web"}}}
+	if got := e.enrich(alerts); !reflect.DeepEqual(got, alerts) {
+		t.Errorf("enrich() = %v with enrichment disabled, want the alerts unchanged", got)
+	}
+	e.stop()
+}
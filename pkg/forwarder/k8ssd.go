@@ -0,0 +1,107 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// KubernetesSDConfig discovers the alertmanager endpoints from the endpoints of a Kubernetes service.
+type KubernetesSDConfig struct {
+	Namespace string `yaml:"namespace"`
+	Service   string `yaml:"service"`
+	// Name or number of the endpoint port, the first port is used if it is empty.
+	Port string `yaml:"port"`
+	// Path to the kubeconfig file, the in-cluster configuration is used if it is empty.
+	Kubeconfig string `yaml:"kubeconfig"`
+}
+
+// k8sDiscoverer watches the endpoints of a service and reports the ready addresses on change
+type k8sDiscoverer struct {
+	logger log.Logger
+	cfg    KubernetesSDConfig
+	update func([]string)
+	stopc  chan struct{}
+}
+
+// newK8sDiscoverer starts watching the endpoints of the service, the addresses are passed to update on change.
+// It returns error if no kubernetes client can be created, e.g. when not running in-cluster without a kubeconfig.
+func newK8sDiscoverer(l log.Logger, cfg KubernetesSDConfig, update func([]string)) (*k8sDiscoverer, error) {
+	client, err := newK8sClient(cfg.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes service discovery of %s/%s: %v", cfg.Namespace, cfg.Service, err)
+	}
+	return startK8sDiscoverer(l, client, cfg, update), nil
+}
+
+// startK8sDiscoverer starts the endpoints informer of the service using the client
+func startK8sDiscoverer(l log.Logger, client kubernetes.Interface, cfg KubernetesSDConfig, update func([]string)) *k8sDiscoverer {
+	d := &k8sDiscoverer{
+		logger: l,
+		cfg:    cfg,
+		update: update,
+		stopc:  make(chan struct{}),
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(client, k8sResyncPeriod,
+		informers.WithNamespace(cfg.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", cfg.Service).String()
+		}),
+	)
+	factory.Core().V1().Endpoints().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { d.sync(obj) },
+		UpdateFunc: func(_, obj interface{}) { d.sync(obj) },
+		DeleteFunc: func(interface{}) { d.update(nil) },
+	})
+	factory.Start(d.stopc)
+	return d
+}
+
+// sync reports the ready addresses of the endpoints
+func (d *k8sDiscoverer) sync(obj interface{}) {
+	ep, ok := obj.(*corev1.Endpoints)
+	if !ok {
+		return
+	}
+	var addrs []string
+	for _, subset := range ep.Subsets {
+		port, found := d.port(subset.Ports)
+		if !found {
+			continue
+		}
+		for _, addr := range subset.Addresses {
+			addrs = append(addrs, net.JoinHostPort(addr.IP, strconv.Itoa(int(port))))
+		}
+	}
+	level.Debug(d.logger).Log("msg", "discovered alertmanager endpoints", "namespace", d.cfg.Namespace, "service", d.cfg.Service, "endpoints", len(addrs))
+	d.update(addrs)
+}
+
+// port returns the configured port among the endpoint ports
+func (d *k8sDiscoverer) port(ports []corev1.EndpointPort) (int32, bool) {
+	for _, p := range ports {
+		if d.cfg.Port == "" || d.cfg.Port == p.Name || d.cfg.Port == strconv.Itoa(int(p.Port)) {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
+
+// stop stops watching the endpoints
+func (d *k8sDiscoverer) stop() {
+	if d == nil {
+		return
+	}
+	close(d.stopc)
+}
@@ -0,0 +1,140 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestK8sDiscoverer(t *testing.T) {
+	tests := []struct {
+		name      string
+		port      string
+		subsets   []corev1.EndpointSubset
+		wantAddrs []string
+	}{
+		{
+			name: "first port",
+			subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}, {IP: "10.0.0.2"}},
+				Ports:     []corev1.EndpointPort{{Name: "web", Port: 9093}, {Name: "mesh", Port: 9094}},
+			}},
+			wantAddrs: []string{"10.0.0.1:9093", "10.0.0.2:9093"},
+		},
+		{
+			name: "port by name",
+			port: "mesh",
+			subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:     []corev1.EndpointPort{{Name: "web", Port: 9093}, {Name: "mesh", Port: 9094}},
+			}},
+			wantAddrs: []string{"10.0.0.1:9094"},
+		},
+		{
+			name: "port by number",
+			port: "9093",
+			subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				Ports:     []corev1.EndpointPort{{Name: "web", Port: 9093}},
+			}},
+			wantAddrs: []string{"10.0.0.1:9093"},
+		},
+		{
+			name: "not ready addresses are ignored",
+			subsets: []corev1.EndpointSubset{{
+				Addresses:         []corev1.EndpointAddress{{IP: "10.0.0.1"}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.2"}},
+				Ports:             []corev1.EndpointPort{{Port: 9093}},
+			}},
+			wantAddrs: []string{"10.0.0.1:9093"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(&corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "alertmanager"},
+				Subsets:    tc.subsets,
+			})
+			var (
+				mtx   sync.Mutex
+				addrs []string
+			)
+			d := startK8sDiscoverer(log.NewNopLogger(), client, KubernetesSDConfig{Namespace: "monitoring", Service: "alertmanager", Port: tc.port}, func(a []string) {
+				mtx.Lock()
+				defer mtx.Unlock()
+				addrs = a
+			})
+			defer d.stop()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				mtx.Lock()
+				got := append([]string(nil), addrs...)
+				mtx.Unlock()
+				sort.Strings(got)
+				if reflect.DeepEqual(got, tc.wantAddrs) {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("discovered %v, want %v", got, tc.wantAddrs)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestNewAlertmanagerWithoutKubernetesClient(t *testing.T) {
+	_, err := NewAlertmanager(log.NewNopLogger(), AlertmanagerConfig{
+		Name: "discovered",
+		EndpointsConfig: EndpointsConfig{
+			KubernetesSDConfigs: []KubernetesSDConfig{{
+				Namespace:  "monitoring",
+				Service:    "alertmanager",
+				Kubeconfig: filepath.Join(t.TempDir(), "missing"),
+			}},
+		},
+	})
+	if err == nil {
+		t.Fatal("NewAlertmanager() succeeded without a kubernetes client, want error")
+	}
+}
+
+func TestForwardWithoutEndpoints(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- name: discovered
+  static_configs: [`+upstream.addr()+`]
+`)
+	if err := fwder.Ready(); err != nil {
+		t.Fatalf("Ready() = %v with endpoints, want nil", err)
+	}
+
+	// no endpoint discovered
+	am := fwder.alertmanagers[0]
+	am.epMtx.Lock()
+	am.endpoints = nil
+	am.epMtx.Unlock()
+	if err := fwder.Forward(context.Background(), firing("a")); err == nil {
+		t.Error("Forward() succeeded without endpoints, want error")
+	}
+	if err := fwder.Ready(); err == nil {
+		t.Error("Ready() succeeded without endpoints, want error")
+	}
+	if got := upstream.received(); len(got) != 0 {
+		t.Errorf("upstream received %v, want nothing", got)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// kafkaOverflowDrop drops the alerts that don't fit into the buffer
+	kafkaOverflowDrop = "drop"
+	// kafkaOverflowBlock waits for room in the buffer until the forward context is done
+	kafkaOverflowBlock = "block"
+
+	defaultKafkaBufferSize = 1000
+	// kafkaMaxBatch is the maximum number of messages written to the brokers at once
+	kafkaMaxBatch = 100
+)
+
+// KafkaConfig configures a receiver publishing each alert as a JSON message to a Kafka topic,
+// keyed by the fingerprint of the alert.
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	Topic   string   `yaml:"topic"`
+	// TLS configuration to connect to the brokers, plain TCP is used if it isn't set.
+	TLSConfig *TLSConfig `yaml:"tls_config"`
+	// Timeout of a write to the brokers.
+	Timeout model.Duration `yaml:"timeout"`
+	// Number of alerts buffered in memory until they are written to the brokers, defaults to 1000.
+	BufferSize int `yaml:"buffer_size"`
+	// What to do when the buffer is full, drop (default) or block.
+	OverflowPolicy string `yaml:"overflow_policy"`
+}
+
+// kafkaProducer writes messages to the brokers
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Kafka is a receiver that publishes the alerts to a Kafka topic in the background,
+// so that slow brokers don't delay the forwarding to the other targets
+type Kafka struct {
+	logger   log.Logger
+	name     string
+	producer kafkaProducer
+	timeout  time.Duration
+	block    bool
+
+	queue chan kafka.Message
+	stopc chan struct{}
+	donec chan struct{}
+}
+
+// newKafka construct new Kafka receiver
+func newKafka(l log.Logger, name string, cfg KafkaConfig) (*Kafka, error) {
+	if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka receiver %q requires brokers and topic", name)
+	}
+	w := &kafka.Writer{
+		Addr:     kafka.TCP(cfg.Brokers...),
+		Topic:    cfg.Topic,
+		Balancer: &kafka.Hash{},
+	}
+	if cfg.TLSConfig != nil {
+		tlsConfig, err := config.NewTLSConfig(&config.TLSConfig{
+			CAFile:             cfg.TLSConfig.CAFile,
+			CertFile:           cfg.TLSConfig.CertFile,
+			KeyFile:            cfg.TLSConfig.KeyFile,
+			ServerName:         cfg.TLSConfig.ServerName,
+			InsecureSkipVerify: cfg.TLSConfig.InsecureSkipVerify,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tls config for kafka receiver %q: %v", name, err)
+		}
+		w.Transport = &kafka.Transport{TLS: tlsConfig}
+	}
+	return startKafka(l, name, w, cfg)
+}
+
+// startKafka returns a new Kafka receiver writing with the producer and starts its write loop
+func startKafka(l log.Logger, name string, producer kafkaProducer, cfg KafkaConfig) (*Kafka, error) {
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultKafkaBufferSize
+	}
+	timeout := time.Duration(cfg.Timeout)
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	var block bool
+	switch cfg.OverflowPolicy {
+	case "", kafkaOverflowDrop:
+	case kafkaOverflowBlock:
+		block = true
+	default:
+		return nil, fmt.Errorf("invalid overflow_policy %q for kafka receiver %q, must be %s or %s", cfg.OverflowPolicy, name, kafkaOverflowDrop, kafkaOverflowBlock)
+	}
+
+	k := &Kafka{
+		logger:   l,
+		name:     name,
+		producer: producer,
+		timeout:  timeout,
+		block:    block,
+		queue:    make(chan kafka.Message, bufferSize),
+		stopc:    make(chan struct{}),
+		donec:    make(chan struct{}),
+	}
+	go k.run()
+	return k, nil
+}
+
+// Name returns the name of the receiver
+func (k *Kafka) Name() string {
+	return k.name
+}
+
+// Send buffers the alerts as messages, the alerts that don't fit into a full buffer are dropped
+// or wait for room depending on the overflow policy
+func (k *Kafka) Send(ctx context.Context, alerts template.Alerts) error {
+	var dropped int
+	for _, alt := range alerts {
+		value, err := json.Marshal(alt)
+		if err != nil {
+			return fmt.Errorf("failed to encode alert: %v", err)
+		}
+		msg := kafka.Message{Key: []byte(Fingerprint(alt)), Value: value}
+
+		if k.block {
+			select {
+			case k.queue <- msg:
+			case <-ctx.Done():
+				return fmt.Errorf("kafka buffer is full: %v", ctx.Err())
+			}
+			continue
+		}
+		select {
+		case k.queue <- msg:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("kafka buffer is full, dropped %d alerts", dropped)
+	}
+	return nil
+}
+
+// run writes the buffered messages to the brokers until the receiver is stopped
+func (k *Kafka) run() {
+	defer close(k.donec)
+	for {
+		select {
+		case msg := <-k.queue:
+			k.write(msg)
+		case <-k.stopc:
+			// flush the buffered messages
+			for {
+				select {
+				case msg := <-k.queue:
+					k.write(msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes the message along with the other buffered messages
+func (k *Kafka) write(msg kafka.Message) {
+	msgs := []kafka.Message{msg}
+	for len(msgs) < kafkaMaxBatch {
+		select {
+		case msg := <-k.queue:
+			msgs = append(msgs, msg)
+			continue
+		default:
+		}
+		break
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+	defer cancel()
+	if err := k.producer.WriteMessages(ctx, msgs...); err != nil {
+		level.Warn(k.logger).Log("msg", "writing alerts to kafka failed", "receiver", k.name, "numAlerts", len(msgs), "err", err)
+	}
+}
+
+// stop flushes the buffered messages until the context is done and closes the producer
+func (k *Kafka) stop(ctx context.Context) {
+	close(k.stopc)
+	select {
+	case <-k.donec:
+	case <-ctx.Done():
+		level.Warn(k.logger).Log("msg", "drain timeout exceeded, dropping buffered kafka messages", "receiver", k.name)
+	}
+	if err := k.producer.Close(); err != nil {
+		level.Warn(k.logger).Log("msg", "closing kafka producer failed", "receiver", k.name, "err", err)
+	}
+}
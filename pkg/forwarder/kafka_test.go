@@ -0,0 +1,147 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/segmentio/kafka-go"
+)
+
+// testProducer records the written messages, the writes wait until release is closed
+type testProducer struct {
+	release chan struct{}
+
+	mtx    sync.Mutex
+	msgs   []kafka.Message
+	closed bool
+}
+
+func (p *testProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *testProducer) Close() error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.closed = true
+	return nil
+}
+
+// written returns the alertnames of the written messages
+func (p *testProducer) written(t *testing.T) []string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	names := make([]string, 0, len(p.msgs))
+	for _, msg := range p.msgs {
+		var alt template.Alert
+		if err := json.Unmarshal(msg.Value, &alt); err != nil {
+			t.Fatalf("failed to decode message: %v", err)
+		}
+		if string(msg.Key) != Fingerprint(alt) {
+			t.Errorf("message key %q, want the fingerprint %q", msg.Key, Fingerprint(alt))
+		}
+		names = append(names, alt.Labels["alertname"])
+	}
+	return names
+}
+
+func TestKafka(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         KafkaConfig
+		released    bool
+		alerts      template.Alerts
+		wantErr     bool
+		wantWritten []string
+	}{
+		{
+			name:        "written on stop",
+			cfg:         KafkaConfig{BufferSize: 10},
+			released:    true,
+			alerts:      firing("a", "b"),
+			wantWritten: []string{"a", "b"},
+		},
+		{
+			// the write loop takes the first alert and waits for the producer
+			name:        "overflow dropped",
+			cfg:         KafkaConfig{BufferSize: 1},
+			alerts:      firing("a", "b", "c", "d"),
+			wantErr:     true,
+			wantWritten: []string{"a", "b"},
+		},
+		{
+			name:        "overflow blocks until the context is done",
+			cfg:         KafkaConfig{BufferSize: 1, OverflowPolicy: kafkaOverflowBlock},
+			alerts:      firing("a", "b", "c", "d"),
+			wantErr:     true,
+			wantWritten: []string{"a", "b"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &testProducer{release: make(chan struct{})}
+			if tc.released {
+				close(p.release)
+			}
+			k, err := startKafka(log.NewNopLogger(), "kafka", p, tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			for i, alt := range tc.alerts {
+				err = k.Send(ctx, template.Alerts{alt})
+				if i == 0 {
+					// let the write loop take the first message
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+			if (err != nil) != tc.wantErr {
+				t.Errorf("Send() error = %v, want error %v", err, tc.wantErr)
+			}
+
+			if !tc.released {
+				close(p.release)
+			}
+			k.stop(context.Background())
+			checkAlertnames(t, "written", p.written(t), tc.wantWritten)
+			if !p.closed {
+				t.Error("the producer wasn't closed")
+			}
+		})
+	}
+}
+
+func TestNewKafkaInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  KafkaConfig
+	}{
+		{name: "missing brokers", cfg: KafkaConfig{Topic: "alerts"}},
+		{name: "missing topic", cfg: KafkaConfig{Brokers: []string{"localhost:9092"}}},
+		{name: "invalid overflow policy", cfg: KafkaConfig{Brokers: []string{"localhost:9092"}, Topic: "alerts", OverflowPolicy: "queue"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newKafka(log.NewNopLogger(), "kafka", tc.cfg); err == nil {
+				t.Error("newKafka() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// defaultAlertnamesWindow is the window used to track distinct alertnames if it is not configured
+const defaultAlertnamesWindow = time.Hour
+
+// alertnameLimiter caps the number of distinct alertnames seen within a sliding window
+type alertnameLimiter struct {
+	logger log.Logger
+	max    int
+	window time.Duration
+	redact bool // whether the alertnames are kept out of the logs
+	now    func() time.Time
+
+	mtx  sync.Mutex
+	seen map[string]time.Time // alertname -> last seen time
+}
+
+// newAlertnameLimiter returns a new alertname limiter, nil if the limit is not set
+func newAlertnameLimiter(l log.Logger, max int, window time.Duration, redact bool) *alertnameLimiter {
+	if max <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = defaultAlertnamesWindow
+	}
+	return &alertnameLimiter{
+		logger: l,
+		max:    max,
+		window: window,
+		redact: redact,
+		now:    time.Now,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// filter returns the alerts whose alertname is either already known in the window or still fits into the cap
+func (lm *alertnameLimiter) filter(alerts template.Alerts) template.Alerts {
+	if lm == nil {
+		return alerts
+	}
+
+	lm.mtx.Lock()
+	defer lm.mtx.Unlock()
+
+	now := lm.now()
+	for name, ts := range lm.seen {
+		if now.Sub(ts) > lm.window {
+			delete(lm.seen, name)
+		}
+	}
+
+	filtered := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		name := alt.Labels[model.AlertNameLabel]
+		if _, found := lm.seen[name]; !found && len(lm.seen) >= lm.max {
+			level.Warn(lm.logger).Log(alertKeyvals(lm.redact, alt, "msg", "too many distinct alertnames, dropping alert", "fingerprint", Fingerprint(alt), "limit", lm.max)...)
+			continue
+		}
+		lm.seen[name] = now
+		filtered = append(filtered, alt)
+	}
+	return filtered
+}
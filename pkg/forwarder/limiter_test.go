@@ -0,0 +1,73 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestAlertnameLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		max     int
+		batches [][]string    // alertnames of the batches filtered in order
+		advance time.Duration // clock advance between the batches
+		want    []string      // alertnames kept from the last batch
+	}{
+		{
+			name:    "disabled",
+			batches: [][]string{{"a", "b", "c"}},
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:    "new alertnames above the cap are dropped",
+			max:     2,
+			batches: [][]string{{"a", "b", "c", "a"}},
+			want:    []string{"a", "b", "a"},
+		},
+		{
+			name:    "known alertnames are kept",
+			max:     2,
+			batches: [][]string{{"a", "b"}, {"c", "b", "a"}},
+			want:    []string{"b", "a"},
+		},
+		{
+			name:    "alertnames expire after the window",
+			max:     2,
+			batches: [][]string{{"a", "b"}, {"c"}},
+			advance: 2 * time.Minute,
+			want:    []string{"c"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			lm := newAlertnameLimiter(log.NewNopLogger(), tc.max, time.Minute, false)
+			if lm != nil {
+				lm.now = func() time.Time { return now }
+			}
+			var got []string
+			for _, names := range tc.batches {
+				got = alertnamesOf(lm.filter(firing(names...)))
+				now = now.Add(tc.advance)
+			}
+			checkAlertnames(t, "limiter", got, tc.want)
+			if len(got) != len(tc.want) {
+				t.Errorf("kept %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// alertnamesOf returns the alertnames of the alerts
+func alertnamesOf(alerts []template.Alert) []string {
+	names := make([]string, 0, len(alerts))
+	for _, alt := range alerts {
+		names = append(names, alt.Labels["alertname"])
+	}
+	return names
+}
@@ -0,0 +1,95 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// matcher targets
+const (
+	matchOnLabels      = "labels"
+	matchOnAnnotations = "annotations"
+)
+
+// MatcherConfig matches the value of an alert label or annotation.
+type MatcherConfig struct {
+	// Name of the label or annotation.
+	Name string `yaml:"name"`
+	// Value to match, a missing label or annotation matches the empty value,
+	// use the regular expression .+ to match its presence.
+	Value string `yaml:"value"`
+	// Match the value as a regular expression anchored at both ends.
+	Regex bool `yaml:"regex"`
+	// What the matcher targets, either labels (default) or annotations.
+	On string `yaml:"on"`
+}
+
+// matcher is a compiled matcher
+type matcher struct {
+	name        string
+	value       string
+	re          *regexp.Regexp
+	annotations bool
+}
+
+// newMatcher compiles the matcher configuration
+func newMatcher(cfg MatcherConfig) (*matcher, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("missing label name in matcher")
+	}
+	m := &matcher{name: cfg.Name, value: cfg.Value}
+	switch cfg.On {
+	case "", matchOnLabels:
+	case matchOnAnnotations:
+		m.annotations = true
+	default:
+		return nil, fmt.Errorf("invalid matcher target %q for %q, must be %s or %s", cfg.On, cfg.Name, matchOnLabels, matchOnAnnotations)
+	}
+	if cfg.Regex {
+		re, err := regexp.Compile("^(?:" + cfg.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q for label %q: %v", cfg.Value, cfg.Name, err)
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// newMatchers compiles the matcher configurations
+func newMatchers(cfgs []MatcherConfig) ([]*matcher, error) {
+	matchers := make([]*matcher, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		m, err := newMatcher(cfg)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+// matches reports whether the alert matches the matcher
+func (m *matcher) matches(alt template.Alert) bool {
+	v := alt.Labels[m.name]
+	if m.annotations {
+		v = alt.Annotations[m.name]
+	}
+	if m.re != nil {
+		return m.re.MatchString(v)
+	}
+	return v == m.value
+}
+
+// matchAll reports whether the alert matches all the matchers
+func matchAll(matchers []*matcher, alt template.Alert) bool {
+	for _, m := range matchers {
+		if !m.matches(alt) {
+			return false
+		}
+	}
+	return true
+}
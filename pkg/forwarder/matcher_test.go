@@ -0,0 +1,74 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestMatcher(t *testing.T) {
+	alt := template.Alert{
+		Labels:      template.KV{"alertname": "KubePodCrashLooping", "namespace": "open-cluster-management"},
+		Annotations: template.KV{"runbook_url": "https://runbooks.example.com/crashloop"},
+	}
+	tests := []struct {
+		name    string
+		cfg     MatcherConfig
+		want    bool
+		wantErr bool
+	}{
+		{name: "equal label", cfg: MatcherConfig{Name: "alertname", Value: "KubePodCrashLooping"}, want: true},
+		{name: "different label", cfg: MatcherConfig{Name: "alertname", Value: "Watchdog"}},
+		{name: "missing label matches the empty value", cfg: MatcherConfig{Name: "severity"}, want: true},
+		{name: "anchored regex", cfg: MatcherConfig{Name: "namespace", Value: "open-cluster", Regex: true}},
+		{name: "regex", cfg: MatcherConfig{Name: "namespace", Value: "open-cluster-.*", Regex: true}, want: true},
+		{name: "presence", cfg: MatcherConfig{Name: "severity", Value: ".+", Regex: true}},
+		{name: "annotation", cfg: MatcherConfig{Name: "runbook_url", Value: "https://.*", Regex: true, On: matchOnAnnotations}, want: true},
+		{name: "annotation isn't a label", cfg: MatcherConfig{Name: "runbook_url", Value: ".+", Regex: true}},
+		{name: "missing name", cfg: MatcherConfig{Value: "a"}, wantErr: true},
+		{name: "invalid target", cfg: MatcherConfig{Name: "a", On: "headers"}, wantErr: true},
+		{name: "invalid regex", cfg: MatcherConfig{Name: "a", Value: "(", Regex: true}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := newMatcher(tc.cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newMatcher() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := m.matches(alt); got != tc.want {
+				t.Errorf("matches() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchAll(t *testing.T) {
+	matchers, err := newMatchers([]MatcherConfig{
+		{Name: "alertname", Value: "a"},
+		{Name: "severity", Value: "critical|warning", Regex: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		labels template.KV
+		want   bool
+	}{
+		{labels: template.KV{"alertname": "a", "severity": "critical"}, want: true},
+		{labels: template.KV{"alertname": "a", "severity": "info"}},
+		{labels: template.KV{"alertname": "b", "severity": "warning"}},
+	}
+	for _, tc := range tests {
+		if got := matchAll(matchers, template.Alert{Labels: tc.labels}); got != tc.want {
+			t.Errorf("matchAll(%v) = %v, want %v", tc.labels, got, tc.want)
+		}
+	}
+	if !matchAll(nil, template.Alert{}) {
+		t.Error("matchAll() without matchers = false, want true")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	breakerStateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "alerts_collector_circuit_breaker_state",
+		Help: "State of the circuit breaker for the upstream endpoint (0: closed, 1: open, 2: half-open).",
+	}, []string{"endpoint"})
+
+	payloadBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "alerts_collector_payload_bytes",
+		Help:    "Size in bytes of the payloads posted to the alertmanagers.",
+		Buckets: prometheus.ExponentialBuckets(256, 4, 8),
+	}, []string{"alertmanager"})
+
+	upstreamUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "alerts_collector_upstream_up",
+		Help: "Whether the last alerts posted to the upstream endpoint were accepted (1) or not (0).",
+	}, []string{"endpoint"})
+
+	upstreamLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "alerts_collector_upstream_last_success_timestamp_seconds",
+		Help: "Timestamp of the last time the upstream endpoint accepted alerts.",
+	}, []string{"endpoint"})
+
+	rateLimitedAlerts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "alerts_collector_rate_limited_alerts_total",
+		Help: "Number of alerts beyond max_alerts_per_minute, by action (drop or buffer).",
+	}, []string{"action"})
+
+	queueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "alerts_collector_queue_depth",
+		Help: "Number of upstream requests waiting for a slot of max_concurrent_forwards.",
+	})
+
+	queueCapacity = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "alerts_collector_queue_capacity",
+		Help: "Maximum number of in-flight upstream requests set by max_concurrent_forwards, 0 means no limit.",
+	})
+
+	workersBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "alerts_collector_workers_busy",
+		Help: "Number of slots of max_concurrent_forwards taken by in-flight upstream requests.",
+	})
+
+	lastSuccess = newLastSuccessCollector()
+
+	// endpointRefs counts the alertmanagers using each upstream endpoint
+	endpointRefs = struct {
+		sync.Mutex
+		n map[string]int
+	}{n: make(map[string]int)}
+)
+
+func init() {
+	prometheus.MustRegister(breakerStateGauge)
+	prometheus.MustRegister(payloadBytes)
+	prometheus.MustRegister(upstreamUp)
+	prometheus.MustRegister(upstreamLastSuccess)
+	prometheus.MustRegister(rateLimitedAlerts)
+	prometheus.MustRegister(queueDepth)
+	prometheus.MustRegister(queueCapacity)
+	prometheus.MustRegister(workersBusy)
+	prometheus.MustRegister(lastSuccess)
+}
+
+// acquireEndpoint records that an alertmanager uses the upstream endpoint
+func acquireEndpoint(endpoint string) {
+	endpointRefs.Lock()
+	defer endpointRefs.Unlock()
+	endpointRefs.n[endpoint]++
+}
+
+// releaseEndpoint records that an alertmanager no longer uses the upstream endpoint, e.g. it left the
+// discovered endpoints or the forwarder was stopped, and deletes its series once no alertmanager uses it
+func releaseEndpoint(endpoint string) {
+	endpointRefs.Lock()
+	defer endpointRefs.Unlock()
+	if endpointRefs.n[endpoint]--; endpointRefs.n[endpoint] > 0 {
+		return
+	}
+	delete(endpointRefs.n, endpoint)
+	upstreamUp.DeleteLabelValues(endpoint)
+	upstreamLastSuccess.DeleteLabelValues(endpoint)
+	breakerStateGauge.DeleteLabelValues(endpoint)
+}
+
+// lastSuccessKey identifies an alertmanager or a receiver across the routing groups
+type lastSuccessKey struct {
+	group    string // name of the routing group, empty for the top level
+	receiver string // name of the receiver, or of the alertmanager or alertmanagers[<index>] if it has none
+}
+
+// lastSuccessCollector exposes the seconds since the last successful forward per receiver,
+// receivers that never succeeded count from the time they were created
+type lastSuccessCollector struct {
+	desc *prometheus.Desc
+	now  func() time.Time
+
+	mtx  sync.Mutex
+	last map[lastSuccessKey]time.Time // receiver -> time of the last successful forward
+}
+
+func newLastSuccessCollector() *lastSuccessCollector {
+	return &lastSuccessCollector{
+		desc: prometheus.NewDesc(
+			"alerts_collector_seconds_since_last_success",
+			"Seconds since alerts were last forwarded successfully to the receiver.",
+			[]string{"group", "receiver"}, nil,
+		),
+		now:  time.Now,
+		last: make(map[lastSuccessKey]time.Time),
+	}
+}
+
+// reset tracks only the receivers of a newly built forwarder, the receivers already tracked
+// keep the time of their last success and the receivers that are gone are dropped
+func (c *lastSuccessCollector) reset(receivers []lastSuccessKey) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	last := make(map[lastSuccessKey]time.Time, len(receivers))
+	for _, k := range receivers {
+		if ts, found := c.last[k]; found {
+			last[k] = ts
+		} else {
+			last[k] = c.now()
+		}
+	}
+	c.last = last
+}
+
+// success records a successful forward to the receiver if it is tracked,
+// a forwarder replaced by a reload doesn't bring back the receivers it dropped
+func (c *lastSuccessCollector) success(k lastSuccessKey) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if _, found := c.last[k]; found {
+		c.last[k] = c.now()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *lastSuccessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *lastSuccessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	for k, ts := range c.last {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(ts).Seconds(), k.group, k.receiver)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/model"
+)
+
+func TestLastSuccessCollector(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newLastSuccessCollector()
+	c.now = func() time.Time { return now }
+
+	c.reset([]lastSuccessKey{{receiver: "a"}, {group: "team", receiver: "a"}})
+	now = now.Add(time.Minute)
+	c.success(lastSuccessKey{group: "team", receiver: "a"})
+	c.success(lastSuccessKey{receiver: "untracked"})
+	now = now.Add(30 * time.Second)
+
+	want := `
+# HELP alerts_collector_seconds_since_last_success Seconds since alerts were last forwarded successfully to the receiver.
+# TYPE alerts_collector_seconds_since_last_success gauge
+alerts_collector_seconds_since_last_success{group="",receiver="a"} 90
+alerts_collector_seconds_since_last_success{group="team",receiver="a"} 30
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// a rebuilt forwarder keeps the times of the receivers it still has and drops the others
+	now = now.Add(30 * time.Second)
+	c.reset([]lastSuccessKey{{group: "team", receiver: "a"}, {receiver: "b"}})
+	now = now.Add(30 * time.Second)
+	want = `
+# HELP alerts_collector_seconds_since_last_success Seconds since alerts were last forwarded successfully to the receiver.
+# TYPE alerts_collector_seconds_since_last_success gauge
+alerts_collector_seconds_since_last_success{group="",receiver="b"} 30
+alerts_collector_seconds_since_last_success{group="team",receiver="a"} 90
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+// lastSuccessReceivers returns the group/receiver label pairs of the last success metric
+func lastSuccessReceivers(t *testing.T) []string {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(lastSuccess)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string)
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			got = append(got, labels["group"]+"/"+labels["receiver"])
+		}
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestForwardLastSuccess(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- name: a
+  static_configs: [`+upstream.addr()+`]
+- static_configs: [`+upstream.addr()+`]
+routing_groups:
+- name: team
+  alertmanagers:
+  - name: a
+    static_configs: [`+upstream.addr()+`]
+`)
+	want := []string{"/a", "/alertmanagers[1]", "team/a"}
+	if got := lastSuccessReceivers(t); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("last success receivers = %v, want %v", got, want)
+	}
+
+	// the receivers of the previous configuration are dropped on rebuild, successes of the
+	// replaced forwarder don't bring them back
+	newTestForwarder(t, `
+alertmanagers:
+- name: b
+  static_configs: [`+upstream.addr()+`]
+`)
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	want = []string{"/b"}
+	if got := lastSuccessReceivers(t); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("last success receivers = %v, want %v", got, want)
+	}
+}
+
+// endpointSeries returns the names of the metrics with a series of the endpoint
+func endpointSeries(t *testing.T, endpoint string) []string {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(upstreamUp, upstreamLastSuccess, breakerStateGauge)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "endpoint" && lp.GetValue() == endpoint {
+					names = append(names, mf.GetName())
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestEndpointSeries(t *testing.T) {
+	ok := newTestAlertmanager(t, http.StatusOK)
+	failing := newTestAlertmanager(t, http.StatusInternalServerError)
+	config := `
+alertmanagers:
+- static_configs: [` + ok.addr() + `]
+- static_configs: [` + failing.addr() + `]
+  circuit_breaker:
+    failure_threshold: 1
+`
+	okEndpoint, failingEndpoint := ok.URL+"/", failing.URL+"/"
+
+	fwder := newTestForwarder(t, config)
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward() error = %v", err)
+	}
+	wantOK := []string{"alerts_collector_upstream_last_success_timestamp_seconds", "alerts_collector_upstream_up"}
+	wantFailing := []string{"alerts_collector_circuit_breaker_state", "alerts_collector_upstream_up"}
+	if got := endpointSeries(t, okEndpoint); strings.Join(got, " ") != strings.Join(wantOK, " ") {
+		t.Fatalf("series of %s = %v, want %v", okEndpoint, got, wantOK)
+	}
+	if got := endpointSeries(t, failingEndpoint); strings.Join(got, " ") != strings.Join(wantFailing, " ") {
+		t.Fatalf("series of %s = %v, want %v", failingEndpoint, got, wantFailing)
+	}
+
+	// the series are kept while a reloaded forwarder uses the endpoints
+	reloaded := newTestForwarder(t, config)
+	fwder.Stop()
+	if got := endpointSeries(t, okEndpoint); len(got) == 0 {
+		t.Errorf("series of %s were deleted while the endpoint is used", okEndpoint)
+	}
+
+	reloaded.Stop()
+	for _, endpoint := range []string{okEndpoint, failingEndpoint} {
+		if got := endpointSeries(t, endpoint); len(got) != 0 {
+			t.Errorf("series of %s = %v after the forwarder stopped, want none", endpoint, got)
+		}
+	}
+}
+
+func TestDiscoveredEndpointSeries(t *testing.T) {
+	am, err := NewAlertmanager(log.NewNopLogger(), AlertmanagerConfig{
+		EndpointsConfig: EndpointsConfig{StaticAddresses: []string{"static:9093"}, Scheme: "http"},
+		Timeout:         model.Duration(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer am.stop()
+	am.discovered = make([][]*url.URL, 1)
+
+	am.setDiscovered(0, []string{"a:9093", "b:9093"})
+	for _, u := range am.currentEndpoints() {
+		upstreamUp.WithLabelValues(u.String()).Set(1)
+		am.breaker(u).failure()
+	}
+
+	am.setDiscovered(0, []string{"b:9093"})
+	for endpoint, want := range map[string]bool{"http://static:9093/": true, "http://a:9093/": false, "http://b:9093/": true} {
+		if got := len(endpointSeries(t, endpoint)) > 0; got != want {
+			t.Errorf("series of %s present = %v, want %v", endpoint, got, want)
+		}
+	}
+	if _, found := am.breakers["http://a:9093/"]; found {
+		t.Error("the circuit breaker of the endpoint that left the discovered endpoints is kept")
+	}
+}
+
+// payloadSamples returns the number of payload sizes observed for the alertmanager
+func payloadSamples(t *testing.T, alertmanager string) uint64 {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(payloadBytes)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "alertmanager" && lp.GetValue() == alertmanager {
+					return m.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestPayloadBytes(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- name: payload-bytes
+  static_configs: [`+upstream.addr()+`]
+  max_alerts_per_request: 2
+`)
+	payloadBytes.DeleteLabelValues("payload-bytes")
+	series := testutil.CollectAndCount(payloadBytes)
+
+	// the batch is split into 3 requests, each posted payload is observed
+	if err := fwder.Forward(context.Background(), firing("a", "b", "c", "d", "e")); err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+	upstream.mtx.Lock()
+	requests := len(upstream.requests)
+	upstream.mtx.Unlock()
+	if requests != 3 {
+		t.Fatalf("upstream received %d requests, want 3", requests)
+	}
+	if got := testutil.CollectAndCount(payloadBytes); got != series+1 {
+		t.Errorf("%d payload size series, want %d", got, series+1)
+	}
+	if got := payloadSamples(t, "payload-bytes"); got != 3 {
+		t.Errorf("%d payload sizes observed, want 3", got)
+	}
+
+	if err := fwder.Forward(context.Background(), firing("f")); err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+	if got := payloadSamples(t, "payload-bytes"); got != 4 {
+		t.Errorf("%d payload sizes observed after another POST, want 4", got)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/version"
+)
+
+// defaultOTLPLogsURL is the default OTLP/HTTP logs endpoint of a local collector
+const defaultOTLPLogsURL = "http://localhost:4318/v1/logs"
+
+// OTLPConfig configures a receiver exporting alerts as OpenTelemetry log records with OTLP over HTTP.
+type OTLPConfig struct {
+	HTTPClientConfig ClientConfig   `yaml:"http_config"`
+	Timeout          model.Duration `yaml:"timeout"`
+	// URL of the OTLP/HTTP logs endpoint, defaults to http://localhost:4318/v1/logs.
+	URL string `yaml:"url"`
+	// Custom HTTP headers added to the requests, e.g. for authentication.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// OTLP is a receiver that exports each alert as an OpenTelemetry log record
+type OTLP struct {
+	logger  log.Logger
+	name    string
+	client  *http.Client
+	url     string
+	timeout time.Duration
+	header  http.Header
+}
+
+// newOTLP construct new OTLP receiver
+func newOTLP(l log.Logger, name string, cfg OTLPConfig) (*OTLP, error) {
+	client, err := createHTTPClient(cfg.HTTPClientConfig, "alerts-collector")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client for otlp receiver %q: %v", name, err)
+	}
+	u := cfg.URL
+	if u == "" {
+		u = defaultOTLPLogsURL
+	}
+	header := make(http.Header)
+	for k, v := range cfg.Headers {
+		header.Set(k, v)
+	}
+	header.Set("Content-Type", "application/x-protobuf")
+
+	return &OTLP{
+		logger:  l,
+		name:    name,
+		client:  client,
+		url:     u,
+		timeout: time.Duration(cfg.Timeout),
+		header:  header,
+	}, nil
+}
+
+// Name returns the name of the receiver
+func (o *OTLP) Name() string {
+	return o.name
+}
+
+// Send exports the alerts as log records in a single OTLP request
+func (o *OTLP) Send(ctx context.Context, alerts template.Alerts) error {
+	records := make([]*logspb.LogRecord, 0, len(alerts))
+	for _, alt := range alerts {
+		records = append(records, logRecord(alt))
+	}
+	req := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{
+					stringAttribute("service.name", "alerts-collector"),
+					stringAttribute("service.version", version.Version),
+				},
+			},
+			InstrumentationLibraryLogs: []*logspb.InstrumentationLibraryLogs{{
+				InstrumentationLibrary: &commonpb.InstrumentationLibrary{Name: "alerts-collector"},
+				Logs:                   records,
+			}},
+		}},
+	}
+
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode otlp logs request: %v", err)
+	}
+	return post(ctx, o.client, o.url, o.timeout, o.header, body)
+}
+
+// logRecord maps the alert to a log record, the labels and annotations become attributes
+func logRecord(alt template.Alert) *logspb.LogRecord {
+	ts := alt.StartsAt
+	if alt.Status == string(model.AlertResolved) && !alt.EndsAt.IsZero() {
+		ts = alt.EndsAt
+	}
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	body := alt.Annotations["summary"]
+	if body == "" {
+		body = alt.Labels[model.AlertNameLabel]
+	}
+
+	attrs := make([]*commonpb.KeyValue, 0, len(alt.Labels)+len(alt.Annotations)+3)
+	attrs = append(attrs,
+		stringAttribute("alert.status", alt.Status),
+		stringAttribute("alert.fingerprint", Fingerprint(alt)),
+	)
+	if alt.GeneratorURL != "" {
+		attrs = append(attrs, stringAttribute("alert.generator_url", alt.GeneratorURL))
+	}
+	for _, k := range alt.Labels.SortedPairs().Names() {
+		attrs = append(attrs, stringAttribute(k, alt.Labels[k]))
+	}
+	for _, k := range alt.Annotations.SortedPairs().Names() {
+		attrs = append(attrs, stringAttribute("annotations."+k, alt.Annotations[k]))
+	}
+
+	severity := alt.Labels["severity"]
+	return &logspb.LogRecord{
+		TimeUnixNano:   uint64(ts.UnixNano()),
+		SeverityNumber: severityNumber(severity),
+		SeverityText:   severity,
+		Name:           alt.Labels[model.AlertNameLabel],
+		Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}},
+		Attributes:     attrs,
+	}
+}
+
+// severityNumber maps the alert severity to the OpenTelemetry severity number
+func severityNumber(severity string) logspb.SeverityNumber {
+	switch strings.ToLower(severity) {
+	case "critical":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	case "error":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	case "warning":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case "info":
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED
+	}
+}
+
+func stringAttribute(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
@@ -0,0 +1,91 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLP(t *testing.T) {
+	requests := make(chan *collogspb.ExportLogsServiceRequest, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("Content-Type = %q, want application/x-protobuf", ct)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("Authorization = %q, want the configured header", auth)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		req := &collogspb.ExportLogsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("failed to decode the request: %v", err)
+		}
+		requests <- req
+	}))
+	defer s.Close()
+
+	o, err := newOTLP(log.NewNopLogger(), "otlp", OTLPConfig{URL: s.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startsAt := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	endsAt := startsAt.Add(time.Hour)
+	err = o.Send(context.Background(), template.Alerts{
+		{Status: statusFiring, Labels: template.KV{"alertname": "a", "severity": "critical"}, Annotations: template.KV{"summary": "a is down"}, StartsAt: startsAt},
+		{Status: statusResolved, Labels: template.KV{"alertname": "b", "severity": "P3"}, StartsAt: startsAt, EndsAt: endsAt},
+	})
+	if err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+
+	req := <-requests
+	records := req.ResourceLogs[0].InstrumentationLibraryLogs[0].Logs
+	if len(records) != 2 {
+		t.Fatalf("received %d log records, want 2", len(records))
+	}
+	tests := []struct {
+		name     string
+		record   *logspb.LogRecord
+		body     string
+		severity logspb.SeverityNumber
+		ts       time.Time
+		status   string
+	}{
+		{name: "firing", record: records[0], body: "a is down", severity: logspb.SeverityNumber_SEVERITY_NUMBER_FATAL, ts: startsAt, status: statusFiring},
+		{name: "resolved", record: records[1], body: "b", severity: logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, ts: endsAt, status: statusResolved},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.record.Body.GetStringValue(); got != tc.body {
+				t.Errorf("body = %q, want %q", got, tc.body)
+			}
+			if tc.record.SeverityNumber != tc.severity {
+				t.Errorf("severity = %v, want %v", tc.record.SeverityNumber, tc.severity)
+			}
+			if tc.record.TimeUnixNano != uint64(tc.ts.UnixNano()) {
+				t.Errorf("time = %v, want %v", time.Unix(0, int64(tc.record.TimeUnixNano)).UTC(), tc.ts)
+			}
+			attrs := make(map[string]string)
+			for _, kv := range tc.record.Attributes {
+				attrs[kv.Key] = kv.Value.GetStringValue()
+			}
+			if attrs["alert.status"] != tc.status || attrs["alertname"] != tc.record.Name {
+				t.Errorf("attributes = %v, want the status %s and the labels", attrs, tc.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// defaultPagerDutyURL is the endpoint of the PagerDuty Events API v2
+	defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	// defaultPagerDutySeverity is used for alerts whose severity can't be mapped
+	defaultPagerDutySeverity = "error"
+)
+
+// PagerDutyConfig configures a receiver sending alerts to the PagerDuty Events API v2.
+type PagerDutyConfig struct {
+	HTTPClientConfig ClientConfig   `yaml:"http_config"`
+	Timeout          model.Duration `yaml:"timeout"`
+	// Integration key of the PagerDuty service.
+	RoutingKey string `yaml:"routing_key"`
+	// File containing the integration key, e.g. mounted from a Kubernetes secret.
+	RoutingKeyFile string `yaml:"routing_key_file"`
+	// URL of the Events API, defaults to the PagerDuty SaaS endpoint.
+	URL string `yaml:"url"`
+	// Maps the value of the alert severity label to a PagerDuty severity (critical, error, warning or info).
+	SeverityMapping map[string]string `yaml:"severity_mapping"`
+}
+
+// pagerDutyEvent is the payload of the PagerDuty Events API v2
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	Links       []pagerDutyLink   `json:"links,omitempty"`
+}
+
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Timestamp     string            `json:"timestamp,omitempty"`
+	CustomDetails map[string]string `json:"custom_details,omitempty"`
+}
+
+type pagerDutyLink struct {
+	Href string `json:"href"`
+	Text string `json:"text"`
+}
+
+// PagerDuty is a receiver that sends alerts as PagerDuty events
+type PagerDuty struct {
+	logger   log.Logger
+	name     string
+	client   *http.Client
+	url      string
+	timeout  time.Duration
+	key      string
+	severity map[string]string
+}
+
+// newPagerDuty construct new PagerDuty receiver
+func newPagerDuty(l log.Logger, name string, cfg PagerDutyConfig) (*PagerDuty, error) {
+	key := cfg.RoutingKey
+	if cfg.RoutingKeyFile != "" {
+		b, err := ioutil.ReadFile(cfg.RoutingKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read routing key file %s for pagerduty receiver %q: %v", cfg.RoutingKeyFile, name, err)
+		}
+		key = strings.TrimSpace(string(b))
+	}
+	if key == "" {
+		return nil, fmt.Errorf("missing routing_key for pagerduty receiver %q", name)
+	}
+	client, err := createHTTPClient(cfg.HTTPClientConfig, "alerts-collector")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client for pagerduty receiver %q: %v", name, err)
+	}
+
+	u := cfg.URL
+	if u == "" {
+		u = defaultPagerDutyURL
+	}
+	severity := make(map[string]string, len(cfg.SeverityMapping))
+	for k, v := range cfg.SeverityMapping {
+		severity[strings.ToLower(k)] = v
+	}
+
+	return &PagerDuty{
+		logger:   l,
+		name:     name,
+		client:   client,
+		url:      u,
+		timeout:  time.Duration(cfg.Timeout),
+		key:      key,
+		severity: severity,
+	}, nil
+}
+
+// Name returns the name of the receiver
+func (pd *PagerDuty) Name() string {
+	return pd.name
+}
+
+// Send sends one event per alert to PagerDuty, firing alerts trigger and resolved alerts resolve the incident
+func (pd *PagerDuty) Send(ctx context.Context, alerts template.Alerts) error {
+	var failed int
+	for _, alt := range alerts {
+		b, err := json.Marshal(pd.event(alt))
+		if err != nil {
+			return fmt.Errorf("failed to encode pagerduty event: %v", err)
+		}
+		if err := post(ctx, pd.client, pd.url, pd.timeout, jsonHeader(), b); err != nil {
+			level.Warn(pd.logger).Log("msg", "sending pagerduty event failed", "receiver", pd.name, "err", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d of %d alerts to pagerduty receiver %q", failed, len(alerts), pd.name)
+	}
+	return nil
+}
+
+// event maps the alert to a PagerDuty event
+func (pd *PagerDuty) event(alt template.Alert) *pagerDutyEvent {
+	ev := &pagerDutyEvent{
+		RoutingKey:  pd.key,
+		EventAction: "trigger",
+		DedupKey:    Fingerprint(alt),
+	}
+	if alt.Status == string(model.AlertResolved) {
+		ev.EventAction = "resolve"
+		return ev
+	}
+
+	summary := alt.Annotations["summary"]
+	if summary == "" {
+		summary = fmt.Sprintf("%s %v", alt.Labels[model.AlertNameLabel], alt.Labels)
+	}
+	source := alt.Labels[model.InstanceLabel]
+	if source == "" {
+		source = "alerts-collector"
+	}
+	details := make(map[string]string, len(alt.Labels)+len(alt.Annotations))
+	for k, v := range alt.Labels {
+		details[k] = v
+	}
+	for k, v := range alt.Annotations {
+		details[k] = v
+	}
+
+	ev.Payload = &pagerDutyPayload{
+		Summary:       summary,
+		Source:        source,
+		Severity:      pd.mapSeverity(alt.Labels["severity"]),
+		CustomDetails: details,
+	}
+	if !alt.StartsAt.IsZero() {
+		ev.Payload.Timestamp = alt.StartsAt.Format(time.RFC3339)
+	}
+	if alt.GeneratorURL != "" {
+		ev.Links = []pagerDutyLink{{Href: alt.GeneratorURL, Text: "Source"}}
+	}
+	return ev
+}
+
+// mapSeverity maps the alert severity to a PagerDuty severity
+func (pd *PagerDuty) mapSeverity(severity string) string {
+	severity = strings.ToLower(severity)
+	if s, found := pd.severity[severity]; found {
+		return s
+	}
+	switch severity {
+	case "critical", "error", "warning", "info":
+		return severity
+	default:
+		return defaultPagerDutySeverity
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// newTestPagerDuty returns a started Events API recording the events and answering with the status
+func newTestPagerDuty(t *testing.T, status int) (*httptest.Server, func() []pagerDutyEvent) {
+	t.Helper()
+	var (
+		mtx    sync.Mutex
+		events []pagerDutyEvent
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev pagerDutyEvent
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			t.Errorf("failed to decode the event: %v", err)
+		}
+		mtx.Lock()
+		events = append(events, ev)
+		mtx.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s, func() []pagerDutyEvent {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return append([]pagerDutyEvent(nil), events...)
+	}
+}
+
+func TestPagerDuty(t *testing.T) {
+	tests := []struct {
+		name         string
+		mapping      map[string]string
+		alert        template.Alert
+		status       int
+		wantErr      bool
+		wantAction   string
+		wantSeverity string
+		wantSource   string
+	}{
+		{
+			name:         "trigger",
+			alert:        withStatus("a", statusFiring, "severity", "warning", "instance", "10.0.0.1:9100"),
+			status:       http.StatusAccepted,
+			wantAction:   "trigger",
+			wantSeverity: "warning",
+			wantSource:   "10.0.0.1:9100",
+		},
+		{
+			name:         "unknown severity",
+			alert:        withStatus("a", statusFiring, "severity", "P2"),
+			status:       http.StatusAccepted,
+			wantAction:   "trigger",
+			wantSeverity: defaultPagerDutySeverity,
+			wantSource:   "alerts-collector",
+		},
+		{
+			name:         "severity mapping",
+			mapping:      map[string]string{"P1": "critical"},
+			alert:        withStatus("a", statusFiring, "severity", "p1"),
+			status:       http.StatusAccepted,
+			wantAction:   "trigger",
+			wantSeverity: "critical",
+			wantSource:   "alerts-collector",
+		},
+		{
+			name:       "resolve",
+			alert:      withStatus("a", statusResolved, "severity", "warning"),
+			status:     http.StatusAccepted,
+			wantAction: "resolve",
+		},
+		{
+			name:         "failing Events API",
+			alert:        withStatus("a", statusFiring),
+			status:       http.StatusTooManyRequests,
+			wantErr:      true,
+			wantAction:   "trigger",
+			wantSeverity: defaultPagerDutySeverity,
+			wantSource:   "alerts-collector",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, events := newTestPagerDuty(t, tc.status)
+			pd, err := newPagerDuty(log.NewNopLogger(), "pagerduty", PagerDutyConfig{
+				RoutingKey:      "key",
+				URL:             s.URL,
+				SeverityMapping: tc.mapping,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = pd.Send(context.Background(), template.Alerts{tc.alert})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Send() error = %v, want error %v", err, tc.wantErr)
+			}
+			got := events()
+			if len(got) != 1 {
+				t.Fatalf("received %d events, want 1", len(got))
+			}
+			ev := got[0]
+			if ev.RoutingKey != "key" || ev.EventAction != tc.wantAction || ev.DedupKey != Fingerprint(tc.alert) {
+				t.Errorf("event routing_key %q, event_action %q, dedup_key %q, want key, %s and %s", ev.RoutingKey, ev.EventAction, ev.DedupKey, tc.wantAction, Fingerprint(tc.alert))
+			}
+			if tc.wantSeverity == "" {
+				if ev.Payload != nil {
+					t.Errorf("payload = %+v, want none", ev.Payload)
+				}
+				return
+			}
+			if ev.Payload == nil {
+				t.Fatal("event without payload")
+			}
+			if ev.Payload.Severity != tc.wantSeverity || ev.Payload.Source != tc.wantSource {
+				t.Errorf("payload severity %q and source %q, want %q and %q", ev.Payload.Severity, ev.Payload.Source, tc.wantSeverity, tc.wantSource)
+			}
+		})
+	}
+}
+
+func TestNewPagerDuty(t *testing.T) {
+	key := writeFile(t, "routing-key", " from-file\n")
+	pd, err := newPagerDuty(log.NewNopLogger(), "pagerduty", PagerDutyConfig{RoutingKey: "inline", RoutingKeyFile: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd.key != "from-file" || pd.url != defaultPagerDutyURL {
+		t.Errorf("routing key %q and url %q, want the key of the file and the default url", pd.key, pd.url)
+	}
+	if _, err := newPagerDuty(log.NewNopLogger(), "pagerduty", PagerDutyConfig{}); err == nil {
+		t.Error("newPagerDuty() succeeded without routing key, want error")
+	}
+}
+
+func TestPagerDutyAlertmanager(t *testing.T) {
+	s, events := newTestPagerDuty(t, http.StatusAccepted)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- name: oncall
+  pagerduty:
+    routing_key: key
+    url: `+s.URL+`
+`)
+	if len(fwder.alertmanagers) != 0 {
+		t.Fatalf("%d alertmanagers, want the pagerduty entry to be a receiver", len(fwder.alertmanagers))
+	}
+	if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+		t.Fatalf("Forward(firing) = %v, want nil", err)
+	}
+	if err := fwder.Forward(context.Background(), resolved("a")); err != nil {
+		t.Fatalf("Forward(resolved) = %v, want nil", err)
+	}
+	got := events()
+	if len(got) != 2 || got[0].EventAction != "trigger" || got[1].EventAction != "resolve" {
+		t.Fatalf("received events %+v, want a trigger and a resolve", got)
+	}
+	for _, ev := range got {
+		if ev.RoutingKey != "key" || ev.DedupKey != got[0].DedupKey {
+			t.Errorf("event routing_key %q and dedup_key %q, want key and the same dedup_key for the alert", ev.RoutingKey, ev.DedupKey)
+		}
+	}
+}
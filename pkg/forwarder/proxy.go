@@ -0,0 +1,64 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"path"
+
+	"github.com/go-kit/kit/log/level"
+)
+
+// newAPIProxy returns a reverse proxy to the alertmanager API of the upstream,
+// requests go to the first endpoint whose circuit breaker isn't open
+func newAPIProxy(am *Alertmanager) http.Handler {
+	return &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			endpoints := am.currentEndpoints()
+			if len(endpoints) == 0 {
+				return
+			}
+			u := endpoints[0]
+			for _, ep := range endpoints {
+				if !am.breaker(ep).open() {
+					u = ep
+					break
+				}
+			}
+			r.URL.Scheme = u.Scheme
+			r.URL.Host = u.Host
+			r.URL.Path = path.Join(u.Path, r.URL.Path)
+			r.Host = u.Host
+			// the upstream authenticates the collector, not the client
+			r.Header.Del("Authorization")
+			for name, value := range am.headers {
+				r.Header.Set(name, value)
+			}
+		},
+		Transport: am.client.Transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			level.Warn(am.logger).Log("msg", "proxying alertmanager API request failed", "alertmanager", am.String(), "path", r.URL.Path, "err", err)
+			http.Error(w, fmt.Sprintf("failed to proxy request to alertmanager %s", am), http.StatusBadGateway)
+		},
+	}
+}
+
+// APIProxy returns the handler proxying alertmanager API read requests to the configured upstream,
+// nil if no API proxy is configured
+func (fwder *Forwarder) APIProxy() http.Handler {
+	return fwder.apiProxy
+}
+
+// findAlertmanager returns the alertmanager with the name among the forwarder and its routing groups
+func (fwder *Forwarder) findAlertmanager(name string) (*Alertmanager, error) {
+	for _, f := range fwder.all() {
+		for _, am := range f.alertmanagers {
+			if am.name == name {
+				return am, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown alertmanager %q", name)
+}
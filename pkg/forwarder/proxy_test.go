@@ -0,0 +1,77 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestAPIProxy(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		w.Write([]byte(`[]`))
+	}))
+	defer upstream.Close()
+	fwder := newTestForwarder(t, `
+api_proxy: upstream
+alertmanagers:
+- name: upstream
+  static_configs: [`+strings.TrimPrefix(upstream.URL, "http://")+`]
+  path_prefix: /alertmanager
+  headers:
+    X-Scope-OrgID: ops
+`)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/alerts?active=true", nil)
+	req.Header.Set("Authorization", "Bearer client")
+	rec := httptest.NewRecorder()
+	fwder.APIProxy().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "[]" {
+		t.Fatalf("response %d %q, want the upstream response", rec.Code, rec.Body.String())
+	}
+	got := <-requests
+	if got.URL.Path != "/alertmanager/api/v2/alerts" || got.URL.RawQuery != "active=true" {
+		t.Errorf("upstream request %s?%s, want /alertmanager/api/v2/alerts?active=true", got.URL.Path, got.URL.RawQuery)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "" {
+		t.Errorf("Authorization header of the client %q forwarded, want none", auth)
+	}
+	if tenant := got.Header.Get(tenantHeader); tenant != "ops" {
+		t.Errorf("%s = %q, want the header of the alertmanager", tenantHeader, tenant)
+	}
+}
+
+func TestAPIProxyUnreachable(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	fwder := newTestForwarder(t, `
+api_proxy: upstream
+alertmanagers:
+- name: upstream
+  static_configs: [`+strings.TrimPrefix(upstream.URL, "http://")+`]
+`)
+	upstream.Close()
+
+	rec := httptest.NewRecorder()
+	fwder.APIProxy().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/status", nil))
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestAPIProxyUnknownAlertmanager(t *testing.T) {
+	_, err := NewForwarder(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+api_proxy: missing
+alertmanagers:
+- static_configs: [localhost:9093]
+`))
+	if err == nil {
+		t.Error("NewForwarder() succeeded with an unknown api_proxy alertmanager, want error")
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	// rateLimitWindow is the window the forwarded alerts are counted in
+	rateLimitWindow = time.Minute
+	// rateLimitFlushInterval is the interval the buffered alerts are checked for free capacity
+	rateLimitFlushInterval = time.Second
+
+	overflowDrop   = "drop"
+	overflowBuffer = "buffer"
+)
+
+// pendingAlert is an alert buffered by the rate limiter with the forwarder delivering it
+type pendingAlert struct {
+	alert template.Alert
+	fwder *Forwarder
+}
+
+// rateLimiter caps the number of alerts forwarded per minute across all the forwarders,
+// the alerts beyond the cap are dropped or buffered until the next minute. The critical alerts
+// take the capacity first, then the warnings, the infos and the other alerts.
+type rateLimiter struct {
+	logger log.Logger
+	max    int
+	buffer bool
+	now    func() time.Time
+
+	mtx         sync.Mutex
+	windowStart time.Time
+	count       int
+	pending     []pendingAlert
+	index       map[string]int // fingerprint -> index in pending
+	stopc       chan struct{}
+	done        chan struct{}
+}
+
+// newRateLimiter returns a new rate limiter, nil if the limit is not set
+func newRateLimiter(l log.Logger, max int, overflow string) (*rateLimiter, error) {
+	if max <= 0 {
+		return nil, nil
+	}
+	rl := &rateLimiter{
+		logger: l,
+		max:    max,
+		now:    time.Now,
+		index:  make(map[string]int),
+		stopc:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	switch overflow {
+	case "", overflowDrop:
+	case overflowBuffer:
+		rl.buffer = true
+	default:
+		return nil, fmt.Errorf("rate_limit_overflow must be %s or %s, got %q", overflowDrop, overflowBuffer, overflow)
+	}
+	if rl.buffer {
+		go rl.run()
+	} else {
+		close(rl.done)
+	}
+	return rl, nil
+}
+
+// allow returns the alerts that fit into the cap of the current window, the others are dropped
+// or buffered to be delivered by the forwarder later
+func (rl *rateLimiter) allow(fwder *Forwarder, alerts template.Alerts) template.Alerts {
+	if rl == nil {
+		return alerts
+	}
+
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+	rl.rotate()
+
+	kept := make(template.Alerts, 0, len(alerts))
+	var overflow int
+	for _, i := range byPriority(len(alerts), func(i int) template.Alert { return alerts[i] }) {
+		alt := alerts[i]
+		if rl.count < rl.max {
+			rl.count++
+			kept = append(kept, alt)
+			continue
+		}
+		overflow++
+		if !rl.buffer {
+			continue
+		}
+		fp := Fingerprint(alt)
+		if i, found := rl.index[fp]; found && rl.pending[i].fwder == fwder {
+			// keep the latest state of the alert
+			rl.pending[i].alert = alt
+			continue
+		}
+		rl.index[fp] = len(rl.pending)
+		rl.pending = append(rl.pending, pendingAlert{alert: alt, fwder: fwder})
+	}
+	if overflow > 0 {
+		action := overflowDrop
+		if rl.buffer {
+			action = overflowBuffer
+		}
+		rateLimitedAlerts.WithLabelValues(action).Add(float64(overflow))
+		level.Warn(rl.logger).Log("msg", "alert rate limit exceeded", "limit", rl.max, "overflow", overflow, "action", action, "buffered", len(rl.pending))
+	}
+	return kept
+}
+
+// rotate starts a new window once the current one expired, the lock must be held
+func (rl *rateLimiter) rotate() {
+	now := rl.now()
+	if now.Sub(rl.windowStart) >= rateLimitWindow {
+		rl.windowStart = now
+		rl.count = 0
+	}
+}
+
+// run delivers the buffered alerts as capacity frees up until the rate limiter is stopped
+func (rl *rateLimiter) run() {
+	defer close(rl.done)
+
+	ticker := time.NewTicker(rateLimitFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			rl.flush(context.Background())
+		case <-rl.stopc:
+			return
+		}
+	}
+}
+
+// flush delivers the buffered alerts fitting into the cap of the current window
+func (rl *rateLimiter) flush(ctx context.Context) {
+	rl.mtx.Lock()
+	rl.rotate()
+	n := rl.max - rl.count
+	if n > len(rl.pending) {
+		n = len(rl.pending)
+	}
+	if n <= 0 {
+		rl.mtx.Unlock()
+		return
+	}
+	order := byPriority(len(rl.pending), func(i int) template.Alert { return rl.pending[i].alert })
+	flushed := make([]pendingAlert, 0, n)
+	for _, i := range order[:n] {
+		flushed = append(flushed, rl.pending[i])
+	}
+	remaining := make([]pendingAlert, 0, len(rl.pending)-n)
+	for _, i := range order[n:] {
+		remaining = append(remaining, rl.pending[i])
+	}
+	rl.pending = remaining
+	rl.index = make(map[string]int, len(rl.pending))
+	for i, p := range rl.pending {
+		rl.index[Fingerprint(p.alert)] = i
+	}
+	rl.count += n
+	rl.mtx.Unlock()
+
+	// deliver the alerts with the forwarder that received them, in order
+	var (
+		fwders  []*Forwarder
+		byFwder = make(map[*Forwarder]template.Alerts)
+	)
+	for _, p := range flushed {
+		if _, found := byFwder[p.fwder]; !found {
+			fwders = append(fwders, p.fwder)
+		}
+		byFwder[p.fwder] = append(byFwder[p.fwder], p.alert)
+	}
+	for _, f := range fwders {
+		if err := f.deliver(ctx, byFwder[f]); err != nil {
+			level.Warn(rl.logger).Log("msg", "forwarding rate limited alerts failed", "numAlerts", len(byFwder[f]), "err", err)
+		}
+	}
+}
+
+// stop stops delivering the buffered alerts, the alerts still buffered are discarded
+func (rl *rateLimiter) stop() {
+	if rl == nil {
+		return
+	}
+	close(rl.stopc)
+	<-rl.done
+
+	rl.mtx.Lock()
+	defer rl.mtx.Unlock()
+	if len(rl.pending) > 0 {
+		level.Warn(rl.logger).Log("msg", "discarding rate limited alerts on shutdown", "numAlerts", len(rl.pending))
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestRateLimiter(t *testing.T) {
+	tests := []struct {
+		name        string
+		max         int
+		overflow    string
+		alerts      template.Alerts
+		wantKept    []string
+		wantPending int
+		wantErr     bool
+	}{
+		{
+			name:     "disabled",
+			alerts:   firing("a", "b", "c"),
+			wantKept: []string{"a", "b", "c"},
+		},
+		{
+			name:     "overflow dropped",
+			max:      2,
+			alerts:   firing("a", "b", "c"),
+			wantKept: []string{"a", "b"},
+		},
+		{
+			name:        "overflow buffered",
+			max:         2,
+			overflow:    overflowBuffer,
+			alerts:      firing("a", "b", "c"),
+			wantKept:    []string{"a", "b"},
+			wantPending: 1,
+		},
+		{
+			name:     "critical alerts take the capacity first",
+			max:      2,
+			alerts:   template.Alerts{withSeverity("info", "info"), withSeverity("warning", "warning"), withSeverity("critical", "critical")},
+			wantKept: []string{"critical", "warning"},
+		},
+		{name: "invalid overflow", max: 1, overflow: "queue", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rl, err := newRateLimiter(log.NewNopLogger(), tc.max, tc.overflow)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newRateLimiter() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer rl.stop()
+
+			got := alertnamesOf(rl.allow(nil, tc.alerts))
+			checkAlertnames(t, "rate limiter", got, tc.wantKept)
+			if rl != nil && len(rl.pending) != tc.wantPending {
+				t.Errorf("%d alerts buffered, want %d", len(rl.pending), tc.wantPending)
+			}
+		})
+	}
+}
+
+func TestRateLimiterFlushesBufferedAlerts(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+`)
+	rl, err := newRateLimiter(log.NewNopLogger(), 1, overflowBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.stop()
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+
+	kept := rl.allow(fwder, firing("a", "b"))
+	// the latest state of a buffered alert replaces the previous one
+	rl.allow(fwder, firing("b"))
+	checkAlertnames(t, "kept", alertnamesOf(kept), []string{"a"})
+	if len(rl.pending) != 1 {
+		t.Fatalf("%d alerts buffered, want 1", len(rl.pending))
+	}
+
+	// no capacity left in the window
+	rl.flush(context.Background())
+	if got := upstream.received(); len(got) != 0 {
+		t.Fatalf("upstream received %v within the full window, want nothing", got)
+	}
+
+	now = now.Add(rateLimitWindow)
+	rl.flush(context.Background())
+	checkAlertnames(t, "upstream", upstream.received(), []string{"b"})
+	if len(rl.pending) != 0 {
+		t.Errorf("%d alerts still buffered, want none", len(rl.pending))
+	}
+}
+
+func TestRateLimiterScheduledAlerts(t *testing.T) {
+	upstream := newTestAlertmanager(t, http.StatusOK)
+	fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+upstream.addr()+`]
+`)
+	// the forwarder stops its rate limiter and scheduler
+	rl, err := newRateLimiter(log.NewNopLogger(), 2, overflowBuffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, time.March, 1, 8, 0, 0, 0, time.UTC)
+	rl.now = func() time.Time { return now }
+	fwder.rateLimiter = rl
+	fwder.schedules, err = newScheduler(log.NewNopLogger(), []ScheduleConfig{{
+		Matchers:   []MatcherConfig{{Name: "severity", Value: "warning"}},
+		TimeRanges: []TimeRangeConfig{{Start: "09:00", End: "17:00"}},
+	}}, fwder.release)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scheduleNow := now
+	fwder.schedules.now = func() time.Time { return scheduleNow }
+
+	// the held warning isn't charged, the criticals take the capacity before the infos received first
+	err = fwder.Forward(context.Background(), template.Alerts{
+		withSeverity("info-1", "info"),
+		withSeverity("warning", "warning"),
+		withSeverity("critical-1", "critical"),
+		withSeverity("info-2", "info"),
+		withSeverity("critical-2", "critical"),
+	})
+	if err != nil {
+		t.Fatalf("Forward() = %v, want nil", err)
+	}
+	if got, want := upstream.received(), []string{"critical-1", "critical-2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("upstream received %v, want %v", got, want)
+	}
+
+	// the warning released in the full window is buffered with the infos and drains before them
+	scheduleNow = scheduleNow.Add(time.Hour)
+	fwder.schedules.flush(context.Background())
+	if len(rl.pending) != 3 {
+		t.Fatalf("%d alerts buffered, want the released warning buffered with the infos", len(rl.pending))
+	}
+	now = now.Add(rateLimitWindow)
+	rl.flush(context.Background())
+	if got, want := upstream.received(), []string{"critical-1", "critical-2", "warning", "info-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("upstream received %v, want %v", got, want)
+	}
+	if len(rl.pending) != 1 {
+		t.Errorf("%d alerts still buffered, want 1", len(rl.pending))
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/version"
+)
+
+// Receiver is a forwarding target other than an alertmanager that alerts can be sent to
+type Receiver interface {
+	// Name returns the configured name of the receiver
+	Name() string
+	// Send sends the alert batch to the receiver
+	Send(ctx context.Context, alerts template.Alerts) error
+}
+
+// stoppableReceiver is a receiver with background work to finish on shutdown
+type stoppableReceiver interface {
+	stop(ctx context.Context)
+}
+
+// ReceiverConfig configures a receiver, exactly one of the receiver types has to be set.
+type ReceiverConfig struct {
+	Name      string           `yaml:"name"`
+	PagerDuty *PagerDutyConfig `yaml:"pagerduty"`
+	Webhook   *WebhookConfig   `yaml:"webhook"`
+	OTLP      *OTLPConfig      `yaml:"otlp"`
+	Kafka     *KafkaConfig     `yaml:"kafka"`
+}
+
+// newReceiver creates the receiver from its configuration
+func newReceiver(l log.Logger, rcfg ReceiverConfig) (Receiver, error) {
+	if rcfg.Name == "" {
+		return nil, fmt.Errorf("missing receiver name")
+	}
+
+	switch {
+	case rcfg.PagerDuty != nil:
+		return newPagerDuty(l, rcfg.Name, *rcfg.PagerDuty)
+	case rcfg.Webhook != nil:
+		return newWebhookReceiver(l, rcfg.Name, *rcfg.Webhook)
+	case rcfg.OTLP != nil:
+		return newOTLP(l, rcfg.Name, *rcfg.OTLP)
+	case rcfg.Kafka != nil:
+		return newKafka(l, rcfg.Name, *rcfg.Kafka)
+	default:
+		return nil, fmt.Errorf("no receiver type configured for receiver %q", rcfg.Name)
+	}
+}
+
+// post posts the body to the URL of a receiver, the timeout defaults to defaultTimeout if it is not set
+func post(ctx context.Context, client *http.Client, u string, timeout time.Duration, header http.Header, body []byte) error {
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", version.UserAgent())
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to %q: %v", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, u)
+	}
+	return nil
+}
+
+// jsonHeader returns the header of a JSON request
+func jsonHeader() http.Header {
+	return http.Header{"Content-Type": []string{"application/json"}}
+}
@@ -0,0 +1,74 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestNewReceiver(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ReceiverConfig
+		wantErr bool
+	}{
+		{name: "webhook", cfg: ReceiverConfig{Name: "chat", Webhook: &WebhookConfig{URL: "http://localhost"}}},
+		{name: "pagerduty", cfg: ReceiverConfig{Name: "oncall", PagerDuty: &PagerDutyConfig{RoutingKey: "key"}}},
+		{name: "missing name", cfg: ReceiverConfig{Webhook: &WebhookConfig{URL: "http://localhost"}}, wantErr: true},
+		{name: "no receiver type", cfg: ReceiverConfig{Name: "empty"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := newReceiver(log.NewNopLogger(), tc.cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newReceiver() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && r.Name() != tc.cfg.Name {
+				t.Errorf("Name() = %q, want %q", r.Name(), tc.cfg.Name)
+			}
+		})
+	}
+}
+
+func TestForwardToReceivers(t *testing.T) {
+	tests := []struct {
+		name          string
+		amStatus      int
+		webhookStatus int
+		wantErr       bool
+	}{
+		{name: "both deliver", amStatus: http.StatusOK, webhookStatus: http.StatusOK},
+		{name: "receiver delivers", amStatus: http.StatusInternalServerError, webhookStatus: http.StatusOK},
+		{name: "alertmanager delivers", amStatus: http.StatusOK, webhookStatus: http.StatusInternalServerError},
+		{name: "none delivers", amStatus: http.StatusInternalServerError, webhookStatus: http.StatusInternalServerError, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			am := newTestAlertmanager(t, tc.amStatus)
+			wh, requests := newTestWebhook(t, tc.webhookStatus)
+			fwder := newTestForwarder(t, `
+alertmanagers:
+- static_configs: [`+am.addr()+`]
+  scheme: http
+  api_version: v1
+receivers:
+- name: chat
+  webhook:
+    url: `+wh.URL+`
+    template: '{{ len .Alerts }}'
+`)
+			err := fwder.Forward(context.Background(), firing("a", "b"))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Forward() error = %v, want error %v", err, tc.wantErr)
+			}
+			checkAlertnames(t, "alertmanager", am.received(), []string{"a", "b"})
+			if reqs := requests(); len(reqs) != 1 || reqs[0].body != "2" {
+				t.Errorf("webhook received %v, want a single request for the 2 alerts", reqs)
+			}
+		})
+	}
+}
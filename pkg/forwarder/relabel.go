@@ -0,0 +1,215 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// relabel actions, with the semantics of the Prometheus relabel_config
+const (
+	relabelReplace   = "replace"
+	relabelKeep      = "keep"
+	relabelDrop      = "drop"
+	relabelHashMod   = "hashmod"
+	relabelLabelMap  = "labelmap"
+	relabelLabelDrop = "labeldrop"
+	relabelLabelKeep = "labelkeep"
+)
+
+// RelabelConfig rewrites the labels of the alerts like the Prometheus relabel_config, the rules are
+// applied in order to the labels of each alert before the drop rules and routes are evaluated.
+type RelabelConfig struct {
+	// Labels whose values are concatenated with the separator and matched against the regular expression.
+	SourceLabels []string `yaml:"source_labels"`
+	// Separator of the concatenated source label values, defaults to ;.
+	Separator *string `yaml:"separator"`
+	// Label the result is written to by the replace and hashmod actions, expanded with the match groups for replace.
+	TargetLabel string `yaml:"target_label"`
+	// Regular expression anchored at both ends, defaults to (.*).
+	Regex *string `yaml:"regex"`
+	// Modulus of the hash of the source label values for the hashmod action.
+	Modulus uint64 `yaml:"modulus"`
+	// Replacement expanded with the match groups for the replace and labelmap actions, defaults to $1.
+	Replacement *string `yaml:"replacement"`
+	// Action among replace (default), keep, drop, hashmod, labelmap, labeldrop and labelkeep.
+	Action string `yaml:"action"`
+}
+
+// relabelRule is a compiled relabel config
+type relabelRule struct {
+	sourceLabels []string
+	separator    string
+	targetLabel  string
+	re           *regexp.Regexp
+	modulus      uint64
+	replacement  string
+	action       string
+}
+
+// newRelabelRule compiles the relabel config, applying the Prometheus defaults
+func newRelabelRule(cfg RelabelConfig) (*relabelRule, error) {
+	rule := &relabelRule{
+		sourceLabels: cfg.SourceLabels,
+		separator:    ";",
+		targetLabel:  cfg.TargetLabel,
+		modulus:      cfg.Modulus,
+		replacement:  "$1",
+		action:       cfg.Action,
+	}
+	if cfg.Separator != nil {
+		rule.separator = *cfg.Separator
+	}
+	if cfg.Replacement != nil {
+		rule.replacement = *cfg.Replacement
+	}
+	if rule.action == "" {
+		rule.action = relabelReplace
+	}
+	regex := "(.*)"
+	if cfg.Regex != nil {
+		regex = *cfg.Regex
+	}
+	re, err := regexp.Compile("^(?:" + regex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid relabel regular expression %q: %v", regex, err)
+	}
+	rule.re = re
+
+	switch rule.action {
+	case relabelReplace:
+		if rule.targetLabel == "" {
+			return nil, fmt.Errorf("relabel action %s requires a target_label", rule.action)
+		}
+	case relabelHashMod:
+		if rule.targetLabel == "" {
+			return nil, fmt.Errorf("relabel action %s requires a target_label", rule.action)
+		}
+		if !model.LabelName(rule.targetLabel).IsValid() {
+			return nil, fmt.Errorf("invalid relabel target_label %q", rule.targetLabel)
+		}
+		if rule.modulus == 0 {
+			return nil, fmt.Errorf("relabel action %s requires a modulus", rule.action)
+		}
+	case relabelKeep, relabelDrop, relabelLabelMap, relabelLabelDrop, relabelLabelKeep:
+	default:
+		return nil, fmt.Errorf("unknown relabel action %q", rule.action)
+	}
+	return rule, nil
+}
+
+// relabel applies the rules to the labels of the alerts, the alerts dropped by a keep or drop rule are removed
+func relabel(alerts template.Alerts, rules []*relabelRule) template.Alerts {
+	if len(rules) == 0 {
+		return alerts
+	}
+	kept := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		labels := make(template.KV, len(alt.Labels))
+		for k, v := range alt.Labels {
+			labels[k] = v
+		}
+		if !applyRelabelRules(labels, rules) {
+			continue
+		}
+		alt.Labels = labels
+		kept = append(kept, alt)
+	}
+	return kept
+}
+
+// applyRelabelRules rewrites the labels in place, it returns false if the alert is dropped
+func applyRelabelRules(labels template.KV, rules []*relabelRule) bool {
+	for _, rule := range rules {
+		values := make([]string, 0, len(rule.sourceLabels))
+		for _, name := range rule.sourceLabels {
+			values = append(values, labels[name])
+		}
+		val := strings.Join(values, rule.separator)
+
+		switch rule.action {
+		case relabelDrop:
+			if rule.re.MatchString(val) {
+				return false
+			}
+		case relabelKeep:
+			if !rule.re.MatchString(val) {
+				return false
+			}
+		case relabelReplace:
+			indexes := rule.re.FindStringSubmatchIndex(val)
+			if indexes == nil {
+				break
+			}
+			target := string(rule.re.ExpandString(nil, rule.targetLabel, val, indexes))
+			if !model.LabelName(target).IsValid() {
+				break
+			}
+			if res := string(rule.re.ExpandString(nil, rule.replacement, val, indexes)); res != "" {
+				labels[target] = res
+			} else {
+				delete(labels, target)
+			}
+		case relabelHashMod:
+			labels[rule.targetLabel] = strconv.FormatUint(sum64(md5.Sum([]byte(val)))%rule.modulus, 10)
+		case relabelLabelMap:
+			mapped := make(template.KV)
+			for name, v := range labels {
+				if rule.re.MatchString(name) {
+					mapped[rule.re.ReplaceAllString(name, rule.replacement)] = v
+				}
+			}
+			for name, v := range mapped {
+				labels[name] = v
+			}
+		case relabelLabelDrop:
+			for name := range labels {
+				if rule.re.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		case relabelLabelKeep:
+			for name := range labels {
+				if !rule.re.MatchString(name) {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+	return true
+}
+
+// dropLabels removes the labels from the alerts, e.g. high-cardinality labels causing grouping churn upstream
+func dropLabels(alerts template.Alerts, names []string) template.Alerts {
+	if len(names) == 0 {
+		return alerts
+	}
+	for i, alt := range alerts {
+		labels := make(template.KV, len(alt.Labels))
+		for k, v := range alt.Labels {
+			labels[k] = v
+		}
+		for _, name := range names {
+			delete(labels, name)
+		}
+		alerts[i].Labels = labels
+	}
+	return alerts
+}
+
+// sum64 returns the last 8 bytes of the md5 hash as an integer, like Prometheus for the hashmod action
+func sum64(hash [md5.Size]byte) uint64 {
+	var s uint64
+	for i, b := range hash {
+		shift := uint64((md5.Size - i - 1) * 8)
+		s |= uint64(b) << shift
+	}
+	return s
+}
@@ -0,0 +1,167 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestRelabel(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name    string
+		cfgs    []RelabelConfig
+		labels  template.KV
+		want    template.KV // nil if the alert is dropped
+		wantErr bool
+	}{
+		{
+			name:   "replace with the defaults copies the source label",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"namespace"}, TargetLabel: "tenant"}},
+			labels: template.KV{"alertname": "a", "namespace": "team-a"},
+			want:   template.KV{"alertname": "a", "namespace": "team-a", "tenant": "team-a"},
+		},
+		{
+			name: "replace with match groups",
+			cfgs: []RelabelConfig{{
+				SourceLabels: []string{"cluster", "namespace"},
+				Separator:    str("/"),
+				Regex:        str("(.+)/team-(.+)"),
+				TargetLabel:  "owner",
+				Replacement:  str("$2@$1"),
+			}},
+			labels: template.KV{"cluster": "east", "namespace": "team-a"},
+			want:   template.KV{"cluster": "east", "namespace": "team-a", "owner": "a@east"},
+		},
+		{
+			name:   "replace not matching leaves the labels",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"namespace"}, Regex: str("team-(.+)"), TargetLabel: "team"}},
+			labels: template.KV{"namespace": "default"},
+			want:   template.KV{"namespace": "default"},
+		},
+		{
+			name:   "replace with an empty result removes the target",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"missing"}, TargetLabel: "team"}},
+			labels: template.KV{"team": "a"},
+			want:   template.KV{},
+		},
+		{
+			name:   "drop matching",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"severity"}, Regex: str("info|none"), Action: "drop"}},
+			labels: template.KV{"severity": "info"},
+		},
+		{
+			name:   "drop not matching",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"severity"}, Regex: str("info|none"), Action: "drop"}},
+			labels: template.KV{"severity": "critical"},
+			want:   template.KV{"severity": "critical"},
+		},
+		{
+			name:   "keep not matching",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"severity"}, Regex: str("critical"), Action: "keep"}},
+			labels: template.KV{"severity": "warning"},
+		},
+		{
+			name:   "hashmod",
+			cfgs:   []RelabelConfig{{SourceLabels: []string{"alertname"}, TargetLabel: "shard", Modulus: 1, Action: "hashmod"}},
+			labels: template.KV{"alertname": "a"},
+			want:   template.KV{"alertname": "a", "shard": "0"},
+		},
+		{
+			name:   "labelmap",
+			cfgs:   []RelabelConfig{{Regex: str("k8s_(.+)"), Action: "labelmap"}},
+			labels: template.KV{"k8s_namespace": "a", "alertname": "b"},
+			want:   template.KV{"k8s_namespace": "a", "namespace": "a", "alertname": "b"},
+		},
+		{
+			name:   "labeldrop",
+			cfgs:   []RelabelConfig{{Regex: str("pod|instance"), Action: "labeldrop"}},
+			labels: template.KV{"pod": "p", "instance": "i", "alertname": "a"},
+			want:   template.KV{"alertname": "a"},
+		},
+		{
+			name:   "labelkeep",
+			cfgs:   []RelabelConfig{{Regex: str("alertname|severity"), Action: "labelkeep"}},
+			labels: template.KV{"pod": "p", "severity": "warning", "alertname": "a"},
+			want:   template.KV{"severity": "warning", "alertname": "a"},
+		},
+		{
+			name: "rules apply in order",
+			cfgs: []RelabelConfig{
+				{SourceLabels: []string{"namespace"}, TargetLabel: "team"},
+				{SourceLabels: []string{"team"}, Regex: str("kube-.*"), Action: "drop"},
+			},
+			labels: template.KV{"namespace": "kube-system"},
+		},
+		{name: "unknown action", cfgs: []RelabelConfig{{Action: "rename"}}, wantErr: true},
+		{name: "replace without target", cfgs: []RelabelConfig{{SourceLabels: []string{"a"}}}, wantErr: true},
+		{name: "hashmod without modulus", cfgs: []RelabelConfig{{TargetLabel: "shard", Action: "hashmod"}}, wantErr: true},
+		{name: "invalid regex", cfgs: []RelabelConfig{{Regex: str("("), Action: "labeldrop"}}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var rules []*relabelRule
+			for _, cfg := range tc.cfgs {
+				rule, err := newRelabelRule(cfg)
+				if err != nil {
+					if !tc.wantErr {
+						t.Fatalf("newRelabelRule() = %v, want nil", err)
+					}
+					return
+				}
+				rules = append(rules, rule)
+			}
+			if tc.wantErr {
+				t.Fatal("newRelabelRule() succeeded, want error")
+			}
+
+			original := template.KV{}
+			for k, v := range tc.labels {
+				original[k] = v
+			}
+			got := relabel(template.Alerts{{Labels: tc.labels}}, rules)
+			if tc.want == nil {
+				if len(got) != 0 {
+					t.Fatalf("relabel() kept %v, want the alert dropped", got[0].Labels)
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatal("relabel() dropped the alert, want it kept")
+			}
+			if !reflect.DeepEqual(got[0].Labels, tc.want) {
+				t.Errorf("relabel() labels = %v, want %v", got[0].Labels, tc.want)
+			}
+			if !reflect.DeepEqual(tc.labels, original) {
+				t.Errorf("relabel() modified the labels of the received alert: %v", tc.labels)
+			}
+		})
+	}
+}
+
+func TestDropLabels(t *testing.T) {
+	shared := template.KV{"alertname": "a", "pod": "a-1", "instance": "10.0.0.1:8080"}
+	tests := []struct {
+		name  string
+		names []string
+		want  template.KV
+	}{
+		{name: "none", want: shared},
+		{name: "dropped", names: []string{"pod", "instance"}, want: template.KV{"alertname": "a"}},
+		{name: "missing label", names: []string{"container"}, want: shared},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts := dropLabels(template.Alerts{{Labels: shared}}, tc.names)
+			if !reflect.DeepEqual(alerts[0].Labels, tc.want) {
+				t.Errorf("labels = %v, want %v", alerts[0].Labels, tc.want)
+			}
+			if len(shared) != 3 {
+				t.Error("the labels shared with the sender were modified")
+			}
+		})
+	}
+}
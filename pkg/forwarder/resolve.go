@@ -0,0 +1,94 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// extendEndsAt extends the EndsAt of the firing alerts to at least now+timeout, so that
+// the upstreams don't resolve them before they are sent again. Resolved alerts are unchanged.
+func extendEndsAt(alerts template.Alerts, timeout time.Duration, now time.Time) template.Alerts {
+	if timeout <= 0 {
+		return alerts
+	}
+	min := now.Add(timeout)
+	for i, alt := range alerts {
+		if alt.Status == string(model.AlertResolved) {
+			continue
+		}
+		if alt.EndsAt.IsZero() || alt.EndsAt.Before(min) {
+			alerts[i].EndsAt = min
+		}
+	}
+	return alerts
+}
+
+// deriveStatus sets the status of the alerts sent without one, resolved if EndsAt is set and
+// not after now, firing otherwise
+func deriveStatus(alerts template.Alerts, now time.Time) template.Alerts {
+	for i, alt := range alerts {
+		if alt.Status != "" {
+			continue
+		}
+		if !alt.EndsAt.IsZero() && !alt.EndsAt.After(now) {
+			alerts[i].Status = string(model.AlertResolved)
+		} else {
+			alerts[i].Status = string(model.AlertFiring)
+		}
+	}
+	return alerts
+}
+
+// firingTracker tracks the firing alerts forwarded by the forwarder, to resolve them on shutdown
+type firingTracker struct {
+	mtx    sync.Mutex
+	firing map[string]template.Alert // fingerprint -> last forwarded state of the alert
+}
+
+// newFiringTracker returns a new firing tracker, nil if resolving on shutdown is disabled
+func newFiringTracker(enabled bool) *firingTracker {
+	if !enabled {
+		return nil
+	}
+	return &firingTracker{firing: make(map[string]template.Alert)}
+}
+
+// track records the forwarded alerts, resolved alerts are no longer tracked
+func (t *firingTracker) track(alerts template.Alerts) {
+	if t == nil {
+		return
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, alt := range alerts {
+		fp := Fingerprint(alt)
+		if alt.Status == string(model.AlertResolved) {
+			delete(t.firing, fp)
+			continue
+		}
+		t.firing[fp] = alt
+	}
+}
+
+// resolved returns the tracked firing alerts resolved at now and stops tracking them
+func (t *firingTracker) resolved(now time.Time) template.Alerts {
+	if t == nil {
+		return nil
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	alerts := make(template.Alerts, 0, len(t.firing))
+	for fp, alt := range t.firing {
+		alt.Status = string(model.AlertResolved)
+		alt.EndsAt = now
+		alerts = append(alerts, alt)
+		delete(t.firing, fp)
+	}
+	return alerts
+}
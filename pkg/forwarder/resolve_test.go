@@ -0,0 +1,79 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestDeriveStatus(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		alert template.Alert
+		want  string
+	}{
+		{name: "no EndsAt", alert: template.Alert{}, want: statusFiring},
+		{name: "EndsAt in the future", alert: template.Alert{EndsAt: now.Add(time.Minute)}, want: statusFiring},
+		{name: "EndsAt now", alert: template.Alert{EndsAt: now}, want: statusResolved},
+		{name: "EndsAt in the past", alert: template.Alert{EndsAt: now.Add(-time.Minute)}, want: statusResolved},
+		{name: "status set", alert: template.Alert{Status: statusFiring, EndsAt: now.Add(-time.Minute)}, want: statusFiring},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := deriveStatus(template.Alerts{tc.alert}, now)[0].Status; got != tc.want {
+				t.Errorf("status = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtendEndsAt(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		alert   template.Alert
+		want    time.Time
+	}{
+		{name: "disabled", alert: template.Alert{Status: statusFiring}},
+		{name: "no EndsAt", timeout: time.Hour, alert: template.Alert{Status: statusFiring}, want: now.Add(time.Hour)},
+		{name: "earlier EndsAt", timeout: time.Hour, alert: template.Alert{Status: statusFiring, EndsAt: now.Add(time.Minute)}, want: now.Add(time.Hour)},
+		{name: "later EndsAt", timeout: time.Hour, alert: template.Alert{Status: statusFiring, EndsAt: now.Add(2 * time.Hour)}, want: now.Add(2 * time.Hour)},
+		{name: "resolved", timeout: time.Hour, alert: template.Alert{Status: statusResolved, EndsAt: now}, want: now},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := extendEndsAt(template.Alerts{tc.alert}, tc.timeout, now)[0].EndsAt; !got.Equal(tc.want) {
+				t.Errorf("EndsAt = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFiringTracker(t *testing.T) {
+	tracker := newFiringTracker(true)
+	tracker.track(template.Alerts{withStatus("a", statusFiring), withStatus("b", statusFiring)})
+	tracker.track(template.Alerts{withStatus("b", statusResolved), withStatus("c", statusResolved)})
+
+	now := time.Now()
+	resolved := tracker.resolved(now)
+	checkAlertnames(t, "resolved", alertnamesOf(resolved), []string{"a"})
+	for _, alt := range resolved {
+		if alt.Status != statusResolved || !alt.EndsAt.Equal(now) {
+			t.Errorf("alert %s status %s ends at %v, want resolved at %v", alt.Labels["alertname"], alt.Status, alt.EndsAt, now)
+		}
+	}
+	if got := tracker.resolved(now); len(got) != 0 {
+		t.Errorf("resolved %d alerts again, want none", len(got))
+	}
+
+	disabled := newFiringTracker(false)
+	disabled.track(firing("a"))
+	if got := disabled.resolved(now); got != nil {
+		t.Errorf("disabled tracker resolved %v, want nil", got)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// GeneratorURLRewriteConfig rewrites the generator URL of the alerts, e.g. to point to a proxy
+// of the source Prometheus reachable from the upstreams.
+type GeneratorURLRewriteConfig struct {
+	// Regular expression matching the whole generator URL.
+	Regex string `yaml:"regex"`
+	// Replacement of the matching URL, $1 and ${name} refer to the capture groups. Write ${name}
+	// as $${name} since the ${VAR} references of the configuration are expanded with the environment.
+	Replacement string `yaml:"replacement"`
+}
+
+// urlRewriter rewrites the generator URLs with the first matching rule
+type urlRewriter struct {
+	rules []urlRewriteRule
+}
+
+type urlRewriteRule struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// newURLRewriter compiles the rewrite rules, nil if there are none
+func newURLRewriter(cfgs []GeneratorURLRewriteConfig) (*urlRewriter, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	rw := &urlRewriter{}
+	for i, cfg := range cfgs {
+		re, err := regexp.Compile("^(?:" + cfg.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex of generator_url_rewrite %d: %v", i, err)
+		}
+		rw.rules = append(rw.rules, urlRewriteRule{regex: re, replacement: cfg.Replacement})
+	}
+	return rw, nil
+}
+
+// rewrite rewrites the generator URLs of the alerts, URLs matching no rule are unchanged
+func (rw *urlRewriter) rewrite(alerts template.Alerts) template.Alerts {
+	if rw == nil {
+		return alerts
+	}
+
+	for i, alt := range alerts {
+		if alt.GeneratorURL == "" {
+			continue
+		}
+		for _, r := range rw.rules {
+			if r.regex.MatchString(alt.GeneratorURL) {
+				alerts[i].GeneratorURL = r.regex.ReplaceAllString(alt.GeneratorURL, r.replacement)
+				break
+			}
+		}
+	}
+	return alerts
+}
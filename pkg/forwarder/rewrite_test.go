@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestURLRewriter(t *testing.T) {
+	cfgs := []GeneratorURLRewriteConfig{
+		{Regex: `http://prometheus-k8s\.[^/]+:9090(/.*)`, Replacement: "https://prometheus.example.com$1"},
+		{Regex: `http://(?P<host>[^/:]+):9090/.*`, Replacement: "https://${host}.example.com"},
+	}
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "first matching rule", url: "http://prometheus-k8s.openshift-monitoring.svc:9090/graph?g0.expr=up", want: "https://prometheus.example.com/graph?g0.expr=up"},
+		{name: "named group", url: "http://thanos:9090/graph", want: "https://thanos.example.com"},
+		{name: "anchored regex", url: "https://thanos:9090/graph", want: "https://thanos:9090/graph"},
+		{name: "no generator URL", url: "", want: ""},
+	}
+	rw, err := newURLRewriter(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts := rw.rewrite(template.Alerts{{GeneratorURL: tc.url}})
+			if alerts[0].GeneratorURL != tc.want {
+				t.Errorf("GeneratorURL = %q, want %q", alerts[0].GeneratorURL, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewURLRewriter(t *testing.T) {
+	if rw, err := newURLRewriter(nil); rw != nil || err != nil {
+		t.Errorf("newURLRewriter(nil) = %v, %v, want nil", rw, err)
+	}
+	if _, err := newURLRewriter([]GeneratorURLRewriteConfig{{Regex: "("}}); err == nil {
+		t.Error("newURLRewriter() succeeded with an invalid regex, want error")
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+// RoutingConfig represents the routing rules loaded from the routing configuration file.
+type RoutingConfig struct {
+	// Relabel rules rewriting the labels of the alerts before the drop rules and routes are evaluated.
+	RelabelConfigs []RelabelConfig `yaml:"relabel_configs"`
+	// Alerts matching any of the drop rules are not forwarded.
+	Drop []DropRuleConfig `yaml:"drop"`
+	// Routes select the alertmanagers and receivers an alert is forwarded to, evaluated in order.
+	// Alerts matching no route are forwarded to all alertmanagers and receivers.
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// DropRuleConfig drops the alerts matching all of its matchers.
+type DropRuleConfig struct {
+	Matchers []MatcherConfig `yaml:"matchers"`
+}
+
+// RouteConfig forwards the alerts matching all of its matchers to the targets. Like in the alertmanager
+// routing tree, the alerts matching one of the child routes are forwarded to the targets of the child routes
+// instead, and the child routes without targets inherit the targets of their parent.
+type RouteConfig struct {
+	Matchers []MatcherConfig `yaml:"matchers"`
+	// Names of the alertmanagers and receivers to forward the matching alerts to.
+	Targets []string `yaml:"targets"`
+	// Continue evaluating the following sibling routes after this route matched.
+	Continue bool `yaml:"continue"`
+	// Child routes, evaluated in order for the alerts matching this route.
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// routingRules are the compiled routing rules
+type routingRules struct {
+	relabel []*relabelRule
+	drop    [][]*matcher
+	routes  []route
+}
+
+type route struct {
+	matchers []*matcher
+	targets  []string
+	cont     bool
+	routes   []route
+}
+
+// router applies the routing rules, which can be reloaded from the routing configuration file at runtime
+type router struct {
+	logger  log.Logger
+	file    string
+	targets map[string]bool // names of the known alertmanagers and receivers
+
+	mtx   sync.RWMutex
+	rules *routingRules
+
+	watcher *fsnotify.Watcher
+}
+
+// newRouter loads the routing rules from the file and watches it for changes, nil if no file is set
+func newRouter(l log.Logger, file string, targets map[string]bool) (*router, error) {
+	if file == "" {
+		return nil, nil
+	}
+
+	r := &router{logger: l, file: file, targets: targets}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := watchFile(l, file, r.reload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch routing configuration: %v", err)
+	}
+	r.watcher = watcher
+
+	return r, nil
+}
+
+// reload loads and compiles the routing rules, the current rules are kept on error
+func (r *router) reload() error {
+	b, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return fmt.Errorf("failed to load routing configuration from file %s: %v", r.file, err)
+	}
+	cfg := &RoutingConfig{}
+	if err := yaml.UnmarshalStrict(b, cfg); err != nil {
+		return fmt.Errorf("failed to unmarshal routing configuration: %v", err)
+	}
+
+	rules := &routingRules{}
+	for _, rc := range cfg.RelabelConfigs {
+		rule, err := newRelabelRule(rc)
+		if err != nil {
+			return fmt.Errorf("invalid relabel config: %v", err)
+		}
+		rules.relabel = append(rules.relabel, rule)
+	}
+	for _, d := range cfg.Drop {
+		matchers, err := newMatchers(d.Matchers)
+		if err != nil {
+			return fmt.Errorf("invalid drop rule: %v", err)
+		}
+		rules.drop = append(rules.drop, matchers)
+	}
+	if rules.routes, err = r.newRoutes(cfg.Routes); err != nil {
+		return err
+	}
+
+	r.mtx.Lock()
+	r.rules = rules
+	r.mtx.Unlock()
+	level.Info(r.logger).Log("msg", "routing configuration loaded", "file", r.file, "relabel", len(rules.relabel), "drop", len(rules.drop), "routes", len(rules.routes))
+	return nil
+}
+
+// newRoutes compiles the routes and their child routes
+func (r *router) newRoutes(cfgs []RouteConfig) ([]route, error) {
+	routes := make([]route, 0, len(cfgs))
+	for _, rt := range cfgs {
+		matchers, err := newMatchers(rt.Matchers)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route: %v", err)
+		}
+		for _, t := range rt.Targets {
+			if !r.targets[t] {
+				return nil, fmt.Errorf("route target %q is neither a configured alertmanager nor a receiver", t)
+			}
+		}
+		children, err := r.newRoutes(rt.Routes)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, route{matchers: matchers, targets: rt.Targets, cont: rt.Continue, routes: children})
+	}
+	return routes, nil
+}
+
+// current returns the current routing rules
+func (r *router) current() *routingRules {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.rules
+}
+
+// relabel applies the relabel rules to the alerts, removing the alerts dropped by a keep or drop rule
+func (r *router) relabel(alerts template.Alerts) template.Alerts {
+	if r == nil {
+		return alerts
+	}
+	return relabel(alerts, r.current().relabel)
+}
+
+// drop removes the alerts matching a drop rule
+func (r *router) drop(alerts template.Alerts) template.Alerts {
+	if r == nil {
+		return alerts
+	}
+
+	rules := r.current()
+	kept := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		var dropped bool
+		for _, matchers := range rules.drop {
+			if matchAll(matchers, alt) {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, alt)
+		}
+	}
+	return kept
+}
+
+// selectFor returns the alerts routed to the named alertmanager or receiver
+func (r *router) selectFor(target string, alerts template.Alerts) template.Alerts {
+	if r == nil {
+		return alerts
+	}
+
+	rules := r.current()
+	selected := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		if rules.routedTo(target, alt) {
+			selected = append(selected, alt)
+		}
+	}
+	return selected
+}
+
+// routedTo reports whether the alert is routed to the target
+func (rules *routingRules) routedTo(target string, alt template.Alert) bool {
+	targets, matched := matchRoutes(rules.routes, alt, nil)
+	if !matched {
+		// alerts matching no route are forwarded to all targets
+		return true
+	}
+	for _, t := range targets {
+		if t == target {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRoutes returns the targets of the routes matching the alert and whether any route matched,
+// the deepest matching routes apply and the routes without targets inherit the targets of their parent
+func matchRoutes(routes []route, alt template.Alert, inherited []string) ([]string, bool) {
+	var (
+		targets []string
+		matched bool
+	)
+	for _, rt := range routes {
+		if !matchAll(rt.matchers, alt) {
+			continue
+		}
+		matched = true
+		own := rt.targets
+		if len(own) == 0 {
+			own = inherited
+		}
+		if childTargets, childMatched := matchRoutes(rt.routes, alt, own); childMatched {
+			targets = append(targets, childTargets...)
+		} else {
+			targets = append(targets, own...)
+		}
+		if !rt.cont {
+			break
+		}
+	}
+	return targets, matched
+}
+
+// stop stops watching the routing configuration file
+func (r *router) stop() {
+	if r == nil {
+		return
+	}
+	r.watcher.Close()
+}
@@ -0,0 +1,263 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name    string
+		routing string
+		alerts  template.Alerts
+		wantA   []string
+		wantB   []string
+	}{
+		{
+			name:   "no rules",
+			alerts: firing("x", "y"),
+			wantA:  []string{"x", "y"},
+			wantB:  []string{"x", "y"},
+		},
+		{
+			name: "routes",
+			routing: `
+routes:
+- matchers: [{name: alertname, value: x}]
+  targets: [a]
+`,
+			alerts: firing("x", "y"),
+			wantA:  []string{"x", "y"},
+			wantB:  []string{"y"},
+		},
+		{
+			name: "routing tree",
+			routing: `
+routes:
+- matchers: [{name: alertname, value: "x|y", regex: true}]
+  targets: [b]
+  routes:
+  - matchers: [{name: alertname, value: x}]
+    targets: [a]
+    continue: true
+  - matchers: [{name: alertname, value: x}]
+`,
+			alerts: firing("x", "y", "z"),
+			wantA:  []string{"x", "z"},
+			wantB:  []string{"x", "y", "z"},
+		},
+		{
+			name: "drop",
+			routing: `
+drop:
+- matchers: [{name: alertname, value: x}]
+`,
+			alerts: firing("x", "y"),
+			wantA:  []string{"y"},
+			wantB:  []string{"y"},
+		},
+		{
+			name: "relabel before drop and routes",
+			routing: `
+relabel_configs:
+- source_labels: [alertname]
+  regex: "x"
+  target_label: alertname
+  replacement: renamed
+drop:
+- matchers: [{name: alertname, value: y}]
+routes:
+- matchers: [{name: alertname, value: renamed}]
+  targets: [b]
+`,
+			alerts: firing("x", "y", "z"),
+			wantA:  []string{"z"},
+			wantB:  []string{"renamed", "z"},
+		},
+		{
+			name: "annotation value",
+			routing: `
+routes:
+- matchers: [{name: team, value: storage, on: annotations}]
+  targets: [a]
+`,
+			alerts: template.Alerts{withAnnotations("x", "team", "storage"), withAnnotations("y", "team", "network"), withStatus("z", statusFiring, "team", "storage")},
+			wantA:  []string{"x", "y", "z"},
+			wantB:  []string{"y", "z"},
+		},
+		{
+			name: "annotation presence",
+			routing: `
+routes:
+- matchers: [{name: runbook_url, value: .+, regex: true, on: annotations}]
+  targets: [b]
+`,
+			alerts: template.Alerts{withAnnotations("x", "runbook_url", "https://runbooks.example.com/x"), withAnnotations("y", "summary", "no runbook")},
+			wantA:  []string{"y"},
+			wantB:  []string{"x", "y"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestAlertmanager(t, http.StatusOK)
+			b := newTestAlertmanager(t, http.StatusOK)
+			var opts Options
+			if tc.routing != "" {
+				opts.RoutingConfigFile = writeFile(t, "routing.yaml", tc.routing)
+			}
+			fwder, err := NewForwarderWithOptions(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- name: a
+  static_configs: [`+a.addr()+`]
+- name: b
+  static_configs: [`+b.addr()+`]
+`), opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fwder.Stop()
+
+			if err := fwder.Forward(context.Background(), tc.alerts); err != nil {
+				t.Fatalf("Forward() = %v, want nil", err)
+			}
+			checkAlertnames(t, "a", a.received(), tc.wantA)
+			checkAlertnames(t, "b", b.received(), tc.wantB)
+		})
+	}
+}
+
+func TestRoutingUnknownTarget(t *testing.T) {
+	_, err := NewForwarderWithOptions(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- name: a
+  static_configs: [localhost:9093]
+`), Options{RoutingConfigFile: writeFile(t, "routing.yaml", `
+routes:
+- targets: [unknown]
+`)})
+	if err == nil {
+		t.Fatal("NewForwarderWithOptions() succeeded with an unknown route target, want error")
+	}
+}
+
+func TestReloadRouting(t *testing.T) {
+	a := newTestAlertmanager(t, http.StatusOK)
+	b := newTestAlertmanager(t, http.StatusOK)
+	routing := writeFile(t, "routing.yaml", `
+routes:
+- targets: [a]
+`)
+	fwder, err := NewForwarderWithOptions(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- name: a
+  static_configs: [`+a.addr()+`]
+- name: b
+  static_configs: [`+b.addr()+`]
+`), Options{RoutingConfigFile: routing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwder.Stop()
+	alertmanagers := append([]*Alertmanager(nil), fwder.alertmanagers...)
+	clients := []*http.Client{alertmanagers[0].client, alertmanagers[1].client}
+
+	if err := fwder.Forward(context.Background(), firing("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the new routing takes effect once reloaded
+	if err := ioutil.WriteFile(routing, []byte("routes:\n- targets: [b]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := fwder.ReloadRouting(); err != nil {
+		t.Fatalf("ReloadRouting() = %v, want nil", err)
+	}
+	if err := fwder.Forward(context.Background(), firing("second")); err != nil {
+		t.Fatal(err)
+	}
+	checkAlertnames(t, "a", a.received(), []string{"first"})
+	checkAlertnames(t, "b", b.received(), []string{"second"})
+
+	// invalid routing keeps the current rules
+	if err := ioutil.WriteFile(routing, []byte("routes:\n- targets: [unknown]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := fwder.ReloadRouting(); err == nil {
+		t.Fatal("ReloadRouting() succeeded with an unknown route target, want error")
+	}
+	if err := fwder.Forward(context.Background(), firing("third")); err != nil {
+		t.Fatal(err)
+	}
+	checkAlertnames(t, "b", b.received(), []string{"second", "third"})
+
+	// the alertmanager clients are left untouched
+	for i, am := range fwder.alertmanagers {
+		if am != alertmanagers[i] || am.client != clients[i] {
+			t.Errorf("alertmanager %v was rebuilt by the routing reload", am)
+		}
+	}
+}
+
+func TestMatchRoutes(t *testing.T) {
+	routes := `
+- matchers: [{name: team, value: storage}]
+  targets: [a]
+  routes:
+  - matchers: [{name: severity, value: critical}]
+    targets: [b]
+    continue: true
+  - matchers: [{name: severity, value: critical|warning, regex: true}]
+    routes:
+    - matchers: [{name: env, value: prod}]
+      targets: [c]
+- matchers: [{name: team, value: network}]
+  targets: [b]
+  continue: true
+- matchers: [{name: env, value: prod}]
+  targets: [c]
+- matchers: [{name: env, value: prod}]
+  targets: [a]
+`
+	tests := []struct {
+		name        string
+		labels      []string
+		wantTargets []string
+		wantMatched bool
+	}{
+		{name: "no route matches", labels: []string{"team", "compute"}},
+		{name: "no child route matches", labels: []string{"team", "storage"}, wantTargets: []string{"a"}, wantMatched: true},
+		{name: "child route targets", labels: []string{"team", "storage", "severity", "critical"}, wantTargets: []string{"b", "a"}, wantMatched: true},
+		{name: "child route inherits the targets", labels: []string{"team", "storage", "severity", "warning"}, wantTargets: []string{"a"}, wantMatched: true},
+		{name: "grandchild route", labels: []string{"team", "storage", "severity", "warning", "env", "prod"}, wantTargets: []string{"c"}, wantMatched: true},
+		{name: "continue in child routes", labels: []string{"team", "storage", "severity", "critical", "env", "prod"}, wantTargets: []string{"b", "c"}, wantMatched: true},
+		{name: "continue", labels: []string{"team", "network", "env", "prod"}, wantTargets: []string{"b", "c"}, wantMatched: true},
+		{name: "first match without continue", labels: []string{"env", "prod"}, wantTargets: []string{"c"}, wantMatched: true},
+	}
+
+	var cfgs []RouteConfig
+	if err := yaml.Unmarshal([]byte(routes), &cfgs); err != nil {
+		t.Fatal(err)
+	}
+	r := &router{targets: map[string]bool{"a": true, "b": true, "c": true}}
+	compiled, err := r.newRoutes(cfgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			targets, matched := matchRoutes(compiled, withStatus("a", statusFiring, tc.labels...), nil)
+			if matched != tc.wantMatched || !reflect.DeepEqual(targets, tc.wantTargets) {
+				t.Errorf("matchRoutes() = %v, %v, want %v, %v", targets, matched, tc.wantTargets, tc.wantMatched)
+			}
+		})
+	}
+}
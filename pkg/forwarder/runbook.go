@@ -0,0 +1,108 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+// runbookAnnotation is the annotation carrying the runbook link of an alert
+const runbookAnnotation = "runbook_url"
+
+// RunbooksConfig configures injecting the runbook_url annotation by alertname.
+type RunbooksConfig struct {
+	// YAML file mapping alertnames to runbook URLs, reloaded on change.
+	File string `yaml:"file"`
+	// Replace the runbook_url annotation set by the sender, it is kept by default.
+	Overwrite bool `yaml:"overwrite"`
+}
+
+// runbookInjector sets the runbook_url annotation of the alerts from the runbooks file
+type runbookInjector struct {
+	logger    log.Logger
+	file      string
+	overwrite bool
+
+	mtx      sync.RWMutex
+	runbooks map[string]string // alertname -> runbook URL
+
+	watcher *fsnotify.Watcher
+}
+
+// newRunbookInjector loads the runbooks file and watches it for changes, nil if no file is set
+func newRunbookInjector(l log.Logger, cfg RunbooksConfig) (*runbookInjector, error) {
+	if cfg.File == "" {
+		return nil, nil
+	}
+
+	ri := &runbookInjector{logger: l, file: cfg.File, overwrite: cfg.Overwrite}
+	if err := ri.reload(); err != nil {
+		return nil, err
+	}
+	watcher, err := watchFile(l, cfg.File, ri.reload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch runbooks file: %v", err)
+	}
+	ri.watcher = watcher
+	return ri, nil
+}
+
+// reload loads the runbooks file, the current runbooks are kept on error
+func (ri *runbookInjector) reload() error {
+	b, err := ioutil.ReadFile(ri.file)
+	if err != nil {
+		return fmt.Errorf("failed to load runbooks file %s: %v", ri.file, err)
+	}
+	runbooks := make(map[string]string)
+	if err := yaml.UnmarshalStrict(b, &runbooks); err != nil {
+		return fmt.Errorf("failed to unmarshal runbooks file: %v", err)
+	}
+
+	ri.mtx.Lock()
+	ri.runbooks = runbooks
+	ri.mtx.Unlock()
+	level.Info(ri.logger).Log("msg", "runbooks file loaded", "file", ri.file, "runbooks", len(runbooks))
+	return nil
+}
+
+// inject sets the runbook_url annotation of the alerts whose alertname has a runbook
+func (ri *runbookInjector) inject(alerts template.Alerts) template.Alerts {
+	if ri == nil {
+		return alerts
+	}
+
+	ri.mtx.RLock()
+	runbooks := ri.runbooks
+	ri.mtx.RUnlock()
+
+	for i, alt := range alerts {
+		url, found := runbooks[alt.Labels[model.AlertNameLabel]]
+		if !found {
+			continue
+		}
+		if current, set := alt.Annotations[runbookAnnotation]; current == url || (set && !ri.overwrite) {
+			continue
+		}
+		annotations := copyKV(alt.Annotations)
+		annotations[runbookAnnotation] = url
+		alerts[i].Annotations = annotations
+	}
+	return alerts
+}
+
+// stop stops watching the runbooks file
+func (ri *runbookInjector) stop() {
+	if ri == nil {
+		return
+	}
+	ri.watcher.Close()
+}
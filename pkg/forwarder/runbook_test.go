@@ -0,0 +1,96 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestRunbookInjector(t *testing.T) {
+	const runbooks = `
+KubePodCrashLooping: https://runbooks.example.com/crashloop
+Watchdog: https://runbooks.example.com/watchdog
+`
+	tests := []struct {
+		name      string
+		overwrite bool
+		alert     template.Alert
+		want      string
+	}{
+		{
+			name:  "injected",
+			alert: template.Alert{Labels: template.KV{"alertname": "KubePodCrashLooping"}},
+			want:  "https://runbooks.example.com/crashloop",
+		},
+		{
+			name:  "no runbook",
+			alert: template.Alert{Labels: template.KV{"alertname": "Other"}},
+		},
+		{
+			name:  "sender runbook kept",
+			alert: template.Alert{Labels: template.KV{"alertname": "Watchdog"}, Annotations: template.KV{runbookAnnotation: "https://wiki"}},
+			want:  "https://wiki",
+		},
+		{
+			name:      "sender runbook overwritten",
+			overwrite: true,
+			alert:     template.Alert{Labels: template.KV{"alertname": "Watchdog"}, Annotations: template.KV{runbookAnnotation: "https://wiki"}},
+			want:      "https://runbooks.example.com/watchdog",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ri, err := newRunbookInjector(log.NewNopLogger(), RunbooksConfig{File: writeFile(t, "runbooks.yaml", runbooks), Overwrite: tc.overwrite})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ri.stop()
+			before := copyKV(tc.alert.Annotations)
+			got := ri.inject(template.Alerts{tc.alert})
+			if url := got[0].Annotations[runbookAnnotation]; url != tc.want {
+				t.Errorf("runbook_url = %q, want %q", url, tc.want)
+			}
+			if len(before) != len(tc.alert.Annotations) || before[runbookAnnotation] != tc.alert.Annotations[runbookAnnotation] {
+				t.Error("the annotations shared with the sender were modified")
+			}
+		})
+	}
+}
+
+func TestRunbookInjectorReload(t *testing.T) {
+	file := writeFile(t, "runbooks.yaml", "a: https://runbooks.example.com/a\n")
+	ri, err := newRunbookInjector(log.NewNopLogger(), RunbooksConfig{File: file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ri.stop()
+
+	// an invalid file keeps the current runbooks
+	ri.file = writeFile(t, "invalid.yaml", "a: [")
+	if err := ri.reload(); err == nil {
+		t.Fatal("reload() succeeded with an invalid file, want error")
+	}
+	if got := ri.inject(firing("a"))[0].Annotations[runbookAnnotation]; got != "https://runbooks.example.com/a" {
+		t.Errorf("runbook_url = %q after a failed reload, want the previous runbook", got)
+	}
+
+	ri.file = writeFile(t, "updated.yaml", "a: https://runbooks.example.com/updated\n")
+	if err := ri.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := ri.inject(firing("a"))[0].Annotations[runbookAnnotation]; got != "https://runbooks.example.com/updated" {
+		t.Errorf("runbook_url = %q, want the updated runbook", got)
+	}
+}
+
+func TestNewRunbookInjector(t *testing.T) {
+	if ri, err := newRunbookInjector(log.NewNopLogger(), RunbooksConfig{}); ri != nil || err != nil {
+		t.Errorf("newRunbookInjector() without file = %v, %v, want nil", ri, err)
+	}
+	if _, err := newRunbookInjector(log.NewNopLogger(), RunbooksConfig{File: "/nonexistent/runbooks.yaml"}); err == nil {
+		t.Error("newRunbookInjector() succeeded with a missing file, want error")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build archive
+// +build archive
+
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// s3Store is an object store for S3 compatible APIs, authenticated with AWS signature version 4
+type s3Store struct {
+	client    *http.Client
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	now       func() time.Time
+}
+
+// newS3Store returns a new S3 compatible object store
+func newS3Store(cfg ArchiveConfig) (*s3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("endpoint and bucket are required")
+	}
+	secretKey := cfg.SecretKey
+	if cfg.SecretKeyFile != "" {
+		b, err := ioutil.ReadFile(cfg.SecretKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret key file %s: %v", cfg.SecretKeyFile, err)
+		}
+		secretKey = strings.TrimSpace(string(b))
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	scheme := "https"
+	if cfg.Insecure {
+		scheme = "http"
+	}
+
+	return &s3Store{
+		client:    &http.Client{Timeout: time.Minute},
+		endpoint:  fmt.Sprintf("%s://%s", scheme, cfg.Endpoint),
+		region:    region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: secretKey,
+		now:       time.Now,
+	}, nil
+}
+
+// Put uploads the object to the bucket using a path-style URL
+func (s *s3Store) Put(ctx context.Context, key string, body []byte) error {
+	uri := "/" + awsURIEncode(s.bucket) + "/" + awsURIEncode(key)
+	req, err := http.NewRequest("PUT", s.endpoint+uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	s.sign(req, uri, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to %q: %v", s.endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return responseError(resp, s.endpoint)
+	}
+	return nil
+}
+
+// sign adds the AWS signature version 4 authorization header to the request
+func (s *s3Store) sign(req *http.Request, uri string, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.accessKey == "" {
+		return
+	}
+
+	signedHeaders := "content-encoding;content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("content-encoding:%s\ncontent-type:%s\nhost:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n",
+		req.Header.Get("Content-Encoding"), req.Header.Get("Content-Type"), req.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{req.Method, uri, "", canonicalHeaders, signedHeaders, payloadHash}, "\n")
+
+	scope := strings.Join([]string{date, s.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode encodes the object key as required by the AWS signature, keeping the slashes
+func awsURIEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,260 @@
+// Copyright Contributors to the Open Cluster Management project
+
+//go:build archive
+// +build archive
+
+package forwarder
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an S3 compatible object store verifying the AWS signature version 4 of the requests
+type fakeS3 struct {
+	*httptest.Server
+
+	accessKey string
+	secretKey string
+	region    string
+	status    int // answered to the valid requests if set
+
+	mtx     sync.Mutex
+	objects map[string][]byte // escaped path -> body
+}
+
+// newFakeS3 returns a started fake object store, it doesn't verify the signatures without an access key
+func newFakeS3(t *testing.T, accessKey, secretKey, region string) *fakeS3 {
+	t.Helper()
+	s := &fakeS3{accessKey: accessKey, secretKey: secretKey, region: region, objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read the request body: %v", err)
+		}
+		if r.Method != http.MethodPut {
+			http.Error(w, "unexpected method "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+		if s.accessKey != "" {
+			if err := s.verify(r, body); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+		}
+		s.mtx.Lock()
+		status := s.status
+		if status == 0 {
+			s.objects[r.URL.EscapedPath()] = body
+		}
+		s.mtx.Unlock()
+		if status != 0 {
+			w.WriteHeader(status)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// verify checks the AWS signature version 4 of the request against the signed request as received
+func (s *fakeS3) verify(r *http.Request, body []byte) error {
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != sha256Hex(body) {
+		return fmt.Errorf("payload hash %q doesn't match the body", got)
+	}
+	auth := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	fields := make(map[string]string)
+	for _, f := range strings.Split(auth, ", ") {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid authorization header %q", r.Header.Get("Authorization"))
+		}
+		fields[kv[0]] = kv[1]
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) < 8 {
+		return fmt.Errorf("invalid X-Amz-Date %q", amzDate)
+	}
+	scope := strings.Join([]string{amzDate[:8], s.region, "s3", "aws4_request"}, "/")
+	if want := s.accessKey + "/" + scope; fields["Credential"] != want {
+		return fmt.Errorf("credential = %q, want %q", fields["Credential"], want)
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range strings.Split(fields["SignedHeaders"], ";") {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	canonicalRequest := strings.Join([]string{r.Method, r.URL.EscapedPath(), r.URL.RawQuery, canonicalHeaders.String(), fields["SignedHeaders"], sha256Hex(body)}, "\n")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{amzDate[:8], s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	if want := hex.EncodeToString(hmacSHA256(key, stringToSign)); fields["Signature"] != want {
+		return fmt.Errorf("signature = %q, want %q", fields["Signature"], want)
+	}
+	return nil
+}
+
+// object returns the body of the object stored at the escaped path
+func (s *fakeS3) object(path string) ([]byte, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	body, found := s.objects[path]
+	return body, found
+}
+
+// keys returns the escaped paths of the stored objects
+func (s *fakeS3) keys() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// config returns the archive configuration of the fake object store
+func (s *fakeS3) config(bucket string) ArchiveConfig {
+	return ArchiveConfig{
+		Endpoint:  strings.TrimPrefix(s.URL, "http://"),
+		Region:    s.region,
+		Bucket:    bucket,
+		AccessKey: s.accessKey,
+		SecretKey: s.secretKey,
+		Insecure:  true,
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	secretKeyFile := writeFile(t, "secret", "from-file\n")
+	tests := []struct {
+		name          string
+		cfg           ArchiveConfig
+		wantErr       bool
+		wantEndpoint  string
+		wantRegion    string
+		wantSecretKey string
+	}{
+		{
+			name:          "defaults",
+			cfg:           ArchiveConfig{Endpoint: "s3.example.com", Bucket: "alerts", SecretKey: "secret"},
+			wantEndpoint:  "https://s3.example.com",
+			wantRegion:    "us-east-1",
+			wantSecretKey: "secret",
+		},
+		{
+			name:          "insecure with region and secret key file",
+			cfg:           ArchiveConfig{Endpoint: "minio:9000", Bucket: "alerts", Region: "eu-west-1", SecretKeyFile: secretKeyFile, Insecure: true},
+			wantEndpoint:  "http://minio:9000",
+			wantRegion:    "eu-west-1",
+			wantSecretKey: "from-file",
+		},
+		{name: "no endpoint", cfg: ArchiveConfig{Bucket: "alerts"}, wantErr: true},
+		{name: "no bucket", cfg: ArchiveConfig{Endpoint: "s3.example.com"}, wantErr: true},
+		{name: "missing secret key file", cfg: ArchiveConfig{Endpoint: "s3.example.com", Bucket: "alerts", SecretKeyFile: secretKeyFile + ".missing"}, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newS3Store(tc.cfg)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("newS3Store() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if s.endpoint != tc.wantEndpoint || s.region != tc.wantRegion || s.secretKey != tc.wantSecretKey {
+				t.Errorf("newS3Store() = endpoint %q, region %q, secret key %q, want %q, %q, %q",
+					s.endpoint, s.region, s.secretKey, tc.wantEndpoint, tc.wantRegion, tc.wantSecretKey)
+			}
+		})
+	}
+}
+
+func TestS3StorePut(t *testing.T) {
+	tests := []struct {
+		name      string
+		accessKey string
+		secretKey string
+		wrongKey  bool
+		status    int
+		key       string
+		wantPath  string
+		wantErr   bool
+	}{
+		{name: "signed", accessKey: "AKID", secretKey: "secret", key: "alerts/2021/01/01/1.json.gz", wantPath: "/bucket/alerts/2021/01/01/1.json.gz"},
+		{name: "signed key with reserved characters", accessKey: "AKID", secretKey: "secret", key: "a b+c/d=e", wantPath: "/bucket/a%20b%2Bc/d%3De"},
+		{name: "anonymous", key: "1.json.gz", wantPath: "/bucket/1.json.gz"},
+		{name: "wrong secret key", accessKey: "AKID", secretKey: "secret", wrongKey: true, key: "1.json.gz", wantErr: true},
+		{name: "server error", accessKey: "AKID", secretKey: "secret", status: http.StatusInternalServerError, key: "1.json.gz", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeS3(t, tc.accessKey, tc.secretKey, "eu-west-1")
+			server.status = tc.status
+			cfg := server.config("bucket")
+			if tc.wrongKey {
+				cfg.SecretKey = "wrong"
+			}
+			s, err := newS3Store(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.now = func() time.Time { return time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC) }
+
+			err = s.Put(context.Background(), tc.key, []byte("body"))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Put() error = %v, want error %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if body, found := server.object(tc.wantPath); !found || string(body) != "body" {
+				t.Errorf("object %s = %q (found %v), want %q in %v", tc.wantPath, body, found, "body", server.keys())
+			}
+		})
+	}
+}
+
+func TestS3StoreSign(t *testing.T) {
+	s := &s3Store{region: "us-east-1", accessKey: "AKID", secretKey: "secret", now: func() time.Time {
+		return time.Date(2021, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	}}
+	req, err := http.NewRequest(http.MethodPut, "http://s3.example.com/bucket/key", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	s.sign(req, "/bucket/key", []byte("body"))
+
+	if got, want := req.Header.Get("X-Amz-Date"), "20210101T110000Z"; got != want {
+		t.Errorf("X-Amz-Date = %q, want %q", got, want)
+	}
+	wantPrefix := "AWS4-HMAC-SHA256 Credential=AKID/20210101/us-east-1/s3/aws4_request, " +
+		"SignedHeaders=content-encoding;content-type;host;x-amz-content-sha256;x-amz-date, Signature="
+	if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, wantPrefix) {
+		t.Errorf("Authorization = %q, want prefix %q", got, wantPrefix)
+	}
+
+	// the signature changes with the signed content
+	signature := req.Header.Get("Authorization")
+	s.sign(req, "/bucket/key", []byte("other body"))
+	if req.Header.Get("Authorization") == signature {
+		t.Error("the signature doesn't depend on the payload")
+	}
+}
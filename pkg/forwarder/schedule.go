@@ -0,0 +1,277 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+const (
+	// scheduleCheckInterval is the interval the buffered alerts are checked for an open window
+	scheduleCheckInterval = time.Minute
+
+	outsideBuffer = "buffer"
+	outsideDrop   = "drop"
+)
+
+// ScheduleConfig restricts forwarding the alerts matching all of its matchers to time windows,
+// the first matching schedule applies.
+type ScheduleConfig struct {
+	Matchers []MatcherConfig `yaml:"matchers"`
+	// Timezone the time ranges are evaluated in, defaults to UTC.
+	Timezone string `yaml:"timezone"`
+	// Days of the week the alerts are forwarded on (e.g. monday), all days if empty.
+	Days []string `yaml:"days"`
+	// Time ranges of the day the alerts are forwarded in, the whole day if empty.
+	TimeRanges []TimeRangeConfig `yaml:"time_ranges"`
+	// What happens to the alerts outside the windows, either buffer (default) to forward them
+	// once a window opens or drop.
+	Outside string `yaml:"outside"`
+}
+
+// TimeRangeConfig is a range of the day in the HH:MM format, the end is exclusive and
+// the range spans midnight if the end is before the start.
+type TimeRangeConfig struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// schedule is a compiled schedule
+type schedule struct {
+	matchers []*matcher
+	location *time.Location
+	days     map[time.Weekday]bool
+	ranges   [][2]int // minutes of the day
+	drop     bool
+}
+
+// active reports whether the schedule window is open at the time
+func (s *schedule) active(t time.Time) bool {
+	t = t.In(s.location)
+	if len(s.days) > 0 && !s.days[t.Weekday()] {
+		return false
+	}
+	if len(s.ranges) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, r := range s.ranges {
+		if r[0] <= r[1] && minute >= r[0] && minute < r[1] {
+			return true
+		}
+		if r[0] > r[1] && (minute >= r[0] || minute < r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduler holds back the alerts outside the windows of their schedule
+type scheduler struct {
+	logger    log.Logger
+	schedules []*schedule
+	deliver   func(context.Context, template.Alerts) error
+	now       func() time.Time
+
+	mtx      sync.Mutex
+	buffered map[string]bufferedAlert // fingerprint -> alert
+	stopc    chan struct{}
+	done     chan struct{}
+}
+
+type bufferedAlert struct {
+	alert    template.Alert
+	schedule *schedule
+}
+
+// newScheduler compiles the schedules and starts flushing the buffered alerts once their window opens,
+// nil if there are no schedules
+func newScheduler(l log.Logger, cfgs []ScheduleConfig, deliver func(context.Context, template.Alerts) error) (*scheduler, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	s := &scheduler{
+		logger:   l,
+		deliver:  deliver,
+		now:      time.Now,
+		buffered: make(map[string]bufferedAlert),
+		stopc:    make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i, cfg := range cfgs {
+		sched, err := newSchedule(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %d: %v", i, err)
+		}
+		s.schedules = append(s.schedules, sched)
+	}
+	go s.run()
+	return s, nil
+}
+
+// newSchedule compiles the schedule
+func newSchedule(cfg ScheduleConfig) (*schedule, error) {
+	matchers, err := newMatchers(cfg.Matchers)
+	if err != nil {
+		return nil, err
+	}
+	s := &schedule{matchers: matchers, location: time.UTC}
+	if cfg.Timezone != "" {
+		if s.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", cfg.Timezone, err)
+		}
+	}
+	if len(cfg.Days) > 0 {
+		s.days = make(map[time.Weekday]bool)
+	}
+	for _, d := range cfg.Days {
+		day, err := parseWeekday(d)
+		if err != nil {
+			return nil, err
+		}
+		s.days[day] = true
+	}
+	for _, r := range cfg.TimeRanges {
+		start, err := parseTimeOfDay(r.Start)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseTimeOfDay(r.End)
+		if err != nil {
+			return nil, err
+		}
+		s.ranges = append(s.ranges, [2]int{start, end})
+	}
+	switch cfg.Outside {
+	case "", outsideBuffer:
+	case outsideDrop:
+		s.drop = true
+	default:
+		return nil, fmt.Errorf("outside must be %s or %s, got %q", outsideBuffer, outsideDrop, cfg.Outside)
+	}
+	return s, nil
+}
+
+// parseWeekday parses the name of a day of the week
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(s, d.String()) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", s)
+}
+
+// parseTimeOfDay parses a time of the day in the HH:MM format into the minutes since midnight
+func parseTimeOfDay(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
+
+// hold returns the alerts to forward now, the alerts outside the window of their schedule
+// are buffered or dropped
+func (s *scheduler) hold(alerts template.Alerts) template.Alerts {
+	if s == nil {
+		return alerts
+	}
+
+	now := s.now()
+	kept := make(template.Alerts, 0, len(alerts))
+	var held, dropped int
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, alt := range alerts {
+		sched := s.scheduleFor(alt)
+		if sched == nil || sched.active(now) {
+			kept = append(kept, alt)
+			continue
+		}
+		if sched.drop {
+			dropped++
+			continue
+		}
+		// keep the latest state of the alert
+		s.buffered[Fingerprint(alt)] = bufferedAlert{alert: alt, schedule: sched}
+		held++
+	}
+	if held > 0 || dropped > 0 {
+		level.Debug(s.logger).Log("msg", "alerts outside of their schedule", "buffered", held, "dropped", dropped)
+	}
+	return kept
+}
+
+// scheduleFor returns the first schedule matching the alert, nil if none matches
+func (s *scheduler) scheduleFor(alt template.Alert) *schedule {
+	for _, sched := range s.schedules {
+		if matchAll(sched.matchers, alt) {
+			return sched
+		}
+	}
+	return nil
+}
+
+// run flushes the buffered alerts periodically until the scheduler is stopped
+func (s *scheduler) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.flush(context.Background())
+		case <-s.stopc:
+			return
+		}
+	}
+}
+
+// flush forwards the buffered alerts whose schedule window is open
+func (s *scheduler) flush(ctx context.Context) {
+	now := s.now()
+	var alerts template.Alerts
+
+	s.mtx.Lock()
+	for fp, b := range s.buffered {
+		if b.schedule.active(now) {
+			alerts = append(alerts, b.alert)
+			delete(s.buffered, fp)
+		}
+	}
+	s.mtx.Unlock()
+
+	if len(alerts) == 0 {
+		return
+	}
+	level.Info(s.logger).Log("msg", "schedule window opened, forwarding buffered alerts", "numAlerts", len(alerts))
+	if err := s.deliver(ctx, alerts); err != nil {
+		level.Warn(s.logger).Log("msg", "forwarding buffered alerts failed", "numAlerts", len(alerts), "err", err)
+	}
+}
+
+// stop stops flushing, the alerts still buffered are discarded
+func (s *scheduler) stop() {
+	if s == nil {
+		return
+	}
+	close(s.stopc)
+	<-s.done
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if len(s.buffered) > 0 {
+		level.Warn(s.logger).Log("msg", "discarding alerts buffered outside of their schedule on shutdown", "numAlerts", len(s.buffered))
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestScheduleActive(t *testing.T) {
+	// Monday
+	monday := time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		cfg  ScheduleConfig
+		at   time.Time
+		want bool
+	}{
+		{name: "always", at: monday, want: true},
+		{name: "day", cfg: ScheduleConfig{Days: []string{"Monday"}}, at: monday, want: true},
+		{name: "other day", cfg: ScheduleConfig{Days: []string{"saturday", "sunday"}}, at: monday},
+		{
+			name: "within the range",
+			cfg:  ScheduleConfig{TimeRanges: []TimeRangeConfig{{Start: "09:00", End: "17:00"}}},
+			at:   monday.Add(9 * time.Hour),
+			want: true,
+		},
+		{
+			name: "end is exclusive",
+			cfg:  ScheduleConfig{TimeRanges: []TimeRangeConfig{{Start: "09:00", End: "17:00"}}},
+			at:   monday.Add(17 * time.Hour),
+		},
+		{
+			name: "range spanning midnight",
+			cfg:  ScheduleConfig{TimeRanges: []TimeRangeConfig{{Start: "22:00", End: "06:00"}}},
+			at:   monday.Add(5 * time.Hour),
+			want: true,
+		},
+		{
+			name: "outside the range spanning midnight",
+			cfg:  ScheduleConfig{TimeRanges: []TimeRangeConfig{{Start: "22:00", End: "06:00"}}},
+			at:   monday.Add(12 * time.Hour),
+		},
+		{
+			name: "timezone",
+			cfg:  ScheduleConfig{Timezone: "America/New_York", TimeRanges: []TimeRangeConfig{{Start: "09:00", End: "17:00"}}},
+			at:   monday.Add(15 * time.Hour),
+			want: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := newSchedule(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.active(tc.at); got != tc.want {
+				t.Errorf("active(%v) = %v, want %v", tc.at, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ScheduleConfig
+	}{
+		{name: "timezone", cfg: ScheduleConfig{Timezone: "Mars/Olympus"}},
+		{name: "day", cfg: ScheduleConfig{Days: []string{"someday"}}},
+		{name: "time of day", cfg: ScheduleConfig{TimeRanges: []TimeRangeConfig{{Start: "9am", End: "17:00"}}}},
+		{name: "minutes", cfg: ScheduleConfig{TimeRanges: []TimeRangeConfig{{Start: "09:60", End: "17:00"}}}},
+		{name: "outside", cfg: ScheduleConfig{Outside: "queue"}},
+		{name: "matcher", cfg: ScheduleConfig{Matchers: []MatcherConfig{{Value: "a"}}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newSchedule(tc.cfg); err == nil {
+				t.Error("newSchedule() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	var (
+		mtx       sync.Mutex
+		delivered template.Alerts
+	)
+	s, err := newScheduler(log.NewNopLogger(), []ScheduleConfig{
+		{
+			Matchers:   []MatcherConfig{{Name: "severity", Value: "info"}},
+			TimeRanges: []TimeRangeConfig{{Start: "09:00", End: "17:00"}},
+		},
+		{
+			Matchers:   []MatcherConfig{{Name: "severity", Value: "none"}},
+			TimeRanges: []TimeRangeConfig{{Start: "09:00", End: "17:00"}},
+			Outside:    outsideDrop,
+		},
+	}, func(_ context.Context, alerts template.Alerts) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		delivered = append(delivered, alerts...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.stop()
+	now := time.Date(2021, time.March, 1, 8, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	kept := s.hold(template.Alerts{
+		withSeverity("critical", "critical"),
+		withSeverity("info", "info"),
+		withSeverity("none", "none"),
+	})
+	checkAlertnames(t, "kept outside the window", alertnamesOf(kept), []string{"critical"})
+
+	// the window is still closed
+	s.flush(context.Background())
+	if len(delivered) != 0 {
+		t.Fatalf("delivered %v before the window opened, want nothing", alertnamesOf(delivered))
+	}
+
+	now = now.Add(time.Hour)
+	s.flush(context.Background())
+	checkAlertnames(t, "delivered once the window opened", alertnamesOf(delivered), []string{"info"})
+	kept = s.hold(template.Alerts{withSeverity("info", "info")})
+	if len(kept) != 1 {
+		t.Errorf("kept %d alerts within the window, want 1", len(kept))
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+)
+
+// semaphore limits the number of in-flight upstream requests, the requests above the limit wait for a free slot.
+// The forwarder has no asynchronous queue, the requests waiting for a slot are its queue: the queue depth,
+// queue capacity and busy workers metrics report the waiting requests, the limit and the taken slots.
+type semaphore chan struct{}
+
+// newSemaphore returns a new semaphore, nil if the limit is not set
+func newSemaphore(max int) semaphore {
+	if max <= 0 {
+		queueCapacity.Set(0)
+		return nil
+	}
+	queueCapacity.Set(float64(max))
+	return make(semaphore, max)
+}
+
+// acquire waits for a free slot until the context is done
+func (s semaphore) acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	queueDepth.Inc()
+	defer queueDepth.Dec()
+	select {
+	case s <- struct{}{}:
+		workersBusy.Inc()
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees the slot taken by acquire
+func (s semaphore) release() {
+	if s == nil {
+		return
+	}
+	<-s
+	workersBusy.Dec()
+}
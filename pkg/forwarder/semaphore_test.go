@@ -0,0 +1,167 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSemaphore(t *testing.T) {
+	tests := []struct {
+		name     string
+		max      int
+		acquired int  // slots taken before the last acquire
+		wantErr  bool // whether the last acquire times out
+	}{
+		{name: "unlimited", max: 0, acquired: 100},
+		{name: "free slot", max: 2, acquired: 1},
+		{name: "full", max: 2, acquired: 2, wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newSemaphore(tc.max)
+			for i := 0; i < tc.acquired; i++ {
+				if err := s.acquire(context.Background()); err != nil {
+					t.Fatalf("acquire() #%d = %v, want nil", i+1, err)
+				}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := s.acquire(ctx)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("acquire() = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil {
+				s.release()
+			}
+			for i := 0; i < tc.acquired; i++ {
+				s.release()
+			}
+		})
+	}
+}
+
+func TestSemaphoreReleaseWakesWaiter(t *testing.T) {
+	s := newSemaphore(1)
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() { acquired <- s.acquire(context.Background()) }()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire() returned while the slot is taken")
+	case <-time.After(20 * time.Millisecond):
+	}
+	s.release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("acquire() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("acquire() still waiting after the slot was released")
+	}
+	s.release()
+}
+
+func TestSemaphoreMetrics(t *testing.T) {
+	checkGauges := func(wantDepth, wantBusy float64) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for testutil.ToFloat64(queueDepth) != wantDepth && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if depth, busy := testutil.ToFloat64(queueDepth), testutil.ToFloat64(workersBusy); depth != wantDepth || busy != wantBusy {
+			t.Fatalf("queue depth %v and busy workers %v, want %v and %v", depth, busy, wantDepth, wantBusy)
+		}
+	}
+
+	s := newSemaphore(1)
+	if got := testutil.ToFloat64(queueCapacity); got != 1 {
+		t.Errorf("queue capacity = %v, want 1", got)
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checkGauges(0, 1)
+
+	// the request waiting for the slot is queued until the slot is released
+	acquired := make(chan error)
+	go func() { acquired <- s.acquire(context.Background()) }()
+	checkGauges(1, 1)
+	s.release()
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	checkGauges(0, 1)
+	s.release()
+	checkGauges(0, 0)
+}
+
+func TestForwardMaxConcurrentForwards(t *testing.T) {
+	var (
+		mtx               sync.Mutex
+		inFlight, maxSeen int
+	)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		inFlight++
+		if inFlight > maxSeen {
+			maxSeen = inFlight
+		}
+		mtx.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mtx.Lock()
+		inFlight--
+		mtx.Unlock()
+	}))
+	defer upstream.Close()
+	addr := strings.TrimPrefix(upstream.URL, "http://")
+
+	tests := []struct {
+		name    string
+		max     int
+		wantMax int
+	}{
+		{name: "limited", max: 1, wantMax: 1},
+		{name: "limited to two", max: 2, wantMax: 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mtx.Lock()
+			maxSeen = 0
+			mtx.Unlock()
+			fwder := newTestForwarder(t, `
+max_concurrent_forwards: `+strconv.Itoa(tc.max)+`
+alertmanagers:
+- name: a
+  static_configs: [`+addr+`]
+- name: b
+  static_configs: [`+addr+`]
+- name: c
+  static_configs: [`+addr+`]
+- name: d
+  static_configs: [`+addr+`]
+`)
+			if err := fwder.Forward(context.Background(), firing("a")); err != nil {
+				t.Fatal(err)
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			if maxSeen > tc.wantMax {
+				t.Errorf("%d concurrent requests, want at most %d", maxSeen, tc.wantMax)
+			}
+		})
+	}
+}
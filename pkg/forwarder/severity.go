@@ -0,0 +1,100 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// severityLabel is the label carrying the severity of an alert
+const severityLabel = "severity"
+
+// severityPriorities ranks the severities, lower ranks are forwarded first when the alerts are queued
+var severityPriorities = map[string]int{
+	"critical": 0,
+	"warning":  1,
+	"info":     2,
+}
+
+// severityPriority returns the rank of the severity of the alert, the alerts without a known
+// severity are ranked last
+func severityPriority(alt template.Alert) int {
+	if p, found := severityPriorities[strings.ToLower(alt.Labels[severityLabel])]; found {
+		return p
+	}
+	return len(severityPriorities)
+}
+
+// byPriority returns the indexes of the alerts ordered by severity priority, in received order
+// within a severity
+func byPriority(n int, alert func(i int) template.Alert) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return severityPriority(alert(order[i])) < severityPriority(alert(order[j]))
+	})
+	return order
+}
+
+// SeverityMappingConfig normalizes the severity label of the alerts to a canonical set of values.
+type SeverityMappingConfig struct {
+	// Canonical severity by source severity, the source severities are matched case-insensitively,
+	// e.g. P1: critical. The canonical severities map to themselves.
+	Map map[string]string `yaml:"map"`
+	// Severity of the alerts whose severity is neither mapped nor canonical, empty keeps it unchanged.
+	Default string `yaml:"default"`
+}
+
+// severityNormalizer rewrites the severity label of the alerts
+type severityNormalizer struct {
+	mapping map[string]string // lowercase source or canonical severity -> canonical severity
+	def     string
+}
+
+// newSeverityNormalizer returns a new severity normalizer, nil if no mapping is configured
+func newSeverityNormalizer(cfg SeverityMappingConfig) *severityNormalizer {
+	if len(cfg.Map) == 0 && cfg.Default == "" {
+		return nil
+	}
+	n := &severityNormalizer{mapping: make(map[string]string, 2*len(cfg.Map)+1), def: cfg.Default}
+	for _, to := range cfg.Map {
+		n.mapping[strings.ToLower(to)] = to
+	}
+	if cfg.Default != "" {
+		n.mapping[strings.ToLower(cfg.Default)] = cfg.Default
+	}
+	for from, to := range cfg.Map {
+		n.mapping[strings.ToLower(from)] = to
+	}
+	return n
+}
+
+// normalize sets the canonical severity on the alerts carrying a severity label
+func (n *severityNormalizer) normalize(alerts template.Alerts) template.Alerts {
+	if n == nil {
+		return alerts
+	}
+
+	for i, alt := range alerts {
+		severity, found := alt.Labels[severityLabel]
+		if !found {
+			continue
+		}
+		canonical, found := n.mapping[strings.ToLower(severity)]
+		if !found {
+			canonical = n.def
+		}
+		if canonical == "" || canonical == severity {
+			continue
+		}
+		labels := copyKV(alt.Labels)
+		labels[severityLabel] = canonical
+		alerts[i].Labels = labels
+	}
+	return alerts
+}
@@ -0,0 +1,79 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestSeverityNormalizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        SeverityMappingConfig
+		severities []string // empty for an alert without the severity label
+		want       []string
+	}{
+		{
+			name:       "disabled",
+			severities: []string{"P1", "Critical", ""},
+			want:       []string{"P1", "Critical", ""},
+		},
+		{
+			name:       "mapped case-insensitively",
+			cfg:        SeverityMappingConfig{Map: map[string]string{"P1": "critical", "P2": "warning"}},
+			severities: []string{"p1", "P2", "P3", "CRITICAL", ""},
+			want:       []string{"critical", "warning", "P3", "critical", ""},
+		},
+		{
+			name:       "default",
+			cfg:        SeverityMappingConfig{Map: map[string]string{"P1": "critical"}, Default: "info"},
+			severities: []string{"P1", "P3", "Info", ""},
+			want:       []string{"critical", "info", "info", ""},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts := make(template.Alerts, 0, len(tc.severities))
+			shared := template.KV{"alertname": "a"}
+			for _, s := range tc.severities {
+				labels := template.KV{"alertname": "a"}
+				if s == "" {
+					labels = shared
+				} else {
+					labels[severityLabel] = s
+				}
+				alerts = append(alerts, template.Alert{Labels: labels})
+			}
+			got := make([]string, 0, len(alerts))
+			for _, alt := range newSeverityNormalizer(tc.cfg).normalize(alerts) {
+				got = append(got, alt.Labels[severityLabel])
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("severities = %v, want %v", got, tc.want)
+			}
+			if _, found := shared[severityLabel]; found {
+				t.Error("the labels shared with the sender were modified")
+			}
+		})
+	}
+}
+
+func TestByPriority(t *testing.T) {
+	alerts := template.Alerts{
+		withSeverity("a", "info"),
+		withSeverity("b", ""),
+		withSeverity("c", "Critical"),
+		withSeverity("d", "warning"),
+		withSeverity("e", "critical"),
+	}
+	var got []string
+	for _, i := range byPriority(len(alerts), func(i int) template.Alert { return alerts[i] }) {
+		got = append(got, alerts[i].Labels["alertname"])
+	}
+	if want := []string{"c", "e", "d", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("byPriority() = %v, want %v", got, want)
+	}
+}
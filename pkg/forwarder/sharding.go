@@ -0,0 +1,87 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// defaultVirtualNodes is the number of points of each alertmanager on the hash ring if it is not configured
+const defaultVirtualNodes = 100
+
+// ShardingConfig distributes the alerts across the alertmanagers by the hash of a label, each alert
+// is sent to a single enabled alertmanager of the priority instead of all of them, and fails over
+// to the next priority if that alertmanager fails. Mirror alertmanagers still receive all alerts.
+type ShardingConfig struct {
+	// Label whose value is hashed, e.g. alertname.
+	Label string `yaml:"label"`
+	// Number of points of each alertmanager on the consistent hash ring, defaults to 100.
+	VirtualNodes int `yaml:"virtual_nodes"`
+}
+
+// hashRing maps label values to alertmanagers with consistent hashing,
+// so that removing an alertmanager only moves the alerts it owned
+type hashRing struct {
+	label  string
+	points []uint32
+	owners map[uint32]string // point -> alertmanager
+}
+
+// newHashRing returns a new hash ring of the alertmanagers, nil if sharding is not configured
+func newHashRing(cfg ShardingConfig, members []string) *hashRing {
+	if cfg.Label == "" || len(members) == 0 {
+		return nil
+	}
+	vnodes := cfg.VirtualNodes
+	if vnodes <= 0 {
+		vnodes = defaultVirtualNodes
+	}
+
+	r := &hashRing{label: cfg.Label, owners: make(map[uint32]string, vnodes*len(members))}
+	for _, m := range members {
+		for i := 0; i < vnodes; i++ {
+			p := hashString(m + "#" + strconv.Itoa(i))
+			if _, found := r.owners[p]; found {
+				continue
+			}
+			r.owners[p] = m
+			r.points = append(r.points, p)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the alertmanager owning the label value
+func (r *hashRing) owner(value string) string {
+	h := hashString(value)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// selectFor returns the alerts owned by the alertmanager
+func (r *hashRing) selectFor(member string, alerts template.Alerts) template.Alerts {
+	if r == nil {
+		return alerts
+	}
+	selected := make(template.Alerts, 0, len(alerts))
+	for _, alt := range alerts {
+		if r.owner(alt.Labels[r.label]) == member {
+			selected = append(selected, alt)
+		}
+	}
+	return selected
+}
+
+func hashString(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,183 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// alertnames returns n alertnames, enough for every member of a small ring to own some
+func alertnames(n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		names = append(names, fmt.Sprintf("alert%d", i))
+	}
+	return names
+}
+
+func TestHashRing(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ShardingConfig
+		members []string
+		wantNil bool
+	}{
+		{name: "no label", cfg: ShardingConfig{}, members: []string{"a", "b"}, wantNil: true},
+		{name: "no member", cfg: ShardingConfig{Label: "alertname"}, wantNil: true},
+		{name: "single member", cfg: ShardingConfig{Label: "alertname"}, members: []string{"a"}},
+		{name: "default virtual nodes", cfg: ShardingConfig{Label: "alertname"}, members: []string{"a", "b", "c"}},
+		{name: "custom virtual nodes", cfg: ShardingConfig{Label: "alertname", VirtualNodes: 3}, members: []string{"a", "b"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newHashRing(tc.cfg, tc.members)
+			alerts := firing(alertnames(50)...)
+			if tc.wantNil {
+				if r != nil {
+					t.Fatalf("newHashRing() = %v, want nil", r)
+				}
+				if got := r.selectFor("a", alerts); len(got) != len(alerts) {
+					t.Errorf("nil ring selected %d alerts, want all %d", len(got), len(alerts))
+				}
+				return
+			}
+
+			// every alert is owned by exactly one member
+			var owned int
+			for _, m := range tc.members {
+				owned += len(r.selectFor(m, alerts))
+			}
+			if owned != len(alerts) {
+				t.Errorf("members own %d alerts, want %d", owned, len(alerts))
+			}
+			// the owner only depends on the members
+			again := newHashRing(tc.cfg, tc.members)
+			for _, alt := range alerts {
+				if r.owner(alt.Labels["alertname"]) != again.owner(alt.Labels["alertname"]) {
+					t.Errorf("owner of %s changed between identical rings", alt.Labels["alertname"])
+				}
+			}
+		})
+	}
+}
+
+func TestHashRingRemoveMember(t *testing.T) {
+	cfg := ShardingConfig{Label: "alertname"}
+	before := newHashRing(cfg, []string{"a", "b", "c"})
+	after := newHashRing(cfg, []string{"a", "b"})
+	for _, name := range alertnames(100) {
+		if owner := before.owner(name); owner != "c" && after.owner(name) != owner {
+			t.Errorf("alert %s moved from %s to %s although its owner wasn't removed", name, owner, after.owner(name))
+		}
+	}
+}
+
+func TestForwardSharding(t *testing.T) {
+	tests := []struct {
+		name          string
+		statusA       int
+		statusB       int
+		disableB      bool
+		secondary     bool
+		wantErr       bool
+		wantA         int // alerts received by a, -1 for some but not all
+		wantB         int
+		wantSecondary int
+	}{
+		{
+			name:    "each alert is sent to its owner",
+			statusA: http.StatusOK,
+			statusB: http.StatusOK,
+			wantA:   -1,
+			wantB:   -1,
+		},
+		{
+			name:    "owner failure fails the forward",
+			statusA: http.StatusOK,
+			statusB: http.StatusInternalServerError,
+			wantErr: true,
+			wantA:   -1,
+			wantB:   -1,
+		},
+		{
+			name:          "owner failure fails over the owned alerts",
+			statusA:       http.StatusOK,
+			statusB:       http.StatusInternalServerError,
+			secondary:     true,
+			wantA:         -1,
+			wantB:         -1,
+			wantSecondary: -1,
+		},
+		{
+			name:     "disabled member owns no alert",
+			statusA:  http.StatusOK,
+			statusB:  http.StatusOK,
+			disableB: true,
+			wantA:    20,
+			wantB:    0,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newTestAlertmanager(t, tc.statusA)
+			b := newTestAlertmanager(t, tc.statusB)
+			secondary := newTestAlertmanager(t, http.StatusOK)
+			config := `
+sharding:
+  label: alertname
+alertmanagers:
+- name: a
+  static_configs: [` + a.addr() + `]
+- name: b
+  static_configs: [` + b.addr() + `]
+`
+			if tc.secondary {
+				config += `- name: secondary
+  priority: 1
+  static_configs: [` + secondary.addr() + `]
+`
+			}
+			fwder := newTestForwarder(t, config)
+			if tc.disableB {
+				if err := fwder.SetAlertmanagerEnabled(1, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			alerts := firing(alertnames(20)...)
+			err := fwder.Forward(context.Background(), alerts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Forward() error = %v, want error %v", err, tc.wantErr)
+			}
+			checkReceived(t, "a", a.received(), tc.wantA, len(alerts))
+			checkReceived(t, "b", b.received(), tc.wantB, len(alerts))
+			checkReceived(t, "secondary", secondary.received(), tc.wantSecondary, len(alerts))
+			if tc.wantA == -1 && tc.wantB == -1 {
+				// the shards don't overlap
+				if got := len(a.received()) + len(b.received()); got != len(alerts) {
+					t.Errorf("a and b received %d alerts, want %d", got, len(alerts))
+				}
+			}
+			if tc.secondary && len(secondary.received()) != len(b.received()) {
+				t.Errorf("secondary received %d alerts, want the %d alerts of b", len(secondary.received()), len(b.received()))
+			}
+		})
+	}
+}
+
+// checkReceived checks the number of alerts received by the alertmanager, want -1 means some but not all
+func checkReceived(t *testing.T, name string, received []string, want, total int) {
+	t.Helper()
+	if want == -1 {
+		if len(received) == 0 || len(received) == total {
+			t.Errorf("%s received %d of the %d alerts, want some but not all", name, len(received), total)
+		}
+		return
+	}
+	if len(received) != want {
+		t.Errorf("%s received %d alerts, want %d", name, len(received), want)
+	}
+}
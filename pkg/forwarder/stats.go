@@ -0,0 +1,64 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"sync"
+)
+
+// Stats are the alert counts of a forwarder since they were last taken
+type Stats struct {
+	// Received is the number of alerts passed to Forward.
+	Received uint64
+	// Forwarded is the number of alerts sent to at least one upstream.
+	Forwarded uint64
+	// Dropped is the number of alerts dropped by filters before forwarding.
+	Dropped uint64
+	// Failed is the number of alerts that failed to be sent, keyed by alertmanager (its name, or the hosts
+	// of its endpoints if it has none) or receiver name.
+	Failed map[string]uint64
+}
+
+// statsCollector accumulates the alert counts of a forwarder
+type statsCollector struct {
+	mtx   sync.Mutex
+	stats Stats
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{stats: Stats{Failed: make(map[string]uint64)}}
+}
+
+func (sc *statsCollector) received(n int) {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	sc.stats.Received += uint64(n)
+}
+
+func (sc *statsCollector) forwarded(n int) {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	sc.stats.Forwarded += uint64(n)
+}
+
+func (sc *statsCollector) dropped(n int) {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	sc.stats.Dropped += uint64(n)
+}
+
+func (sc *statsCollector) failed(upstream string, n int) {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+	sc.stats.Failed[upstream] += uint64(n)
+}
+
+// take returns the accumulated counts and resets them
+func (sc *statsCollector) take() Stats {
+	sc.mtx.Lock()
+	defer sc.mtx.Unlock()
+
+	stats := sc.stats
+	sc.stats = Stats{Failed: make(map[string]uint64)}
+	return stats
+}
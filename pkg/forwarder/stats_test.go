@@ -0,0 +1,86 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestTakeStats(t *testing.T) {
+	ok := newTestAlertmanager(t, http.StatusOK)
+	failing := newTestAlertmanager(t, http.StatusInternalServerError)
+	fwder := newTestForwarder(t, `
+max_alertnames: 2
+alertmanagers:
+- static_configs: [`+ok.addr()+`]
+  scheme: http
+  api_version: v1
+- static_configs: [`+failing.addr()+`]
+  scheme: http
+  api_version: v1
+`)
+	if err := fwder.Forward(context.Background(), firing("a", "b", "dropped")); err != nil {
+		t.Fatalf("Forward() = %v", err)
+	}
+
+	stats := fwder.TakeStats()
+	if stats.Received != 3 || stats.Forwarded != 2 || stats.Dropped != 1 {
+		t.Errorf("received %d, forwarded %d and dropped %d alerts, want 3, 2 and 1", stats.Received, stats.Forwarded, stats.Dropped)
+	}
+	if len(stats.Failed) != 1 {
+		t.Errorf("failed alerts by upstream = %v, want the failing alertmanager only", stats.Failed)
+	}
+	for upstream, n := range stats.Failed {
+		if n != 2 {
+			t.Errorf("%d alerts failed for %s, want 2", n, upstream)
+		}
+	}
+
+	// the counts are reset once taken
+	if stats := fwder.TakeStats(); stats.Received != 0 || stats.Forwarded != 0 || len(stats.Failed) != 0 {
+		t.Errorf("stats = %+v after they were taken, want zero", stats)
+	}
+}
+
+// failingEncoder fails to encode any batch
+type failingEncoder struct{}
+
+func (failingEncoder) Encode(template.Alerts) ([]byte, error) {
+	return nil, errors.New("encoding failed")
+}
+
+func (failingEncoder) ContentType() string {
+	return "text/plain"
+}
+
+func TestTakeStatsFailedKey(t *testing.T) {
+	failing := newTestAlertmanager(t, http.StatusInternalServerError)
+	ok := newTestAlertmanager(t, http.StatusOK)
+	fwder, err := NewForwarderWithOptions(log.NewNopLogger(), writeFile(t, "alertmanagers.yaml", `
+alertmanagers:
+- name: failing
+  static_configs: [`+failing.addr()+`]
+- name: unencodable
+  static_configs: [`+ok.addr()+`]
+- static_configs: [`+failing.addr()+`]
+  path_prefix: /unnamed
+`), Options{Encoders: map[string]Encoder{"unencodable": failingEncoder{}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fwder.Stop()
+	_ = fwder.Forward(context.Background(), firing("a"))
+
+	// the failures are keyed by alertmanager whether the endpoint or the encoding failed
+	want := map[string]uint64{"failing": 1, "unencodable": 1, failing.addr(): 1}
+	if got := fwder.TakeStats().Failed; !reflect.DeepEqual(got, want) {
+		t.Errorf("failed alerts by upstream = %v, want %v", got, want)
+	}
+}
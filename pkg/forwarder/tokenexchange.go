@@ -0,0 +1,157 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	tokenExchangeGrantType  = "urn:ietf:params:oauth:grant-type:token-exchange"
+	defaultSubjectTokenType = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchangeConfig configures exchanging a local token, e.g. a projected service account token,
+// for the token attached to the requests with an OAuth 2.0 token exchange (RFC 8693), e.g. to reach
+// alertmanagers behind an SSO proxy.
+type TokenExchangeConfig struct {
+	TokenURL string `yaml:"token_url"`
+	// File containing the subject token, read for every exchange so rotated tokens are picked up.
+	SubjectTokenFile string `yaml:"subject_token_file"`
+	// Type of the subject token, defaults to urn:ietf:params:oauth:token-type:jwt.
+	SubjectTokenType   string   `yaml:"subject_token_type"`
+	RequestedTokenType string   `yaml:"requested_token_type"`
+	Audience           string   `yaml:"audience"`
+	Scopes             []string `yaml:"scopes"`
+	// Client credentials to authenticate to the token endpoint, optional.
+	ClientID         string `yaml:"client_id"`
+	ClientSecret     string `yaml:"client_secret"`
+	ClientSecretFile string `yaml:"client_secret_file"`
+	// Field of the token response attached to the requests, access_token (default) or id_token.
+	TokenField string `yaml:"token_field"`
+}
+
+// tokenExchangeSource is an oauth2.TokenSource performing a token exchange for every token
+type tokenExchangeSource struct {
+	cfg    TokenExchangeConfig
+	secret string
+	client *http.Client
+}
+
+// tokenSource returns the token source exchanging the tokens with the base round tripper,
+// the tokens are reused until they expire
+func (c *TokenExchangeConfig) tokenSource(base http.RoundTripper) (oauth2.TokenSource, error) {
+	if c.TokenURL == "" || c.SubjectTokenFile == "" {
+		return nil, fmt.Errorf("token_exchange requires token_url and subject_token_file")
+	}
+	switch c.TokenField {
+	case "", "access_token", "id_token":
+	default:
+		return nil, fmt.Errorf("token_exchange token_field must be access_token or id_token, got %q", c.TokenField)
+	}
+	secret := c.ClientSecret
+	if c.ClientSecretFile != "" {
+		if secret != "" {
+			return nil, fmt.Errorf("at most one of token_exchange client_secret and client_secret_file must be configured")
+		}
+		b, err := ioutil.ReadFile(c.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token_exchange client secret file %s: %v", c.ClientSecretFile, err)
+		}
+		secret = strings.TrimSpace(string(b))
+	}
+	src := &tokenExchangeSource{
+		cfg:    *c,
+		secret: secret,
+		client: &http.Client{Transport: base},
+	}
+	return oauth2.ReuseTokenSource(nil, src), nil
+}
+
+// tokenExchangeResponse is the response of the token endpoint
+type tokenExchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Token implements oauth2.TokenSource
+func (s *tokenExchangeSource) Token() (*oauth2.Token, error) {
+	subject, err := ioutil.ReadFile(s.cfg.SubjectTokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subject token file %s: %v", s.cfg.SubjectTokenFile, err)
+	}
+	subjectType := s.cfg.SubjectTokenType
+	if subjectType == "" {
+		subjectType = defaultSubjectTokenType
+	}
+	form := url.Values{
+		"grant_type":         {tokenExchangeGrantType},
+		"subject_token":      {strings.TrimSpace(string(subject))},
+		"subject_token_type": {subjectType},
+	}
+	if s.cfg.RequestedTokenType != "" {
+		form.Set("requested_token_type", s.cfg.RequestedTokenType)
+	}
+	if s.cfg.Audience != "" {
+		form.Set("audience", s.cfg.Audience)
+	}
+	if len(s.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.cfg.Scopes, " "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), defaultTimeout)
+	defer cancel()
+	req, err := http.NewRequest("POST", s.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if s.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.ClientID), url.QueryEscape(s.secret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token exchange failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("token exchange failed: %v", responseError(resp, s.cfg.TokenURL))
+	}
+	var tr tokenExchangeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("failed to decode token exchange response: %v", err)
+	}
+
+	tok := &oauth2.Token{AccessToken: tr.AccessToken, TokenType: "Bearer"}
+	if s.cfg.TokenField == "id_token" {
+		tok.AccessToken = tr.IDToken
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("token exchange response has no %s", tokenField(s.cfg.TokenField))
+	}
+	if tr.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+// tokenField returns the name of the token field, access_token if it isn't set
+func tokenField(field string) string {
+	if field == "" {
+		return "access_token"
+	}
+	return field
+}
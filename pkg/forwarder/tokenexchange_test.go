@@ -0,0 +1,145 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// newTestTokenEndpoint returns a started token endpoint answering with the response and recording the forms
+func newTestTokenEndpoint(t *testing.T, status int, response tokenExchangeResponse) (*httptest.Server, func() []url.Values) {
+	t.Helper()
+	var (
+		mtx   sync.Mutex
+		forms []url.Values
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse the form: %v", err)
+		}
+		form := r.PostForm
+		if id, secret, ok := r.BasicAuth(); ok {
+			form.Set("basic_auth", id+":"+secret)
+		}
+		mtx.Lock()
+		forms = append(forms, form)
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(s.Close)
+	return s, func() []url.Values {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return append([]url.Values(nil), forms...)
+	}
+}
+
+func TestTokenExchange(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       TokenExchangeConfig
+		status    int
+		response  tokenExchangeResponse
+		wantToken string
+		wantForm  map[string]string
+		wantErr   bool
+	}{
+		{
+			name:      "access token",
+			status:    http.StatusOK,
+			response:  tokenExchangeResponse{AccessToken: "access", ExpiresIn: 3600},
+			wantToken: "access",
+			wantForm: map[string]string{
+				"grant_type":         tokenExchangeGrantType,
+				"subject_token":      "subject",
+				"subject_token_type": defaultSubjectTokenType,
+			},
+		},
+		{
+			name:      "id token with audience, scopes and client credentials",
+			cfg:       TokenExchangeConfig{TokenField: "id_token", Audience: "alertmanager", Scopes: []string{"openid", "alerts"}, ClientID: "collector", ClientSecret: "secret"},
+			status:    http.StatusOK,
+			response:  tokenExchangeResponse{AccessToken: "access", IDToken: "id"},
+			wantToken: "id",
+			wantForm: map[string]string{
+				"audience":   "alertmanager",
+				"scope":      "openid alerts",
+				"basic_auth": "collector:secret",
+			},
+		},
+		{
+			name:     "missing token",
+			cfg:      TokenExchangeConfig{TokenField: "id_token"},
+			status:   http.StatusOK,
+			response: tokenExchangeResponse{AccessToken: "access"},
+			wantErr:  true,
+		},
+		{
+			name:    "rejected",
+			status:  http.StatusUnauthorized,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, forms := newTestTokenEndpoint(t, tc.status, tc.response)
+			tc.cfg.TokenURL = s.URL
+			tc.cfg.SubjectTokenFile = writeFile(t, "token", "subject\n")
+			src, err := tc.cfg.tokenSource(http.DefaultTransport)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tok, err := src.Token()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Token() error = %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if tok.AccessToken != tc.wantToken {
+				t.Errorf("token = %q, want %q", tok.AccessToken, tc.wantToken)
+			}
+			for k, want := range tc.wantForm {
+				if got := forms()[0].Get(k); got != want {
+					t.Errorf("form %s = %q, want %q", k, got, want)
+				}
+			}
+
+			// the token is reused until it expires
+			if _, err := src.Token(); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(forms()); got != 1 {
+				t.Errorf("%d token exchanges, want 1", got)
+			}
+		})
+	}
+}
+
+func TestTokenExchangeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  TokenExchangeConfig
+	}{
+		{name: "missing token url", cfg: TokenExchangeConfig{SubjectTokenFile: "token"}},
+		{name: "missing subject token file", cfg: TokenExchangeConfig{TokenURL: "http://localhost"}},
+		{name: "invalid token field", cfg: TokenExchangeConfig{TokenURL: "http://localhost", SubjectTokenFile: "token", TokenField: "refresh_token"}},
+		{name: "both client secrets", cfg: TokenExchangeConfig{TokenURL: "http://localhost", SubjectTokenFile: "token", ClientSecret: "a", ClientSecretFile: "b"}},
+		{name: "missing client secret file", cfg: TokenExchangeConfig{TokenURL: "http://localhost", SubjectTokenFile: "token", ClientSecretFile: "/nonexistent/secret"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.cfg.tokenSource(http.DefaultTransport); err == nil {
+				t.Error("tokenSource() succeeded, want error")
+			}
+		})
+	}
+}
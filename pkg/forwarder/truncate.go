@@ -0,0 +1,49 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"unicode/utf8"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// truncationEllipsis ends the truncated annotations
+const truncationEllipsis = "..."
+
+// truncateAnnotations truncates the annotation values longer than max characters, including the ellipsis
+// ending them, so the upstreams don't reject the alerts. 0 means no limit.
+func truncateAnnotations(alerts template.Alerts, max int) template.Alerts {
+	if max <= 0 {
+		return alerts
+	}
+	for i, alt := range alerts {
+		var annotations template.KV
+		for k, v := range alt.Annotations {
+			if utf8.RuneCountInString(v) <= max {
+				continue
+			}
+			if annotations == nil {
+				// copy the annotations, they may be shared with the other alerts of the batch
+				annotations = make(template.KV, len(alt.Annotations))
+				for k, v := range alt.Annotations {
+					annotations[k] = v
+				}
+			}
+			annotations[k] = truncate(v, max)
+		}
+		if annotations != nil {
+			alerts[i].Annotations = annotations
+		}
+	}
+	return alerts
+}
+
+// truncate returns the first max characters of the value with the last ones replaced by the ellipsis
+func truncate(v string, max int) string {
+	keep := max - len(truncationEllipsis)
+	if keep <= 0 {
+		return string([]rune(v)[:max])
+	}
+	return string([]rune(v)[:keep]) + truncationEllipsis
+}
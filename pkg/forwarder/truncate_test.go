@@ -0,0 +1,39 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+func TestTruncateAnnotations(t *testing.T) {
+	tests := []struct {
+		name  string
+		max   int
+		value string
+		want  string
+	}{
+		{name: "no limit", value: "a long description", want: "a long description"},
+		{name: "within the limit", max: 18, value: "a long description", want: "a long description"},
+		{name: "truncated", max: 10, value: "a long description", want: "a long ..."},
+		{name: "shorter than the ellipsis", max: 2, value: "a long description", want: "a "},
+		{name: "multi-byte characters", max: 5, value: "ééééééé", want: "éé..."},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			shared := template.KV{"description": tc.value, "summary": "ok"}
+			alerts := truncateAnnotations(template.Alerts{{Annotations: shared}}, tc.max)
+			if got := alerts[0].Annotations["description"]; got != tc.want {
+				t.Errorf("description = %q, want %q", got, tc.want)
+			}
+			if alerts[0].Annotations["summary"] != "ok" {
+				t.Errorf("summary = %q, want it unchanged", alerts[0].Annotations["summary"])
+			}
+			if shared["description"] != tc.value {
+				t.Error("the annotations shared with the sender were modified")
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// watchFile calls reload on changes to the file until the returned watcher is closed
+func watchFile(l log.Logger, file string, reload func() error) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher for file %s: %v", file, err)
+	}
+	// watch the directory to get notified when a mounted configmap swaps the file
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch file %s: %v", file, err)
+	}
+
+	go func() {
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				if err := reload(); err != nil {
+					level.Error(l).Log("msg", "failed to reload file, keeping the previous configuration", "file", file, "err", err)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				level.Warn(l).Log("msg", "watching file failed", "file", file, "err", err)
+			}
+		}
+	}()
+	return watcher, nil
+}
@@ -0,0 +1,46 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+func TestWatchFile(t *testing.T) {
+	file := writeFile(t, "watched.yaml", "a")
+	reloads := make(chan struct{}, 10)
+	watcher, err := watchFile(log.NewNopLogger(), file, func() error {
+		reloads <- struct{}{}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	// a mounted configmap swaps the file with a rename
+	tmp := filepath.Join(filepath.Dir(file), "..data_tmp")
+	if err := ioutil.WriteFile(tmp, []byte("b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("file not reloaded after it changed")
+	}
+}
+
+func TestWatchFileMissingDirectory(t *testing.T) {
+	if _, err := watchFile(log.NewNopLogger(), "/nonexistent/watched.yaml", func() error { return nil }); err == nil {
+		t.Error("watchFile() succeeded in a missing directory, want error")
+	}
+}
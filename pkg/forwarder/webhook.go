@@ -0,0 +1,196 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/common/model"
+)
+
+// WebhookConfig configures a receiver posting alerts rendered with a Go text/template to a generic webhook,
+// e.g. Slack or Microsoft Teams incoming webhooks.
+type WebhookConfig struct {
+	HTTPClientConfig ClientConfig   `yaml:"http_config"`
+	Timeout          model.Duration `yaml:"timeout"`
+	// URL of the webhook.
+	URL string `yaml:"url"`
+	// Template rendering the request body. It is executed with the alertmanager template.Data of the batch,
+	// or with the template.Alert if PerAlert is set. The functions of TemplateFuncs are available.
+	Template string `yaml:"template"`
+	// Post one request per alert instead of one per batch.
+	PerAlert bool `yaml:"per_alert"`
+	// Content type of the request body, defaults to application/json.
+	ContentType string `yaml:"content_type"`
+	// Custom HTTP headers added to the requests.
+	Headers map[string]string `yaml:"headers"`
+	// Shared secret to sign the request bodies with HMAC-SHA256, the requests aren't signed if it is empty.
+	HMACSecret string `yaml:"hmac_secret"`
+	// Header carrying the signature as sha256=<hex digest>, defaults to X-Hub-Signature-256.
+	SignatureHeader string `yaml:"signature_header"`
+}
+
+// defaultSignatureHeader is the header of the body signature, like the one of GitHub webhooks
+const defaultSignatureHeader = "X-Hub-Signature-256"
+
+// WebhookReceiver is a receiver that posts alerts rendered with a template to a generic webhook
+type WebhookReceiver struct {
+	logger   log.Logger
+	name     string
+	client   *http.Client
+	url      string
+	timeout  time.Duration
+	tmpl     *texttemplate.Template
+	perAlert bool
+	header   http.Header
+
+	hmacSecret      []byte
+	signatureHeader string
+}
+
+// newWebhookReceiver construct new webhook receiver
+func newWebhookReceiver(l log.Logger, name string, cfg WebhookConfig) (*WebhookReceiver, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("missing url for webhook receiver %q", name)
+	}
+	tmpl, err := texttemplate.New(name).Option("missingkey=zero").Funcs(TemplateFuncs).Parse(cfg.Template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template of webhook receiver %q: %v", name, err)
+	}
+	client, err := createHTTPClient(cfg.HTTPClientConfig, "alerts-collector")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client for webhook receiver %q: %v", name, err)
+	}
+
+	header := make(http.Header)
+	for k, v := range cfg.Headers {
+		header.Set(k, v)
+	}
+	contentType := cfg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	header.Set("Content-Type", contentType)
+	signatureHeader := cfg.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = defaultSignatureHeader
+	}
+
+	return &WebhookReceiver{
+		logger:   l,
+		name:     name,
+		client:   client,
+		url:      cfg.URL,
+		timeout:  time.Duration(cfg.Timeout),
+		tmpl:     tmpl,
+		perAlert: cfg.PerAlert,
+		header:   header,
+
+		hmacSecret:      []byte(cfg.HMACSecret),
+		signatureHeader: signatureHeader,
+	}, nil
+}
+
+// Name returns the name of the receiver
+func (wr *WebhookReceiver) Name() string {
+	return wr.name
+}
+
+// Send renders the template for the batch, or for each alert, and posts the result to the webhook
+func (wr *WebhookReceiver) Send(ctx context.Context, alerts template.Alerts) error {
+	if !wr.perAlert {
+		body, err := wr.render(batchData(alerts))
+		if err != nil {
+			return err
+		}
+		return post(ctx, wr.client, wr.url, wr.timeout, wr.sign(body), body)
+	}
+
+	var failed int
+	for _, alt := range alerts {
+		body, err := wr.render(alt)
+		if err == nil {
+			err = post(ctx, wr.client, wr.url, wr.timeout, wr.sign(body), body)
+		}
+		if err != nil {
+			level.Warn(wr.logger).Log("msg", "sending alert to webhook failed", "receiver", wr.name, "err", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d of %d alerts to webhook receiver %q", failed, len(alerts), wr.name)
+	}
+	return nil
+}
+
+// sign returns the request headers with the HMAC-SHA256 signature of the body if a secret is configured
+func (wr *WebhookReceiver) sign(body []byte) http.Header {
+	if len(wr.hmacSecret) == 0 {
+		return wr.header
+	}
+	mac := hmac.New(sha256.New, wr.hmacSecret)
+	mac.Write(body)
+	header := wr.header.Clone()
+	header.Set(wr.signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+// render executes the template with the data
+func (wr *WebhookReceiver) render(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := wr.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template of webhook receiver %q: %v", wr.name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// batchData returns the template data for the alert batch, like the data alertmanager passes to its templates
+func batchData(alerts template.Alerts) *template.Data {
+	data := &template.Data{
+		Status:            string(model.AlertResolved),
+		Alerts:            alerts,
+		GroupLabels:       template.KV{},
+		CommonLabels:      template.KV{},
+		CommonAnnotations: template.KV{},
+	}
+	if len(alerts.Firing()) > 0 {
+		data.Status = string(model.AlertFiring)
+	}
+	if len(alerts) == 0 {
+		return data
+	}
+
+	for k, v := range alerts[0].Labels {
+		data.CommonLabels[k] = v
+	}
+	for k, v := range alerts[0].Annotations {
+		data.CommonAnnotations[k] = v
+	}
+	for _, alt := range alerts[1:] {
+		for k, v := range data.CommonLabels {
+			if alt.Labels[k] != v {
+				delete(data.CommonLabels, k)
+			}
+		}
+		for k, v := range data.CommonAnnotations {
+			if alt.Annotations[k] != v {
+				delete(data.CommonAnnotations, k)
+			}
+		}
+	}
+	if name, found := data.CommonLabels[model.AlertNameLabel]; found {
+		data.GroupLabels[model.AlertNameLabel] = name
+	}
+	return data
+}
@@ -0,0 +1,162 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package forwarder
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/common/model"
+)
+
+// webhookRequest is a request received by a test webhook
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+// newTestWebhook returns a started webhook recording the requests and answering with the status
+func newTestWebhook(t *testing.T, status int) (*httptest.Server, func() []webhookRequest) {
+	t.Helper()
+	var (
+		mtx  sync.Mutex
+		reqs []webhookRequest
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read the request body: %v", err)
+		}
+		mtx.Lock()
+		reqs = append(reqs, webhookRequest{header: r.Header, body: string(body)})
+		mtx.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s, func() []webhookRequest {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return append([]webhookRequest(nil), reqs...)
+	}
+}
+
+// expectedSignature returns the expected HMAC-SHA256 signature of the body
+func expectedSignature(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookReceiver(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           WebhookConfig
+		status        int
+		wantErr       bool
+		wantBodies    []string
+		wantSignature string // header carrying the signature, empty if unsigned
+		secret        string
+	}{
+		{
+			name:       "batch",
+			cfg:        WebhookConfig{Template: `{"status":"{{ .Status }}","alertname":"{{ .GroupLabels.alertname }}"}`},
+			status:     http.StatusOK,
+			wantBodies: []string{`{"status":"firing","alertname":"a"}`},
+		},
+		{
+			name:       "per alert",
+			cfg:        WebhookConfig{Template: `{{ .Labels.alertname }}`, PerAlert: true},
+			status:     http.StatusOK,
+			wantBodies: []string{"a", "a"},
+		},
+		{
+			name:          "signed",
+			cfg:           WebhookConfig{Template: `{{ .Status }}`, HMACSecret: "s3cr3t"},
+			status:        http.StatusOK,
+			wantBodies:    []string{"firing"},
+			wantSignature: defaultSignatureHeader,
+			secret:        "s3cr3t",
+		},
+		{
+			name:          "signed per alert with a custom header",
+			cfg:           WebhookConfig{Template: `{{ .Labels.alertname }}`, PerAlert: true, HMACSecret: "s3cr3t", SignatureHeader: "X-Signature"},
+			status:        http.StatusOK,
+			wantBodies:    []string{"a", "a"},
+			wantSignature: "X-Signature",
+			secret:        "s3cr3t",
+		},
+		{
+			name:       "failing webhook",
+			cfg:        WebhookConfig{Template: `{{ .Status }}`},
+			status:     http.StatusInternalServerError,
+			wantErr:    true,
+			wantBodies: []string{"firing"},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s, requests := newTestWebhook(t, tc.status)
+			tc.cfg.URL = s.URL
+			wr, err := newWebhookReceiver(log.NewNopLogger(), "test", tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// the forwarder derives the status before sending to the receivers
+			alerts := firing("a", "a")
+			for i := range alerts {
+				alerts[i].Status = string(model.AlertFiring)
+			}
+			err = wr.Send(context.Background(), alerts)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Send() error = %v, want error %v", err, tc.wantErr)
+			}
+			reqs := requests()
+			if len(reqs) != len(tc.wantBodies) {
+				t.Fatalf("webhook received %d requests, want %d", len(reqs), len(tc.wantBodies))
+			}
+			for i, req := range reqs {
+				if req.body != tc.wantBodies[i] {
+					t.Errorf("request #%d body = %q, want %q", i+1, req.body, tc.wantBodies[i])
+				}
+				if ct := req.header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("request #%d Content-Type = %q, want application/json", i+1, ct)
+				}
+				if tc.wantSignature == "" {
+					if sig := req.header.Get(defaultSignatureHeader); sig != "" {
+						t.Errorf("request #%d is signed with %q, want unsigned", i+1, sig)
+					}
+					continue
+				}
+				if sig, want := req.header.Get(tc.wantSignature), expectedSignature(tc.secret, req.body); sig != want {
+					t.Errorf("request #%d %s = %q, want %q", i+1, tc.wantSignature, sig, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewWebhookReceiver(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  WebhookConfig
+	}{
+		{name: "missing url", cfg: WebhookConfig{Template: "{{ .Status }}"}},
+		{name: "invalid template", cfg: WebhookConfig{URL: "http://localhost", Template: "{{ .Status"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := newWebhookReceiver(log.NewNopLogger(), "test", tc.cfg); err == nil {
+				t.Error("newWebhookReceiver() succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/version"
+)
+
+// TracerName is the name of the tracer used by the alerts collector
+const TracerName = "github.com/open-cluster-management/alerts-collector"
+
+// Setup installs a global tracer provider exporting spans with OTLP over HTTP.
+// The exporter is configured by the standard OTEL_EXPORTER_OTLP_* environment variables.
+// The returned function flushes the remaining spans and shuts the tracer provider down.
+func Setup(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String("alerts-collector"),
+			semconv.ServiceVersionKey.String(version.Version),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer of the alerts collector, a no-op tracer if tracing is not set up
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
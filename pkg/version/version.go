@@ -2,6 +2,13 @@
 
 package version
 
+// Version is the version of the alerts collector, set at build time with
+// -ldflags "-X github.com/open-cluster-management/alerts-collector/pkg/version.Version=<version>"
 var (
 	Version = "0.0.1"
 )
+
+// UserAgent returns the User-Agent of the requests sent by the alerts collector
+func UserAgent() string {
+	return "alerts-collector/" + Version
+}
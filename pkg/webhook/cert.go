@@ -0,0 +1,134 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// certPollInterval is the interval the key pair is loaded at while waiting for it
+const certPollInterval = time.Second
+
+// getCertificateFunc returns the tls.Config GetCertificate callback of the webhook server. The key pair is
+// reloaded from disk once the files change, waiting for the files to appear if a wait timeout is set and
+// falling back to a self-signed certificate if enabled.
+func getCertificateFunc(l log.Logger, opts *Options) (func(*tls.ClientHelloInfo) (*tls.Certificate, error), error) {
+	kp := &keyPairReloader{logger: l, certFile: opts.CertFile, keyFile: opts.KeyFile}
+	err := kp.reload()
+	if err != nil && opts.CertWaitTimeout > 0 {
+		level.Info(l).Log("msg", "waiting for the key pair", "cert", opts.CertFile, "key", opts.KeyFile, "timeout", opts.CertWaitTimeout)
+		deadline := time.Now().Add(opts.CertWaitTimeout)
+		for err != nil && time.Now().Before(deadline) {
+			time.Sleep(certPollInterval)
+			err = kp.reload()
+		}
+	}
+	if err == nil {
+		return kp.getCertificate, nil
+	}
+	if !opts.SelfSignedFallback {
+		return nil, fmt.Errorf("failed to load key pair: %v", err)
+	}
+
+	level.Warn(l).Log("msg", "INSECURE: failed to load key pair, serving a self-signed certificate, for development and testing only", "err", err)
+	pair, err := selfSignedKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return func(*tls.ClientHelloInfo) (*tls.Certificate, error) { return &pair, nil }, nil
+}
+
+// keyPairReloader serves the key pair from disk, reloading it once the modification time of the files changes
+type keyPairReloader struct {
+	logger   log.Logger
+	certFile string
+	keyFile  string
+
+	mtx     sync.Mutex
+	pair    *tls.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// reload loads the key pair if the files changed since the last load, the current key pair is kept on error
+func (kp *keyPairReloader) reload() error {
+	certInfo, err := os.Stat(kp.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(kp.keyFile)
+	if err != nil {
+		return err
+	}
+
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+
+	if kp.pair != nil && certInfo.ModTime().Equal(kp.certMod) && keyInfo.ModTime().Equal(kp.keyMod) {
+		return nil
+	}
+	pair, err := tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+	if err != nil {
+		return err
+	}
+	if kp.pair != nil {
+		level.Info(kp.logger).Log("msg", "reloaded the key pair", "cert", kp.certFile, "key", kp.keyFile)
+	}
+	kp.pair = &pair
+	kp.certMod = certInfo.ModTime()
+	kp.keyMod = keyInfo.ModTime()
+	return nil
+}
+
+// getCertificate returns the current key pair, reloaded if the files changed
+func (kp *keyPairReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if err := kp.reload(); err != nil {
+		level.Warn(kp.logger).Log("msg", "failed to reload the key pair, serving the previous one", "err", err)
+	}
+
+	kp.mtx.Lock()
+	defer kp.mtx.Unlock()
+	return kp.pair, nil
+}
+
+// selfSignedKeyPair generates a self-signed certificate for localhost valid for a year
+func selfSignedKeyPair() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate private key: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "alerts-collector"},
+		DNSNames:              []string{"localhost", "alerts-collector"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create self-signed certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
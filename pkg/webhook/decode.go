@@ -0,0 +1,99 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/template"
+)
+
+// decodeWebhookLenient decodes the alerts of an alertmanager webhook payload, keeping the alerts decoded
+// before a syntax error and skipping the alerts that can't be decoded, it only fails if no alert was decoded
+func (wh *Webhook) decodeWebhookLenient(r io.Reader) (template.Alerts, error) {
+	dec := json.NewDecoder(r)
+	alerts, skipped, err := decodeAlertsField(dec)
+	if err != nil && (len(alerts) == 0 || isBodyTooLarge(err)) {
+		return nil, err
+	}
+	if err != nil || skipped > 0 {
+		level.Warn(wh.logger).Log("msg", "webhook payload is partially invalid, forwarding the decoded alerts", "numAlerts", len(alerts), "skipped", skipped, "err", err)
+	}
+	return alerts, nil
+}
+
+// decodeAlertsField decodes the alerts field of the payload object element by element,
+// it returns the alerts decoded until the first syntax error and the number of skipped alerts
+func decodeAlertsField(dec *json.Decoder) (template.Alerts, int, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, 0, err
+	}
+	var (
+		alerts  template.Alerts
+		skipped int
+	)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return alerts, skipped, err
+		}
+		if key, _ := tok.(string); key != "alerts" {
+			var ignored json.RawMessage
+			if err := dec.Decode(&ignored); err != nil {
+				return alerts, skipped, err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return alerts, skipped, err
+		}
+		for dec.More() {
+			var alt template.Alert
+			if err := dec.Decode(&alt); err != nil {
+				if !isValueError(err) {
+					return alerts, skipped, err
+				}
+				// the invalid alert has been consumed, continue with the next one
+				skipped++
+				continue
+			}
+			alerts = append(alerts, alt)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return alerts, skipped, err
+		}
+	}
+	return alerts, skipped, expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token and fails if it isn't the delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("invalid payload: expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+// isValueError reports whether the error is about the content of a well-formed JSON value,
+// the decoder can continue after such errors
+func isValueError(err error) bool {
+	switch err.(type) {
+	case *json.SyntaxError:
+		return false
+	}
+	return err != io.EOF && err != io.ErrUnexpectedEOF && !isBodyTooLarge(err)
+}
+
+// isBodyTooLarge reports whether the error is caused by exceeding the request body limit,
+// http.MaxBytesReader doesn't expose a typed error
+func isBodyTooLarge(err error) bool {
+	return err.Error() == "http: request body too large"
+}
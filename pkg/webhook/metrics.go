@@ -0,0 +1,35 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package webhook
+
+import (
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var alertAge = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Name:    "alerts_collector_alert_age_seconds",
+	Help:    "Time from the start of the received alerts until they were received.",
+	Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 3 * 3600, 12 * 3600, 24 * 3600},
+})
+
+func init() {
+	prometheus.MustRegister(alertAge)
+}
+
+// observeAlertAge records the age of the alerts at now, alerts without StartsAt are skipped
+// and the ones starting in the future, e.g. because of clock skew, are clamped to 0
+func observeAlertAge(alerts template.Alerts, now time.Time) {
+	for _, alt := range alerts {
+		if alt.StartsAt.IsZero() {
+			continue
+		}
+		age := now.Sub(alt.StartsAt)
+		if age < 0 {
+			age = 0
+		}
+		alertAge.Observe(age.Seconds())
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// alertAgeSamples returns the number and the sum of the observed alert ages
+func alertAgeSamples(t *testing.T) (uint64, float64) {
+	t.Helper()
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(alertAge)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mfs) != 1 || len(mfs[0].GetMetric()) != 1 {
+		t.Fatalf("gathered %v, want the alert age histogram", mfs)
+	}
+	h := mfs[0].GetMetric()[0].GetHistogram()
+	return h.GetSampleCount(), h.GetSampleSum()
+}
+
+func TestObserveAlertAge(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 1, 0, 0, time.UTC)
+	count, sum := alertAgeSamples(t)
+	observeAlertAge(template.Alerts{
+		{StartsAt: now.Add(-10 * time.Second)},
+		{StartsAt: now.Add(time.Minute)}, // clock skew, clamped to 0
+		{},                               // no StartsAt, skipped
+	}, now)
+
+	gotCount, gotSum := alertAgeSamples(t)
+	if gotCount-count != 2 || gotSum-sum != 10 {
+		t.Errorf("observed %d alert ages summing to %gs, want 2 summing to 10s", gotCount-count, gotSum-sum)
+	}
+}
+
+func TestServeAlertAge(t *testing.T) {
+	wh := newTestWebhook(t, Options{Forwarder: newTestForwarder(t, newTestUpstream(t, http.StatusOK))})
+	count, _ := alertAgeSamples(t)
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, DefaultWebhookPath, strings.NewReader(webhookPayload))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		wh.Serve(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+	if got, _ := alertAgeSamples(t); got-count != 2 {
+		t.Errorf("observed %d alert ages for 2 received alerts, want 2", got-count)
+	}
+}
@@ -0,0 +1,29 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package webhook
+
+import (
+	"go.uber.org/atomic"
+)
+
+// sampler samples 1 in every rate events, e.g. to limit the per-alert debug log during alert storms
+type sampler struct {
+	rate  uint64
+	count atomic.Uint64
+}
+
+// newSampler returns a sampler keeping 1 in every rate events, nil keeps all of them
+func newSampler(rate int) *sampler {
+	if rate <= 1 {
+		return nil
+	}
+	return &sampler{rate: uint64(rate)}
+}
+
+// sample reports whether the next event is kept
+func (s *sampler) sample() bool {
+	if s == nil {
+		return true
+	}
+	return (s.count.Inc()-1)%s.rate == 0
+}
@@ -5,114 +5,655 @@ package webhook
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/alertmanager/api/v2/models"
 	"github.com/prometheus/alertmanager/template"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/atomic"
 
 	"github.com/open-cluster-management/alerts-collector/pkg/forwarder"
+	"github.com/open-cluster-management/alerts-collector/pkg/tracing"
 )
 
 // webhook server options
 type Options struct {
-	Port      int                  // webhook server port
-	CertFile  string               // path to the x509 certificate for https
-	KeyFile   string               // path to the x509 private key matching `CertFile`
-	Logger    log.Logger           // logger for the webhook server
-	Forwarder *forwarder.Forwarder // alert forwarder for the the webhook server
+	Port     int    // webhook server port
+	CertFile string // path to the x509 certificate for https
+	KeyFile  string // path to the x509 private key matching `CertFile`
+	ClientCA string // path to the CA bundle to verify client certificates, optional
+
+	CertWaitTimeout    time.Duration        // time to wait for the key pair files to appear, 0 fails immediately
+	SelfSignedFallback bool                 // serve a self-signed certificate if the key pair can't be loaded, insecure
+	Logger             log.Logger           // logger for the webhook server
+	Forwarder          *forwarder.Forwarder // alert forwarder for the the webhook server
+
+	// Reload builds a forwarder from the reloaded configuration, used by /-/reload, nil disables the endpoint.
+	// The endpoint requires a verified client certificate if ClientCA is set, otherwise it only serves loopback clients.
+	Reload func() (*forwarder.Forwarder, error)
+
+	SummaryInterval time.Duration // interval of the alert summary log, 0 disables it
+	MaxRequestBytes int64         // maximum size of the webhook request body, 0 means no limit
+	LenientDecode   bool          // forward the valid alerts of partially invalid webhook payloads instead of rejecting them
+	DebugEcho       bool          // serve /debug/echo to clients with a verified certificate, requires ClientCA
+	AdminAPI        bool          // serve /admin/ to clients with a verified certificate, requires ClientCA
+	RedactPayloads  bool          // log only the counts and fingerprints of the alerts, not their labels and annotations
+	LogSampleRate   int           // log 1 in every LogSampleRate received alerts at debug level, 0 or 1 logs all of them
+	OnForwardError  string        // response to alerts that failed to be forwarded, retry (500, default) or accept (200)
+	AnyContentType  bool          // decode the alerts regardless of the Content-Type instead of requiring application/json
+
+	ReadHeaderTimeout time.Duration // maximum duration to read the request headers, 0 means no timeout
+	ReadTimeout       time.Duration // maximum duration to read the entire request, 0 means no timeout
+	WriteTimeout      time.Duration // maximum duration before timing out writes of the response, 0 means no timeout
+	IdleTimeout       time.Duration // maximum time to wait for the next request on a keep-alive connection
+	DisableHTTP2      bool          // serve HTTP/1.1 only
+	ShutdownDelay     time.Duration // time to answer 503 and report not ready on shutdown before closing the listener
+
+	WebhookPath string // path of the webhook, routing groups are served below it, defaults to /webhook
+	HealthzPath string // path of the liveness endpoint, defaults to /healthz
+	ReadyzPath  string // path of the readiness endpoint, defaults to /readyz
+	MetricsPath string // path of the metrics endpoint, defaults to /metrics
 }
 
+// default paths of the webhook server endpoints
+const (
+	DefaultWebhookPath = "/webhook"
+	DefaultHealthzPath = "/healthz"
+	DefaultReadyzPath  = "/readyz"
+	DefaultMetricsPath = "/metrics"
+)
+
+// responses to the alerts that failed to be forwarded
+const (
+	// OnForwardErrorRetry answers 500 so the sender retries
+	OnForwardErrorRetry = "retry"
+	// OnForwardErrorAccept answers 200 so the sender doesn't retry, fire-and-forget
+	OnForwardErrorAccept = "accept"
+)
+
 // webhook server
 type Webhook struct {
-	logger    log.Logger           // logger for the webhook server
-	forwarder *forwarder.Forwarder // alert forwarder for the the webhook server
-	server    *http.Server         // http server for the webhook
+	logger     log.Logger                           // logger for the webhook server
+	server     *http.Server                         // http server for the webhook
+	reload     func() (*forwarder.Forwarder, error) // builds a forwarder from the reloaded configuration
+	clientAuth bool                                 // whether the reload endpoint requires a verified client certificate, loopback clients only otherwise
+
+	webhookPath string // path of the webhook
+	healthzPath string // path of the liveness endpoint
+	readyzPath  string // path of the readiness endpoint
+	metricsPath string // path of the metrics endpoint
+
+	mtx       sync.RWMutex
+	forwarder *forwarder.Forwarder // alert forwarder for the the webhook server, swapped on reload
+
+	summaryInterval time.Duration // interval of the alert summary log
+	maxRequestBytes int64         // maximum size of the webhook request body
+	lenientDecode   bool          // forward the valid alerts of partially invalid webhook payloads
+	debugEcho       bool          // whether /debug/echo is served
+	adminAPI        bool          // whether /admin/ is served
+	redactPayloads  bool          // whether the labels and annotations of the alerts are kept out of the logs
+	logSampler      *sampler      // samples the per-alert debug log, nil logs all alerts
+	stopc           chan struct{} // closed on shutdown to stop the background routines
+	stopOnce        sync.Once     // closes stopc once when Shutdown is called more than once
+	listening       atomic.Bool   // set once the server listens, the forwarder and certificate are loaded before
+	shuttingDown    atomic.Bool   // set once the shutdown begins
+	shutdownDelay   time.Duration // time to drain before closing the listener on shutdown
+	acceptOnError   bool          // whether alerts that failed to be forwarded are answered with 200
+	anyContentType  bool          // whether the alerts are decoded regardless of the Content-Type
 }
 
 // NewWebhook construct the new webhook server
 func NewWebhook(opts *Options) (*Webhook, error) {
-	pair, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if opts.DebugEcho && opts.ClientCA == "" {
+		return nil, fmt.Errorf("the debug echo endpoint requires a client CA to authenticate its clients")
+	}
+	if opts.AdminAPI && opts.ClientCA == "" {
+		return nil, fmt.Errorf("the admin API requires a client CA to authenticate its clients")
+	}
+	switch opts.OnForwardError {
+	case "", OnForwardErrorRetry, OnForwardErrorAccept:
+	default:
+		return nil, fmt.Errorf("on forward error must be %s or %s, got %q", OnForwardErrorRetry, OnForwardErrorAccept, opts.OnForwardError)
+	}
+	getCertificate, err := getCertificateFunc(opts.Logger, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load key pair: %v", err)
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{GetCertificate: getCertificate}
+	if opts.ClientCA != "" {
+		caPEM, err := ioutil.ReadFile(opts.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("failed to parse client CA %s", opts.ClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%v", opts.Port),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: opts.ReadHeaderTimeout,
+		ReadTimeout:       opts.ReadTimeout,
+		WriteTimeout:      opts.WriteTimeout,
+		IdleTimeout:       opts.IdleTimeout,
+	}
+	if opts.DisableHTTP2 {
+		// a non-nil empty map disables the automatic HTTP/2 support
+		server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+		tlsConfig.NextProtos = []string{"http/1.1"}
+	} else {
+		tlsConfig.NextProtos = []string{"h2", "http/1.1"}
 	}
 
 	return &Webhook{
-		logger:    opts.Logger,
-		forwarder: opts.Forwarder,
-		server: &http.Server{
-			Addr:      fmt.Sprintf(":%v", opts.Port),
-			TLSConfig: &tls.Config{Certificates: []tls.Certificate{pair}},
-		},
+		logger:          opts.Logger,
+		forwarder:       opts.Forwarder,
+		server:          server,
+		reload:          opts.Reload,
+		webhookPath:     pathOrDefault(strings.TrimSuffix(opts.WebhookPath, "/"), DefaultWebhookPath),
+		healthzPath:     pathOrDefault(opts.HealthzPath, DefaultHealthzPath),
+		readyzPath:      pathOrDefault(opts.ReadyzPath, DefaultReadyzPath),
+		metricsPath:     pathOrDefault(opts.MetricsPath, DefaultMetricsPath),
+		clientAuth:      opts.ClientCA != "",
+		summaryInterval: opts.SummaryInterval,
+		maxRequestBytes: opts.MaxRequestBytes,
+		lenientDecode:   opts.LenientDecode,
+		debugEcho:       opts.DebugEcho,
+		adminAPI:        opts.AdminAPI,
+		redactPayloads:  opts.RedactPayloads,
+		logSampler:      newSampler(opts.LogSampleRate),
+		shutdownDelay:   opts.ShutdownDelay,
+		acceptOnError:   opts.OnForwardError == OnForwardErrorAccept,
+		anyContentType:  opts.AnyContentType,
+		stopc:           make(chan struct{}),
 	}, nil
 }
 
-// Run method register the handler functions and starts the webhook server
+// Run method register the handler functions, runs the forwarder and starts the webhook server
 func (wh *Webhook) Run() error {
-	// define http server and server handler
-	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", wh.Serve)
-	mux.HandleFunc("/healthz", wh.Healthz)
-	wh.server.Handler = mux
+	wh.Forwarder().Run()
+	wh.server.Handler = wh.handler()
+
+	if wh.summaryInterval > 0 {
+		ticker := time.NewTicker(wh.summaryInterval)
+		go func() {
+			defer ticker.Stop()
+			wh.logSummaries(ticker.C)
+		}()
+	}
 
-	if err := wh.server.ListenAndServeTLS("", ""); err != nil {
+	ln, err := net.Listen("tcp", wh.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen and serve webhook server: %v", err)
+	}
+	wh.listening.Store(true)
+	if err := wh.server.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("failed to listen and serve webhook server: %v", err)
 	}
 	return nil
 }
 
-// Shutdown method starts the webhook server
+// handler returns the handler of the webhook server serving the enabled endpoints
+func (wh *Webhook) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(wh.webhookPath, wh.Serve)
+	mux.HandleFunc(wh.webhookPath+"/", wh.ServeGroup)
+	// the alertmanager API, Prometheus can send alerts to the alerts collector as to an alertmanager
+	mux.HandleFunc("/api/v1/alerts", wh.ServeAlerts)
+	mux.HandleFunc("/api/v2/alerts", wh.ServeAlerts)
+	mux.HandleFunc("/api/v2/status", wh.ProxyAPI)
+	mux.HandleFunc(wh.healthzPath, wh.Healthz)
+	mux.HandleFunc(wh.readyzPath, wh.Readyz)
+	if wh.reload != nil {
+		mux.HandleFunc("/-/reload", wh.Reload)
+	}
+	if wh.debugEcho {
+		mux.HandleFunc("/debug/echo", wh.Echo)
+	}
+	if wh.adminAPI {
+		mux.HandleFunc("/admin/alertmanagers/", wh.AdminAlertmanager)
+	}
+	mux.Handle(wh.metricsPath, promhttp.Handler())
+	return wh.rejectOnShutdown(mux)
+}
+
+// pathOrDefault returns the path, or the default path if it is empty
+func pathOrDefault(path, def string) string {
+	if path == "" {
+		return def
+	}
+	return path
+}
+
+// Shutdown method stops the webhook server, the alerts are rejected with 503 and the server reports
+// not ready for the shutdown delay before the listener is closed, so load balancers can drain it
 func (wh *Webhook) Shutdown(ctx context.Context) error {
+	wh.shuttingDown.Store(true)
+	wh.stopOnce.Do(func() { close(wh.stopc) })
+	if wh.shutdownDelay > 0 {
+		select {
+		case <-time.After(wh.shutdownDelay):
+		case <-ctx.Done():
+		}
+	}
 	return wh.server.Shutdown(ctx)
 }
 
-// Serve handler for the webhook server
+// rejectOnShutdown returns the handler answering 503 to the alert requests once the shutdown begins,
+// the other endpoints are still served, e.g. readyz reports not ready
+func (wh *Webhook) rejectOnShutdown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wh.shuttingDown.Load() && wh.isAlertsPath(r.URL.Path) {
+			w.Header().Set("Connection", "close")
+			asJson(w, http.StatusServiceUnavailable, "shutting down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAlertsPath reports whether the path receives alerts
+func (wh *Webhook) isAlertsPath(path string) bool {
+	return path == wh.webhookPath || strings.HasPrefix(path, wh.webhookPath+"/") ||
+		path == "/api/v1/alerts" || path == "/api/v2/alerts"
+}
+
+// logSummaries logs the alert counts of the forwarder on each tick until shutdown
+func (wh *Webhook) logSummaries(ticks <-chan time.Time) {
+	for {
+		select {
+		case <-ticks:
+			stats := wh.Forwarder().TakeStats()
+			keyvals := []interface{}{
+				"msg", "alerts summary",
+				"interval", wh.summaryInterval,
+				"received", stats.Received,
+				"forwarded", stats.Forwarded,
+				"dropped", stats.Dropped,
+			}
+			for upstream, n := range stats.Failed {
+				keyvals = append(keyvals, "failed_"+upstream, n)
+			}
+			level.Info(wh.logger).Log(keyvals...)
+		case <-wh.stopc:
+			return
+		}
+	}
+}
+
+// Serve handler for the webhook server, alerts are routed by the identity of the client certificate if any
 func (wh *Webhook) Serve(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
+	wh.serve(wh.Forwarder().ForIdentity(clientIdentities(r)))(w, r)
+}
 
-	data := &template.Data{}
-	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+// ServeAlerts handler for the alertmanager API, alerts are routed by the identity of the client certificate if any
+func (wh *Webhook) ServeAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		wh.ProxyAPI(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		asJson(w, http.StatusMethodNotAllowed, "only GET and POST are allowed")
+		return
+	}
+	wh.handle(wh.Forwarder().ForIdentity(clientIdentities(r)), decodePostableAlerts)(w, r)
+}
+
+// ProxyAPI handler proxies the read requests to the alertmanager API to the configured upstream,
+// the upstream trusts the collector so only clients with a verified certificate are proxied
+func (wh *Webhook) ProxyAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		asJson(w, http.StatusMethodNotAllowed, "only GET is allowed")
+		return
+	}
+	if len(clientIdentities(r)) == 0 {
+		asJson(w, http.StatusUnauthorized, "verified client certificate required")
+		return
+	}
+	proxy := wh.Forwarder().APIProxy()
+	if proxy == nil {
+		asJson(w, http.StatusNotFound, "alertmanager API proxy is not configured")
+		return
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// ServeGroup handler for the webhook server, alerts posted to /webhook/<name> are forwarded to the routing group with that name
+func (wh *Webhook) ServeGroup(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, wh.webhookPath+"/")
+	fwder, found := wh.Forwarder().Groups()[name]
+	if !found {
+		asJson(w, http.StatusNotFound, fmt.Sprintf("unknown routing group %q", name))
+		return
+	}
+	wh.serve(fwder)(w, r)
+}
+
+// Forwarder returns the current alert forwarder of the webhook server
+func (wh *Webhook) Forwarder() *forwarder.Forwarder {
+	wh.mtx.RLock()
+	defer wh.mtx.RUnlock()
+	return wh.forwarder
+}
+
+// Reload handler rebuilds the forwarder from the configuration files and swaps it with the current one,
+// the previous forwarder is stopped once its pending alerts are flushed
+func (wh *Webhook) Reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		asJson(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if wh.clientAuth && len(clientIdentities(r)) == 0 {
+		asJson(w, http.StatusUnauthorized, "verified client certificate required")
+		return
+	}
+	if !wh.clientAuth && !isLoopback(r.RemoteAddr) {
+		asJson(w, http.StatusForbidden, "reload is only allowed from loopback clients without a client CA")
+		return
+	}
+
+	fwder, err := wh.reload()
+	if err != nil {
+		level.Error(wh.logger).Log("msg", "failed to reload configuration", "err", err)
 		asJson(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	level.Info(wh.logger).Log("alert", fmt.Sprintf("GroupLabels=%v, CommonLabels=%v", data.GroupLabels, data.CommonLabels))
-	for _, alert := range data.Alerts {
-		level.Debug(wh.logger).Log("alert", fmt.Sprintf("status=%s,Labels=%v,Annotations=%v,StartsAt=%v,EndsAt=%v", alert.Status, alert.Labels, alert.Annotations, alert.StartsAt, alert.EndsAt))
-		severity := alert.Labels["severity"]
-		switch strings.ToUpper(severity) {
-		case "CRITICAL":
-			level.Debug(wh.logger).Log("alert", fmt.Sprintf("action on severity: %s", severity))
-			// TODO(morvencao): forward alerts according to the alert severity
-		case "WARNING":
-			level.Debug(wh.logger).Log("alert", fmt.Sprintf("action on severity: %s", severity))
-			// TODO(morvencao): forward alerts according to the alert severity
-		default:
-			level.Debug(wh.logger).Log("alert", fmt.Sprintf("no action on severity: %s", severity))
-			// TODO(morvencao): forward alerts according to the alert severity
+	wh.mtx.Lock()
+	prev := wh.forwarder
+	wh.forwarder = fwder
+	wh.mtx.Unlock()
+	fwder.Run()
+	go prev.Stop()
+
+	level.Info(wh.logger).Log("msg", "configuration reloaded")
+	asJson(w, http.StatusOK, "success")
+}
+
+// isLoopback reports whether the remote address of the request is a loopback address
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Echo handler decodes the webhook payload and returns the normalized alerts as JSON without forwarding them
+func (wh *Webhook) Echo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		asJson(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if len(clientIdentities(r)) == 0 {
+		asJson(w, http.StatusUnauthorized, "verified client certificate required")
+		return
+	}
+	defer r.Body.Close()
+	if wh.maxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, wh.maxRequestBytes)
+	}
+
+	decode := wh.decodeWebhook
+	if wh.lenientDecode {
+		decode = wh.decodeWebhookLenient
+	}
+	alerts, err := decode(r.Body)
+	if err != nil {
+		if isBodyTooLarge(err) {
+			asJson(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", wh.maxRequestBytes))
+			return
 		}
+		asJson(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	alerts = wh.Forwarder().Normalize(alerts)
+	if alerts == nil {
+		alerts = template.Alerts{}
 	}
 
-	level.Info(wh.logger).Log("msg", "prepare to forward alerts to upstream alertmanagers")
-	// forward the alerts
-	// TODO(morvencao): forward alerts according to the alert severity
-	if err := wh.forwarder.Forward(context.TODO(), data.Alerts); err != nil {
+	b, err := json.Marshal(alerts)
+	if err != nil {
 		asJson(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// AdminAlertmanager handler enables or disables forwarding to an alertmanager at runtime with
+// POST /admin/alertmanagers/{index}/enable and /disable, the state is lost on reload
+func (wh *Webhook) AdminAlertmanager(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		asJson(w, http.StatusMethodNotAllowed, "only POST is allowed")
+		return
+	}
+	if len(clientIdentities(r)) == 0 {
+		asJson(w, http.StatusUnauthorized, "verified client certificate required")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/alertmanagers/"), "/")
+	if len(parts) != 2 || (parts[1] != "enable" && parts[1] != "disable") {
+		asJson(w, http.StatusNotFound, "expected /admin/alertmanagers/{index}/enable or /disable")
+		return
+	}
+	index, err := strconv.Atoi(parts[0])
+	if err != nil {
+		asJson(w, http.StatusBadRequest, fmt.Sprintf("invalid alertmanager index %q", parts[0]))
+		return
+	}
+	if err := wh.Forwarder().SetAlertmanagerEnabled(index, parts[1] == "enable"); err != nil {
+		asJson(w, http.StatusNotFound, err.Error())
+		return
 	}
+	level.Info(wh.logger).Log("msg", "alertmanager "+parts[1]+"d by admin", "index", index, "client", strings.Join(clientIdentities(r), ","))
 	asJson(w, http.StatusOK, "success")
 }
 
+// clientIdentities returns the subject common name and SANs of the verified client certificate
+func clientIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
+
+// serve returns the webhook handler forwarding alerts with the given forwarder
+func (wh *Webhook) serve(fwder *forwarder.Forwarder) http.HandlerFunc {
+	if wh.lenientDecode {
+		return wh.handle(fwder, wh.decodeWebhookLenient)
+	}
+	return wh.handle(fwder, wh.decodeWebhook)
+}
+
+// decodeWebhook decodes the alerts of an alertmanager webhook payload
+func (wh *Webhook) decodeWebhook(r io.Reader) (template.Alerts, error) {
+	data := &template.Data{}
+	if err := json.NewDecoder(r).Decode(data); err != nil {
+		return nil, err
+	}
+	if wh.redactPayloads {
+		level.Info(wh.logger).Log("msg", "webhook payload received", "numAlerts", len(data.Alerts))
+	} else {
+		level.Info(wh.logger).Log("alert", fmt.Sprintf("GroupLabels=%v, CommonLabels=%v", data.GroupLabels, data.CommonLabels))
+	}
+	return data.Alerts, nil
+}
+
+// decodePostableAlerts decodes the alerts posted to the alertmanager API, the status is derived from EndsAt
+func decodePostableAlerts(r io.Reader) (template.Alerts, error) {
+	var postable models.PostableAlerts
+	if err := json.NewDecoder(r).Decode(&postable); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	alerts := make(template.Alerts, 0, len(postable))
+	for _, pa := range postable {
+		if pa == nil {
+			continue
+		}
+		alt := template.Alert{
+			Status:       string(model.AlertFiring),
+			Labels:       template.KV(pa.Labels),
+			Annotations:  template.KV(pa.Annotations),
+			StartsAt:     time.Time(pa.StartsAt),
+			EndsAt:       time.Time(pa.EndsAt),
+			GeneratorURL: pa.GeneratorURL.String(),
+		}
+		if alt.Annotations == nil {
+			alt.Annotations = template.KV{}
+		}
+		if !alt.EndsAt.IsZero() && !alt.EndsAt.After(now) {
+			alt.Status = string(model.AlertResolved)
+		}
+		alerts = append(alerts, alt)
+	}
+	return alerts, nil
+}
+
+// handle returns the handler decoding the alerts with the decode function and forwarding them with the forwarder
+func (wh *Webhook) handle(fwder *forwarder.Forwarder, decode func(io.Reader) (template.Alerts, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		if wh.maxRequestBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, wh.maxRequestBytes)
+		}
+
+		if !wh.anyContentType && !isJSON(r.Header.Get("Content-Type")) {
+			asJson(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, "webhook.serve", trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		alerts, err := decode(r.Body)
+		if err != nil {
+			if isBodyTooLarge(err) {
+				asJson(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", wh.maxRequestBytes))
+				return
+			}
+			asJson(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		observeAlertAge(alerts, time.Now())
+		for _, alert := range alerts {
+			if !wh.logSampler.sample() {
+				continue
+			}
+			if wh.redactPayloads {
+				level.Debug(wh.logger).Log("msg", "alert received", "status", alert.Status, "fingerprint", forwarder.Fingerprint(alert))
+				continue
+			}
+			level.Debug(wh.logger).Log("alert", fmt.Sprintf("status=%s,Labels=%v,Annotations=%v,StartsAt=%v,EndsAt=%v", alert.Status, alert.Labels, alert.Annotations, alert.StartsAt, alert.EndsAt))
+			severity := alert.Labels["severity"]
+			switch strings.ToUpper(severity) {
+			case "CRITICAL":
+				level.Debug(wh.logger).Log("alert", fmt.Sprintf("action on severity: %s", severity))
+				// TODO(morvencao): forward alerts according to the alert severity
+			case "WARNING":
+				level.Debug(wh.logger).Log("alert", fmt.Sprintf("action on severity: %s", severity))
+				// TODO(morvencao): forward alerts according to the alert severity
+			default:
+				level.Debug(wh.logger).Log("alert", fmt.Sprintf("no action on severity: %s", severity))
+				// TODO(morvencao): forward alerts according to the alert severity
+			}
+		}
+
+		level.Info(wh.logger).Log("msg", "prepare to forward alerts to upstream alertmanagers")
+		// forward the alerts
+		// TODO(morvencao): forward alerts according to the alert severity
+		span.SetAttributes(attribute.Int("alerts", len(alerts)))
+		if err := fwder.Forward(ctx, alerts); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			if wh.acceptOnError {
+				level.Warn(wh.logger).Log("msg", "forwarding alerts failed, accepting them without retry", "numAlerts", len(alerts), "err", err)
+				asJson(w, http.StatusOK, "accepted, forwarding failed: "+err.Error())
+				return
+			}
+			asJson(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		asJson(w, http.StatusOK, "success")
+	}
+}
+
+// isJSON reports whether the content type is application/json, with any parameters like the charset
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
 // Healthz method for webhook server to return healthy status
 func (wh *Webhook) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK!")
+}
+
+// Readyz method for webhook server to return ready status
+func (wh *Webhook) Readyz(w http.ResponseWriter, r *http.Request) {
+	if !wh.listening.Load() {
+		asJson(w, http.StatusServiceUnavailable, "webhook server is not listening yet")
+		return
+	}
+	if wh.shuttingDown.Load() {
+		asJson(w, http.StatusServiceUnavailable, "shutting down")
+		return
+	}
+	if err := wh.Forwarder().Ready(); err != nil {
+		asJson(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	fmt.Fprint(w, "OK!")
 }
 
+// response is the JSON body of the responses, Error is only set for error responses
 type response struct {
 	Status  int
 	Message string
+	Error   string `json:",omitempty"`
 }
 
 // asJson write json response
@@ -121,9 +662,17 @@ func asJson(w http.ResponseWriter, status int, message string) {
 		Status:  status,
 		Message: message,
 	}
-	bytes, _ := json.Marshal(data)
-	json := string(bytes[:])
+	if status >= http.StatusBadRequest {
+		data.Error = http.StatusText(status)
+	}
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
 	w.WriteHeader(status)
-	fmt.Fprint(w, json)
+	w.Write(bytes)
 }
@@ -0,0 +1,995 @@
+// Copyright Contributors to the Open Cluster Management project
+
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-openapi/strfmt"
+	"github.com/prometheus/alertmanager/api/v2/models"
+	"github.com/prometheus/alertmanager/template"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/open-cluster-management/alerts-collector/pkg/forwarder"
+)
+
+// newTestForwarder returns a forwarder sending the alerts to the upstream, stopped at the end of the test
+func newTestForwarder(t *testing.T, upstream *httptest.Server) *forwarder.Forwarder {
+	t.Helper()
+	return newConfiguredForwarder(t, "alertmanagers:\n- static_configs: ["+strings.TrimPrefix(upstream.URL, "http://")+"]\n  scheme: http\n  api_version: v1\n")
+}
+
+// newConfiguredForwarder returns a forwarder of the alerting configuration, stopped at the end of the test
+func newConfiguredForwarder(t *testing.T, content string) *forwarder.Forwarder {
+	t.Helper()
+	config := filepath.Join(t.TempDir(), "alertmanagers.yaml")
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fwder, err := forwarder.NewForwarder(log.NewNopLogger(), config)
+	if err != nil {
+		t.Fatalf("failed to create the forwarder: %v", err)
+	}
+	t.Cleanup(fwder.Stop)
+	return fwder
+}
+
+// newTestUpstream returns a started upstream alertmanager answering with the status
+func newTestUpstream(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// recordingUpstream is an upstream alertmanager recording the alerts posted to it
+type recordingUpstream struct {
+	*httptest.Server
+
+	mtx      sync.Mutex
+	posted   models.PostableAlerts
+	alerts   []string // alertnames of the posted alerts
+	requests []*http.Request
+}
+
+// newRecordingUpstream returns a started recording upstream alertmanager answering with the status
+func newRecordingUpstream(t *testing.T, status int) *recordingUpstream {
+	t.Helper()
+	u := &recordingUpstream{}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alerts models.PostableAlerts
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			t.Errorf("failed to decode the posted alerts: %v", err)
+		}
+		u.mtx.Lock()
+		u.requests = append(u.requests, r)
+		u.posted = append(u.posted, alerts...)
+		for _, alt := range alerts {
+			u.alerts = append(u.alerts, alt.Labels["alertname"])
+		}
+		u.mtx.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// addr returns the host:port address of the upstream
+func (u *recordingUpstream) addr() string {
+	return strings.TrimPrefix(u.URL, "http://")
+}
+
+// received returns the alertnames of the received alerts
+func (u *recordingUpstream) received() []string {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	return append([]string(nil), u.alerts...)
+}
+
+// newTLSServer returns a started test server of the handler with the TLS configuration of the webhook server,
+// it serves the certificate of the test server unless the client sends a server name
+func newTLSServer(t *testing.T, wh *Webhook, handler http.Handler) *httptest.Server {
+	t.Helper()
+	s := httptest.NewUnstartedServer(handler)
+	s.TLS = wh.server.TLSConfig.Clone()
+	s.Config.ErrorLog = stdlog.New(ioutil.Discard, "", 0) // the failed handshakes are expected
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// tlsClient returns a client of the test server presenting the client certificates
+func tlsClient(s *httptest.Server, certs ...tls.Certificate) *http.Client {
+	transport := s.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = certs
+	return &http.Client{Transport: transport}
+}
+
+// newTestWebhook returns a webhook server serving a self-signed certificate, it isn't started
+func newTestWebhook(t *testing.T, opts Options) *Webhook {
+	t.Helper()
+	if opts.Logger == nil {
+		opts.Logger = log.NewNopLogger()
+	}
+	opts.CertFile = filepath.Join(t.TempDir(), "missing.crt")
+	opts.KeyFile = filepath.Join(t.TempDir(), "missing.key")
+	opts.SelfSignedFallback = true
+	wh, err := NewWebhook(&opts)
+	if err != nil {
+		t.Fatalf("failed to create the webhook server: %v", err)
+	}
+	return wh
+}
+
+// verifiedClient returns the TLS state of a connection of a client with a verified certificate
+func verifiedClient(cn string) *tls.ConnectionState {
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}}
+}
+
+// checkJSONResponse checks the response is a JSON object of its status, with the status text as error if it failed
+func checkJSONResponse(t *testing.T, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON body %q: %v", rec.Body.String(), err)
+	}
+	want := map[string]interface{}{"Status": float64(rec.Code), "Message": body["Message"]}
+	if rec.Code >= http.StatusBadRequest {
+		want["Error"] = http.StatusText(rec.Code)
+	}
+	if _, ok := body["Message"].(string); !ok || !reflect.DeepEqual(body, want) {
+		t.Errorf("body = %v, want the status, a message and the error of failures only", body)
+	}
+}
+
+// webhookPayload is an alertmanager webhook payload with a firing alert
+const webhookPayload = `{"status":"firing","alerts":[{"status":"firing","labels":{"alertname":"a"},"startsAt":"2021-01-01T00:00:00Z"}]}`
+
+func TestServe(t *testing.T) {
+	tests := []struct {
+		name           string
+		opts           Options
+		upstreamStatus int
+		contentType    string
+		body           string
+		shuttingDown   bool
+		alertsAPI      bool // post to the alertmanager API instead of the webhook
+		wantStatus     int
+		wantForwarded  models.PostableAlerts
+	}{
+		{name: "forwarded", upstreamStatus: http.StatusOK, contentType: "application/json", body: webhookPayload, wantStatus: http.StatusOK},
+		{name: "charset parameter", upstreamStatus: http.StatusOK, contentType: "application/json; charset=utf-8", body: webhookPayload, wantStatus: http.StatusOK},
+		{name: "unsupported content type", upstreamStatus: http.StatusOK, contentType: "text/plain", body: webhookPayload, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "missing content type", upstreamStatus: http.StatusOK, body: webhookPayload, wantStatus: http.StatusUnsupportedMediaType},
+		{
+			name:           "any content type",
+			opts:           Options{AnyContentType: true},
+			upstreamStatus: http.StatusOK,
+			contentType:    "text/plain",
+			body:           webhookPayload,
+			wantStatus:     http.StatusOK,
+		},
+		{
+			name:           "request body too large",
+			opts:           Options{MaxRequestBytes: 16},
+			upstreamStatus: http.StatusOK,
+			contentType:    "application/json",
+			body:           webhookPayload,
+			wantStatus:     http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "request body too large for lenient decoding",
+			opts:           Options{MaxRequestBytes: 16, LenientDecode: true},
+			upstreamStatus: http.StatusOK,
+			contentType:    "application/json",
+			body:           webhookPayload,
+			wantStatus:     http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "request body within the limit",
+			opts:           Options{MaxRequestBytes: int64(len(webhookPayload))},
+			upstreamStatus: http.StatusOK,
+			contentType:    "application/json",
+			body:           webhookPayload,
+			wantStatus:     http.StatusOK,
+		},
+		{name: "invalid payload", upstreamStatus: http.StatusOK, contentType: "application/json", body: `{"alerts":`, wantStatus: http.StatusBadRequest},
+		{
+			name:           "partially invalid payload with lenient decoding",
+			opts:           Options{LenientDecode: true},
+			upstreamStatus: http.StatusOK,
+			contentType:    "application/json",
+			body:           `{"alerts":[{"labels":{"alertname":"a"}},{"labels":"invalid"}]}`,
+			wantStatus:     http.StatusOK,
+		},
+		{name: "forwarding failed", upstreamStatus: http.StatusInternalServerError, contentType: "application/json", body: webhookPayload, wantStatus: http.StatusInternalServerError},
+		{
+			name:           "forwarding failed accepted",
+			opts:           Options{OnForwardError: OnForwardErrorAccept},
+			upstreamStatus: http.StatusInternalServerError,
+			contentType:    "application/json",
+			body:           webhookPayload,
+			wantStatus:     http.StatusOK,
+		},
+		{name: "shutting down", upstreamStatus: http.StatusOK, contentType: "application/json", body: webhookPayload, shuttingDown: true, wantStatus: http.StatusServiceUnavailable},
+		{
+			name:           "alertmanager API",
+			alertsAPI:      true,
+			upstreamStatus: http.StatusOK,
+			contentType:    "application/json",
+			body: `[{"labels":{"alertname":"a","severity":"critical"},"annotations":{"summary":"down"},` +
+				`"startsAt":"2021-01-01T00:00:00Z","endsAt":"2021-01-01T01:00:00Z"}]`,
+			wantStatus: http.StatusOK,
+			wantForwarded: models.PostableAlerts{{
+				Alert:       models.Alert{Labels: models.LabelSet{"alertname": "a", "severity": "critical"}},
+				Annotations: models.LabelSet{"summary": "down"},
+				StartsAt:    strfmt.DateTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+				EndsAt:      strfmt.DateTime(time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)),
+			}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newRecordingUpstream(t, tc.upstreamStatus)
+			tc.opts.Forwarder = newTestForwarder(t, upstream.Server)
+			wh := newTestWebhook(t, tc.opts)
+			wh.shuttingDown.Store(tc.shuttingDown)
+
+			path, handler := DefaultWebhookPath, wh.Serve
+			if tc.alertsAPI {
+				path, handler = "/api/v2/alerts", wh.ServeAlerts
+			}
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			rec := httptest.NewRecorder()
+			wh.rejectOnShutdown(http.HandlerFunc(handler)).ServeHTTP(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			checkJSONResponse(t, rec)
+			if tc.wantForwarded == nil {
+				return
+			}
+			upstream.mtx.Lock()
+			defer upstream.mtx.Unlock()
+			if len(upstream.posted) != len(tc.wantForwarded) {
+				t.Fatalf("upstream received %d alerts, want %d", len(upstream.posted), len(tc.wantForwarded))
+			}
+			for i, got := range upstream.posted {
+				want := tc.wantForwarded[i]
+				if !reflect.DeepEqual(got.Labels, want.Labels) || !reflect.DeepEqual(got.Annotations, want.Annotations) ||
+					!time.Time(got.StartsAt).Equal(time.Time(want.StartsAt)) || !time.Time(got.EndsAt).Equal(time.Time(want.EndsAt)) {
+					t.Errorf("upstream received labels %v, annotations %v, startsAt %v and endsAt %v, want %v, %v, %v and %v",
+						got.Labels, got.Annotations, got.StartsAt, got.EndsAt, want.Labels, want.Annotations, want.StartsAt, want.EndsAt)
+				}
+			}
+		})
+	}
+}
+
+// countingWriter counts the status codes and bodies written to the recorder
+type countingWriter struct {
+	*httptest.ResponseRecorder
+	headers, writes int
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	w.headers++
+	w.ResponseRecorder.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.ResponseRecorder.Write(b)
+}
+
+func TestServeForwardFailedSingleResponse(t *testing.T) {
+	wh := newTestWebhook(t, Options{Forwarder: newTestForwarder(t, newTestUpstream(t, http.StatusInternalServerError))})
+	req := httptest.NewRequest(http.MethodPost, DefaultWebhookPath, strings.NewReader(webhookPayload))
+	req.Header.Set("Content-Type", "application/json")
+	w := &countingWriter{ResponseRecorder: httptest.NewRecorder()}
+	wh.Serve(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if w.headers != 1 || w.writes != 1 {
+		t.Errorf("%d status codes and %d bodies written, want a single response", w.headers, w.writes)
+	}
+	checkJSONResponse(t, w.ResponseRecorder)
+}
+
+func TestServeLogRedaction(t *testing.T) {
+	payload := `{"status":"firing","groupLabels":{"cluster":"group-value"},"commonLabels":{"alertname":"a","cluster":"group-value"},` +
+		`"alerts":[{"status":"firing","labels":{"alertname":"a","cluster":"group-value","secret":"label-value"},` +
+		`"annotations":{"description":"annotation-value"},"startsAt":"2021-01-01T00:00:00Z"}]}`
+	for _, redact := range []bool{false, true} {
+		t.Run(fmt.Sprintf("redacted %v", redact), func(t *testing.T) {
+			var buf bytes.Buffer
+			wh := newTestWebhook(t, Options{
+				Forwarder:      newTestForwarder(t, newTestUpstream(t, http.StatusOK)),
+				Logger:         log.NewLogfmtLogger(log.NewSyncWriter(&buf)),
+				RedactPayloads: redact,
+			})
+			req := httptest.NewRequest(http.MethodPost, DefaultWebhookPath, strings.NewReader(payload))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			wh.Serve(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			logs := buf.String()
+			for _, value := range []string{"group-value", "label-value", "annotation-value"} {
+				if got := strings.Contains(logs, value); got != !redact {
+					t.Errorf("%q logged = %v, want %v: %s", value, got, !redact, logs)
+				}
+			}
+			if redact && !strings.Contains(logs, "numAlerts=1") {
+				t.Errorf("the number of received alerts isn't logged: %s", logs)
+			}
+		})
+	}
+}
+
+func TestServeTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	upstream := newRecordingUpstream(t, http.StatusOK)
+	wh := newTestWebhook(t, Options{Forwarder: newTestForwarder(t, upstream.Server)})
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodPost, DefaultWebhookPath, strings.NewReader(webhookPayload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	rec := httptest.NewRecorder()
+	wh.Serve(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	serve, post := spans["webhook.serve"], spans["alertmanager.post"]
+	if serve == nil || post == nil {
+		t.Fatalf("ended spans = %v, want webhook.serve and alertmanager.post", spans)
+	}
+	if got := serve.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("webhook.serve trace ID = %s, want the propagated %s", got, traceID)
+	}
+	if got := serve.Parent().SpanID().String(); got != parentID || !serve.Parent().IsRemote() {
+		t.Errorf("webhook.serve parent = %s (remote %v), want the remote %s", got, serve.Parent().IsRemote(), parentID)
+	}
+	if got, want := post.Parent().SpanID(), serve.SpanContext().SpanID(); got != want {
+		t.Errorf("alertmanager.post parent = %s, want webhook.serve %s", got, want)
+	}
+	if post.SpanKind() != trace.SpanKindClient || serve.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span kinds = %s and %s, want server and client", serve.SpanKind(), post.SpanKind())
+	}
+
+	// the upstream request carries the context of the alertmanager.post span
+	upstream.mtx.Lock()
+	defer upstream.mtx.Unlock()
+	if len(upstream.requests) != 1 {
+		t.Fatalf("upstream received %d requests, want 1", len(upstream.requests))
+	}
+	want := "00-" + traceID + "-" + post.SpanContext().SpanID().String() + "-01"
+	if got := upstream.requests[0].Header.Get("traceparent"); got != want {
+		t.Errorf("upstream traceparent = %q, want %q", got, want)
+	}
+}
+
+func TestServeClientIdentity(t *testing.T) {
+	defaultUpstream := newRecordingUpstream(t, http.StatusOK)
+	teamA := newRecordingUpstream(t, http.StatusOK)
+	teamB := newRecordingUpstream(t, http.StatusOK)
+	fwder := newConfiguredForwarder(t, `
+alertmanagers:
+- static_configs: [`+defaultUpstream.addr()+`]
+routing_groups:
+- name: team-a
+  client_identities: [team-a]
+  alertmanagers:
+  - static_configs: [`+teamA.addr()+`]
+- name: team-b
+  client_identities: [team-b]
+  alertmanagers:
+  - static_configs: [`+teamB.addr()+`]
+`)
+	ca := newTestCA(t)
+	wh := newTestWebhook(t, Options{Forwarder: fwder, ClientCA: ca.writeFile(t)})
+	s := newTLSServer(t, wh, http.HandlerFunc(wh.Serve))
+
+	for i, tc := range []struct {
+		client  *http.Client
+		wantErr bool
+	}{
+		{client: tlsClient(s, ca.issue(t, "team-a", 2))},
+		{client: tlsClient(s, ca.issue(t, "team-b", 3))},
+		{client: tlsClient(s)},
+		{client: tlsClient(s, newTestCA(t).issue(t, "team-a", 4)), wantErr: true}, // issued by an unknown CA
+	} {
+		payload := `{"alerts":[{"status":"firing","labels":{"alertname":"` + strconv.Itoa(i) + `"}}]}`
+		resp, err := tc.client.Post(s.URL+DefaultWebhookPath, "application/json", strings.NewReader(payload))
+		if (err != nil) != tc.wantErr {
+			t.Fatalf("client %d: error = %v, want error %v", i, err, tc.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("client %d: status = %d, want %d", i, resp.StatusCode, http.StatusOK)
+		}
+	}
+	for _, tc := range []struct {
+		name     string
+		upstream *recordingUpstream
+		want     []string
+	}{
+		{name: "team-a", upstream: teamA, want: []string{"0"}},
+		{name: "team-b", upstream: teamB, want: []string{"1"}},
+		{name: "default", upstream: defaultUpstream, want: []string{"2"}},
+	} {
+		if got := tc.upstream.received(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s upstream received %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestServeGroup(t *testing.T) {
+	defaultUpstream := newRecordingUpstream(t, http.StatusOK)
+	teamA := newRecordingUpstream(t, http.StatusOK)
+	teamB := newRecordingUpstream(t, http.StatusOK)
+	wh := newTestWebhook(t, Options{Forwarder: newConfiguredForwarder(t, `
+alertmanagers:
+- static_configs: [`+defaultUpstream.addr()+`]
+routing_groups:
+- name: team-a
+  alertmanagers:
+  - static_configs: [`+teamA.addr()+`]
+- name: team-b
+  alertmanagers:
+  - static_configs: [`+teamB.addr()+`]
+`)})
+
+	for _, tc := range []struct {
+		path       string
+		alertname  string
+		wantStatus int
+	}{
+		{path: "/webhook/team-a", alertname: "a", wantStatus: http.StatusOK},
+		{path: "/webhook/team-b", alertname: "b", wantStatus: http.StatusOK},
+		{path: "/webhook/team-c", alertname: "c", wantStatus: http.StatusNotFound},
+	} {
+		payload := `{"alerts":[{"status":"firing","labels":{"alertname":"` + tc.alertname + `"}}]}`
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		wh.ServeGroup(rec, req)
+		if rec.Code != tc.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tc.path, rec.Code, tc.wantStatus, rec.Body.String())
+		}
+	}
+	for _, tc := range []struct {
+		name     string
+		upstream *recordingUpstream
+		want     []string
+	}{
+		{name: "team-a", upstream: teamA, want: []string{"a"}},
+		{name: "team-b", upstream: teamB, want: []string{"b"}},
+		{name: "default", upstream: defaultUpstream},
+	} {
+		if got := tc.upstream.received(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s upstream received %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEcho(t *testing.T) {
+	ca := newTestCA(t)
+	client := ca.issue(t, "debugger", 2)
+	tests := []struct {
+		name       string
+		debugEcho  bool
+		certs      []tls.Certificate
+		wantStatus int
+	}{
+		{name: "echoed", debugEcho: true, certs: []tls.Certificate{client}, wantStatus: http.StatusOK},
+		{name: "client without certificate", debugEcho: true, wantStatus: http.StatusUnauthorized},
+		{name: "disabled", certs: []tls.Certificate{client}, wantStatus: http.StatusNotFound},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newRecordingUpstream(t, http.StatusOK)
+			wh := newTestWebhook(t, Options{Forwarder: newTestForwarder(t, upstream.Server), ClientCA: ca.writeFile(t), DebugEcho: tc.debugEcho})
+			s := newTLSServer(t, wh, wh.handler())
+
+			resp, err := tlsClient(s, tc.certs...).Post(s.URL+"/debug/echo", "application/json", strings.NewReader(webhookPayload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+			}
+			if got := upstream.received(); len(got) != 0 {
+				t.Errorf("upstream received %v, want the echoed alerts not to be forwarded", got)
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+			if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			var alerts []struct {
+				Status   string            `json:"status"`
+				Labels   map[string]string `json:"labels"`
+				StartsAt time.Time         `json:"startsAt"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&alerts); err != nil {
+				t.Fatalf("failed to decode the echoed alerts: %v", err)
+			}
+			if len(alerts) != 1 || alerts[0].Status != "firing" || alerts[0].Labels["alertname"] != "a" ||
+				!alerts[0].StartsAt.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) {
+				t.Errorf("echoed alerts = %+v, want the firing alert a started at 2021-01-01T00:00:00Z", alerts)
+			}
+		})
+	}
+
+	if _, err := NewWebhook(&Options{Logger: log.NewNopLogger(), DebugEcho: true}); err == nil {
+		t.Error("NewWebhook() succeeded with the debug echo endpoint without client CA, want error")
+	}
+}
+
+func TestAdminAlertmanager(t *testing.T) {
+	first := newRecordingUpstream(t, http.StatusOK)
+	second := newRecordingUpstream(t, http.StatusOK)
+	fwder := newConfiguredForwarder(t, `
+alertmanagers:
+- static_configs: [`+first.addr()+`]
+- static_configs: [`+second.addr()+`]
+`)
+	ca := newTestCA(t)
+	wh := newTestWebhook(t, Options{Forwarder: fwder, ClientCA: ca.writeFile(t), AdminAPI: true})
+	s := newTLSServer(t, wh, wh.handler())
+	admin := tlsClient(s, ca.issue(t, "admin", 2))
+
+	post := func(client *http.Client, path string, wantStatus int) {
+		t.Helper()
+		resp, err := client.Post(s.URL+path, "application/json", strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("POST %s: status = %d, want %d", path, resp.StatusCode, wantStatus)
+		}
+	}
+	forward := func(alertname string) {
+		t.Helper()
+		if err := fwder.Forward(context.Background(), template.Alerts{{Status: "firing", Labels: template.KV{"alertname": alertname}}}); err != nil {
+			t.Fatalf("Forward() error = %v", err)
+		}
+	}
+
+	post(tlsClient(s), "/admin/alertmanagers/1/disable", http.StatusUnauthorized)
+	post(admin, "/admin/alertmanagers/2/disable", http.StatusNotFound)
+	post(admin, "/admin/alertmanagers/1/pause", http.StatusNotFound)
+
+	post(admin, "/admin/alertmanagers/1/disable", http.StatusOK)
+	forward("skipped")
+	post(admin, "/admin/alertmanagers/1/enable", http.StatusOK)
+	forward("restored")
+
+	if got, want := first.received(), []string{"skipped", "restored"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("first upstream received %v, want %v", got, want)
+	}
+	if got, want := second.received(), []string{"restored"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("disabled then enabled upstream received %v, want %v", got, want)
+	}
+}
+
+func TestCustomPaths(t *testing.T) {
+	wh := newTestWebhook(t, Options{
+		Forwarder:   newTestForwarder(t, newTestUpstream(t, http.StatusOK)),
+		WebhookPath: "/collector/webhook",
+		HealthzPath: "/collector/healthz",
+		ReadyzPath:  "/collector/readyz",
+		MetricsPath: "/collector/metrics",
+	})
+	wh.listening.Store(true)
+	handler := wh.handler()
+	serve := func(method, path string) int {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(webhookPayload)
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, tc := range []struct{ method, custom, def string }{
+		{http.MethodPost, "/collector/webhook", DefaultWebhookPath},
+		{http.MethodGet, "/collector/healthz", DefaultHealthzPath},
+		{http.MethodGet, "/collector/readyz", DefaultReadyzPath},
+		{http.MethodGet, "/collector/metrics", DefaultMetricsPath},
+	} {
+		if got := serve(tc.method, tc.custom); got != http.StatusOK {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.custom, got, http.StatusOK)
+		}
+		if got := serve(tc.method, tc.def); got != http.StatusNotFound {
+			t.Errorf("%s %s = %d with a custom path, want %d", tc.method, tc.def, got, http.StatusNotFound)
+		}
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name           string
+		upstreamStatus int
+		listening      bool
+		shuttingDown   bool
+		critical       bool
+		wantStatus     int
+	}{
+		{name: "not listening yet", upstreamStatus: http.StatusOK, wantStatus: http.StatusServiceUnavailable},
+		{name: "listening", upstreamStatus: http.StatusOK, listening: true, wantStatus: http.StatusOK},
+		{name: "shutting down", upstreamStatus: http.StatusOK, listening: true, shuttingDown: true, wantStatus: http.StatusServiceUnavailable},
+		{name: "failing critical alertmanager", upstreamStatus: http.StatusInternalServerError, listening: true, critical: true, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newTestUpstream(t, tc.upstreamStatus)
+			content := "alertmanagers:\n- static_configs: [" + strings.TrimPrefix(upstream.URL, "http://") + "]\n"
+			if tc.critical {
+				content += "  critical: true\n"
+			}
+			config := filepath.Join(t.TempDir(), "alertmanagers.yaml")
+			if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			fwder, err := forwarder.NewForwarder(log.NewNopLogger(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(fwder.Stop)
+			if tc.critical {
+				// the critical alertmanager fails to receive the alerts
+				req := httptest.NewRequest(http.MethodPost, DefaultWebhookPath, strings.NewReader(webhookPayload))
+				req.Header.Set("Content-Type", "application/json")
+				newTestWebhook(t, Options{Forwarder: fwder}).Serve(httptest.NewRecorder(), req)
+			}
+			wh := newTestWebhook(t, Options{Forwarder: fwder})
+			wh.listening.Store(tc.listening)
+			wh.shuttingDown.Store(tc.shuttingDown)
+
+			rec := httptest.NewRecorder()
+			wh.Readyz(rec, httptest.NewRequest(http.MethodGet, DefaultReadyzPath, nil))
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestLogSummaries(t *testing.T) {
+	failing, healthy := newTestUpstream(t, http.StatusInternalServerError), newTestUpstream(t, http.StatusOK)
+	var buf bytes.Buffer
+	wh := newTestWebhook(t, Options{
+		Forwarder: newConfiguredForwarder(t, `
+alertmanagers:
+- name: failing
+  static_configs: [`+strings.TrimPrefix(failing.URL, "http://")+`]
+  api_version: v1
+- name: healthy
+  static_configs: [`+strings.TrimPrefix(healthy.URL, "http://")+`]
+  api_version: v1
+`),
+		Logger:          log.NewLogfmtLogger(log.NewSyncWriter(&buf)),
+		SummaryInterval: time.Minute,
+	})
+	ticks := make(chan time.Time)
+	done := make(chan struct{})
+	go func() {
+		wh.logSummaries(ticks)
+		close(done)
+	}()
+
+	wh.Forwarder().Forward(context.Background(), template.Alerts{
+		{Status: "firing", Labels: template.KV{"alertname": "a"}},
+		{Status: "firing", Labels: template.KV{"alertname": "b"}},
+	})
+	ticks <- time.Now()
+	// the counts are reset once logged
+	ticks <- time.Now()
+	close(wh.stopc)
+	<-done
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var summaries []string
+	for _, line := range lines {
+		if strings.Contains(line, `msg="alerts summary"`) {
+			summaries = append(summaries, line)
+		}
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("logged %d summaries, want 2: %s", len(summaries), buf.String())
+	}
+	for _, want := range []string{"interval=1m0s", "received=2", "forwarded=2", "dropped=0", "failed_failing=2"} {
+		if !strings.Contains(summaries[0], want) {
+			t.Errorf("summary %q doesn't contain %q", summaries[0], want)
+		}
+	}
+	if strings.Contains(summaries[0], "failed_healthy") {
+		t.Errorf("summary %q has failures of the healthy alertmanager", summaries[0])
+	}
+	if !strings.Contains(summaries[1], "received=0") || strings.Contains(summaries[1], "failed_") {
+		t.Errorf("summary %q isn't reset after the counts were logged", summaries[1])
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	wh := newTestWebhook(t, Options{
+		Forwarder:   newTestForwarder(t, newTestUpstream(t, http.StatusOK)),
+		IdleTimeout: 100 * time.Millisecond,
+	})
+	wh.server.Handler = wh.handler()
+	wh.server.ErrorLog = stdlog.New(ioutil.Discard, "", 0)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go wh.server.ServeTLS(ln, "", "")
+	t.Cleanup(func() { wh.server.Close() })
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"http/1.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET " + DefaultHealthzPath + " HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Close {
+		t.Fatal("the connection isn't kept alive after the first response")
+	}
+
+	// the connection is held idle past the idle timeout, the server closes it
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if n, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Read() = %d, %v on the idle connection, want EOF", n, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("idle connection closed after %s with an idle timeout of 100ms", elapsed)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	tests := []struct {
+		rate int
+		want int // sampled events of 10
+	}{
+		{rate: 0, want: 10},
+		{rate: 1, want: 10},
+		{rate: 3, want: 4},
+		{rate: 10, want: 1},
+	}
+	for _, tc := range tests {
+		s := newSampler(tc.rate)
+		var got int
+		for i := 0; i < 10; i++ {
+			if s.sample() {
+				got++
+			}
+		}
+		if got != tc.want {
+			t.Errorf("sampler of rate %d kept %d of 10 events, want %d", tc.rate, got, tc.want)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientAuth bool
+		remoteAddr string
+		tls        *tls.ConnectionState
+		wantStatus int
+	}{
+		{name: "loopback client without client CA", remoteAddr: "127.0.0.1:40000", wantStatus: http.StatusOK},
+		{name: "IPv6 loopback client without client CA", remoteAddr: "[::1]:40000", wantStatus: http.StatusOK},
+		{name: "remote client without client CA", remoteAddr: "10.0.0.1:40000", wantStatus: http.StatusForbidden},
+		{name: "remote client with a verified certificate without client CA", remoteAddr: "10.0.0.1:40000", tls: verifiedClient("admin"), wantStatus: http.StatusForbidden},
+		{name: "client without certificate", clientAuth: true, remoteAddr: "127.0.0.1:40000", wantStatus: http.StatusUnauthorized},
+		{name: "remote client with a verified certificate", clientAuth: true, remoteAddr: "10.0.0.1:40000", tls: verifiedClient("admin"), wantStatus: http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newTestUpstream(t, http.StatusOK)
+			prev := newTestForwarder(t, upstream)
+			next := newTestForwarder(t, upstream)
+			wh := newTestWebhook(t, Options{
+				Forwarder: prev,
+				Reload:    func() (*forwarder.Forwarder, error) { return next, nil },
+			})
+			wh.clientAuth = tc.clientAuth
+
+			req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+			req.RemoteAddr = tc.remoteAddr
+			req.TLS = tc.tls
+			rec := httptest.NewRecorder()
+			wh.Reload(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+			want := prev
+			if tc.wantStatus == http.StatusOK {
+				want = next
+			}
+			if wh.Forwarder() != want {
+				t.Errorf("the forwarder was swapped = %v, want %v", wh.Forwarder() == next, want == next)
+			}
+		})
+	}
+}
+
+func TestReloadMethodNotAllowed(t *testing.T) {
+	fwder := newTestForwarder(t, newTestUpstream(t, http.StatusOK))
+	wh := newTestWebhook(t, Options{
+		Forwarder: fwder,
+		Reload:    func() (*forwarder.Forwarder, error) { return fwder, nil },
+	})
+	rec := httptest.NewRecorder()
+	wh.Reload(rec, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestShutdownTwice(t *testing.T) {
+	wh := newTestWebhook(t, Options{Forwarder: newTestForwarder(t, newTestUpstream(t, http.StatusOK))})
+	for i := 0; i < 2; i++ {
+		if err := wh.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown() #%d = %v, want nil", i+1, err)
+		}
+	}
+}
+
+func TestReloadBrokenConfig(t *testing.T) {
+	upstream := newTestUpstream(t, http.StatusOK)
+	config := filepath.Join(t.TempDir(), "alertmanagers.yaml")
+	// the api proxy is only resolved once the health checkers and the rate limiter are started
+	content := `
+max_alerts_per_minute: 10
+api_proxy: missing
+alertmanagers:
+- name: a
+  static_configs: [` + strings.TrimPrefix(upstream.URL, "http://") + `]
+  health_check_interval: 1s
+routing_groups:
+- name: team
+  alertmanagers:
+  - static_configs: [` + strings.TrimPrefix(upstream.URL, "http://") + `]
+    health_check_interval: 1s
+`
+	if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fwder := newTestForwarder(t, upstream)
+	wh := newTestWebhook(t, Options{
+		Forwarder: fwder,
+		Reload:    func() (*forwarder.Forwarder, error) { return forwarder.NewForwarder(log.NewNopLogger(), config) },
+	})
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/-/reload", nil)
+		req.RemoteAddr = "127.0.0.1:40000"
+		rec := httptest.NewRecorder()
+		wh.Reload(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+		}
+	}
+	if wh.Forwarder() != fwder {
+		t.Error("the forwarder was swapped by a broken configuration")
+	}
+
+	// the goroutines of the broken forwarders exit asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines leaked by the broken reloads", after-before)
+	}
+}
+
+func TestProxyAPI(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		tls        *tls.ConnectionState
+		wantStatus int
+	}{
+		{name: "verified client", method: http.MethodGet, tls: verifiedClient("reader"), wantStatus: http.StatusOK},
+		{name: "client without certificate", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "write request", method: http.MethodPost, tls: verifiedClient("reader"), wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newTestUpstream(t, http.StatusOK)
+			config := filepath.Join(t.TempDir(), "alertmanagers.yaml")
+			content := "api_proxy: upstream\nalertmanagers:\n- name: upstream\n  static_configs: [" + strings.TrimPrefix(upstream.URL, "http://") + "]\n"
+			if err := ioutil.WriteFile(config, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			fwder, err := forwarder.NewForwarder(log.NewNopLogger(), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(fwder.Stop)
+			wh := newTestWebhook(t, Options{Forwarder: fwder})
+
+			req := httptest.NewRequest(tc.method, "/api/v2/status", nil)
+			req.TLS = tc.tls
+			rec := httptest.NewRecorder()
+			wh.ProxyAPI(rec, req)
+			if rec.Code != tc.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}